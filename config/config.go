@@ -1,8 +1,11 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // Config 应用配置结构
@@ -20,8 +23,54 @@ type Config struct {
 	// Ollama API配置
 	OllamaAPIURL string
 
+	// AI验证码提取使用的模型服务配置
+	LLMProvider         string        // ollama或openai（兼容OpenAI chat completions接口）
+	LLMAPIURL           string        // 接口地址，Ollama默认使用OllamaAPIURL
+	LLMAPIKey           string        // OpenAI兼容接口的密钥
+	LLMModel            string        // 模型名称
+	LLMPrompt           string        // 提示词模板，为空时使用默认模板
+	LLMTimeout          time.Duration // 单次请求超时时间
+	LLMRetries          int           // 失败后的重试次数
+	LLMWorkers          int           // 后台AI提取的并发数
+	LLMQueueSize        int           // 后台AI提取队列的最大长度，队列已满时跳过AI提取
+	LLMBreakerThreshold int           // 连续失败多少次后暂停调用模型服务
+	LLMBreakerCooldown  time.Duration // 暂停多久后发送探测请求
+	LLMCacheSize        int           // 按内容缓存的模型回复数量，0表示不缓存
+	LLMCacheTTL         time.Duration // 缓存有效期
+
 	// Redis配置
 	RedisURL string
+
+	// 随机用户名配置
+	UsernameStrategy string // 默认的生成策略：hex/words/pinyin/syllables
+	UsernameLength   int    // hex策略的用户名长度
+	UsernameEntropy  int    // words/pinyin/syllables策略的最小熵（位）
+
+	// 获取全部活跃邮箱时使用的管理令牌，为空时/api/email/list只返回请求中令牌对应的邮箱
+	AdminToken string
+
+	// 邮箱有效期配置
+	MailboxTTL             time.Duration // 创建时没有指定有效期时使用
+	MailboxMinTTL          time.Duration // 创建或续期时允许的最短有效期
+	MailboxMaxTTL          time.Duration // 创建或续期时允许的最长有效期
+	MailboxJanitorInterval time.Duration // 内存存储清理过期邮箱的间隔
+
+	// 验证码长度范围（不含分隔符）
+	CodeMinLength int
+	CodeMaxLength int
+
+	// 验证码提取器链，按顺序运行，例如regex,html,ai
+	CodeExtractors []string
+	// 按发件人配置的验证码提取规则文件（YAML或JSON），在提取器链之前运行
+	CodeRulesFile string
+
+	// 图片代理配置
+	ImageProxySecret       string
+	ImageProxyURLTTL       time.Duration
+	ImageProxyMaxBytes     int64
+	ImageProxyTimeout      time.Duration
+	ImageProxyCacheBytes   int64
+	ImageProxyAllowPrivate bool
 }
 
 // LoadConfig 从环境变量加载配置
@@ -29,17 +78,108 @@ func LoadConfig() (*Config, error) {
 	webPort, _ := strconv.Atoi(getEnv("WEB_PORT", "8080"))
 	debugMode, _ := strconv.ParseBool(getEnv("DEBUG_MODE", "false"))
 	smtpPort, _ := strconv.Atoi(getEnv("SMTP_PORT", "25"))
+	llmTimeout, _ := time.ParseDuration(getEnv("LLM_TIMEOUT", "5s"))
+	llmRetries, _ := strconv.Atoi(getEnv("LLM_RETRIES", "1"))
+	llmWorkers, _ := strconv.Atoi(getEnv("LLM_WORKERS", "2"))
+	llmQueueSize, _ := strconv.Atoi(getEnv("LLM_QUEUE_SIZE", "100"))
+	llmBreakerThreshold, _ := strconv.Atoi(getEnv("LLM_BREAKER_THRESHOLD", "5"))
+	llmBreakerCooldown, _ := time.ParseDuration(getEnv("LLM_BREAKER_COOLDOWN", "30s"))
+	llmCacheSize, _ := strconv.Atoi(getEnv("LLM_CACHE_SIZE", "1000"))
+	llmCacheTTL, _ := time.ParseDuration(getEnv("LLM_CACHE_TTL", "24h"))
+	usernameLength, _ := strconv.Atoi(getEnv("USERNAME_LENGTH", "10"))
+	usernameEntropy, _ := strconv.Atoi(getEnv("USERNAME_ENTROPY", "32"))
+	mailboxTTL, _ := time.ParseDuration(getEnv("MAILBOX_TTL", "24h"))
+	mailboxMinTTL, _ := time.ParseDuration(getEnv("MAILBOX_MIN_TTL", "10m"))
+	mailboxMaxTTL, _ := time.ParseDuration(getEnv("MAILBOX_MAX_TTL", "168h"))
+	mailboxJanitorInterval, _ := time.ParseDuration(getEnv("MAILBOX_JANITOR_INTERVAL", "1m"))
+	codeMinLength, _ := strconv.Atoi(getEnv("CODE_MIN_LENGTH", "4"))
+	codeMaxLength, _ := strconv.Atoi(getEnv("CODE_MAX_LENGTH", "8"))
+	imageProxyURLTTL, _ := time.ParseDuration(getEnv("IMAGE_PROXY_URL_TTL", "24h"))
+	imageProxyMaxBytes, _ := strconv.ParseInt(getEnv("IMAGE_PROXY_MAX_BYTES", "5242880"), 10, 64)
+	imageProxyTimeout, _ := time.ParseDuration(getEnv("IMAGE_PROXY_TIMEOUT", "10s"))
+	imageProxyCacheBytes, _ := strconv.ParseInt(getEnv("IMAGE_PROXY_CACHE_BYTES", "67108864"), 10, 64)
+	imageProxyAllowPrivate, _ := strconv.ParseBool(getEnv("IMAGE_PROXY_ALLOW_PRIVATE", "false"))
+
+	// 模型服务地址：优先使用LLM_API_URL，Ollama兼容原有的OLLAMA_API_URL和HOST_ADDRESS
+	llmProvider := strings.ToLower(getEnv("LLM_PROVIDER", "ollama"))
+	ollamaAPIURL := getEnv("OLLAMA_API_URL", "")
+	llmAPIURL := getEnv("LLM_API_URL", "")
+	if llmAPIURL == "" && llmProvider == "ollama" {
+		llmAPIURL = defaultOllamaAPIURL(ollamaAPIURL)
+	}
+
+	// 提示词模板可以直接配置，也可以从文件读取
+	llmPrompt := getEnv("LLM_PROMPT", "")
+	if promptFile := getEnv("LLM_PROMPT_FILE", ""); promptFile != "" {
+		data, err := os.ReadFile(promptFile)
+		if err != nil {
+			return nil, fmt.Errorf("读取提示词文件失败: %w", err)
+		}
+		llmPrompt = string(data)
+	}
 
 	return &Config{
 		MailDomain:   getEnv("MAIL_DOMAIN", "example.com"),
 		WebPort:      webPort,
 		DebugMode:    debugMode,
 		SMTPPort:     smtpPort,
-		OllamaAPIURL: getEnv("OLLAMA_API_URL", ""),
+		OllamaAPIURL: ollamaAPIURL,
 		RedisURL:     getEnv("REDIS_URL", ""),
+
+		UsernameStrategy: getEnv("USERNAME_STRATEGY", "hex"),
+		UsernameLength:   usernameLength,
+		UsernameEntropy:  usernameEntropy,
+
+		AdminToken: getEnv("ADMIN_TOKEN", ""),
+
+		MailboxTTL:             mailboxTTL,
+		MailboxMinTTL:          mailboxMinTTL,
+		MailboxMaxTTL:          mailboxMaxTTL,
+		MailboxJanitorInterval: mailboxJanitorInterval,
+
+		LLMProvider:         llmProvider,
+		LLMAPIURL:           llmAPIURL,
+		LLMAPIKey:           getEnv("LLM_API_KEY", ""),
+		LLMModel:            getEnv("LLM_MODEL", "gemma3:1b"),
+		LLMPrompt:           llmPrompt,
+		LLMTimeout:          llmTimeout,
+		LLMRetries:          llmRetries,
+		LLMWorkers:          llmWorkers,
+		LLMQueueSize:        llmQueueSize,
+		LLMBreakerThreshold: llmBreakerThreshold,
+		LLMBreakerCooldown:  llmBreakerCooldown,
+		LLMCacheSize:        llmCacheSize,
+		LLMCacheTTL:         llmCacheTTL,
+
+		CodeMinLength:  codeMinLength,
+		CodeMaxLength:  codeMaxLength,
+		CodeExtractors: splitList(getEnv("CODE_EXTRACTORS", "regex,html,ai")),
+		CodeRulesFile:  getEnv("CODE_RULES_FILE", ""),
+
+		ImageProxySecret:       getEnv("IMAGE_PROXY_SECRET", ""),
+		ImageProxyURLTTL:       imageProxyURLTTL,
+		ImageProxyMaxBytes:     imageProxyMaxBytes,
+		ImageProxyTimeout:      imageProxyTimeout,
+		ImageProxyCacheBytes:   imageProxyCacheBytes,
+		ImageProxyAllowPrivate: imageProxyAllowPrivate,
 	}, nil
 }
 
+// defaultOllamaAPIURL 获取Ollama API地址，未配置时尝试宿主机地址和Docker网络
+func defaultOllamaAPIURL(configured string) string {
+	if configured != "" {
+		return configured
+	}
+
+	// 从环境变量获取宿主机地址
+	if host := getEnv("HOST_ADDRESS", ""); host != "" {
+		return "http://" + host + ":11434/api/generate"
+	}
+
+	// 尝试Docker网络方式访问
+	return "http://172.17.0.1:11434/api/generate"
+}
+
 // getEnv 获取环境变量，如果不存在则返回默认值
 func getEnv(key, defaultValue string) string {
 	if value, exists := os.LookupEnv(key); exists {
@@ -47,3 +187,14 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// splitList 解析逗号分隔的列表，忽略空项
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
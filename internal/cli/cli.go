@@ -0,0 +1,48 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+)
+
+// command 命令行子命令
+type command struct {
+	name        string
+	description string
+	run         func(args []string) int
+}
+
+// 支持的子命令
+var commands = []command{
+	{"test-rule", "使用验证码提取规则测试一封邮件", runTestRule},
+	{"eval-extraction", "在测试语料上评估验证码提取的准确率", runEvalExtraction},
+}
+
+// Run 执行子命令，返回进程退出码
+func Run(args []string) int {
+	if len(args) == 0 {
+		usage()
+		return 2
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			return cmd.run(args[1:])
+		}
+	}
+
+	if args[0] != "help" && args[0] != "-h" && args[0] != "--help" {
+		fmt.Fprintf(os.Stderr, "未知命令: %s\n\n", args[0])
+	}
+	usage()
+	return 2
+}
+
+// usage 输出子命令列表
+func usage() {
+	fmt.Fprintln(os.Stderr, "用法: mail-temp [命令] [参数]")
+	fmt.Fprintln(os.Stderr, "不带命令时启动服务。可用命令:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-18s %s\n", cmd.name, cmd.description)
+	}
+}
@@ -0,0 +1,110 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"mail-temp/config"
+	"mail-temp/internal/email"
+)
+
+// runEvalExtraction 使用与SMTP接收相同的流程处理语料目录中的邮件，输出验证码和链接提取的准确率、召回率以及失败的邮件
+func runEvalExtraction(args []string) int {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "加载配置失败: %v\n", err)
+		return 1
+	}
+
+	flags := flag.NewFlagSet("eval-extraction", flag.ContinueOnError)
+	corpus := flags.String("corpus", "testdata/corpus", "语料目录，包含.eml文件和expected.json")
+	extractors := flags.String("extractors", strings.Join(cfg.CodeExtractors, ","), "提取器列表，默认使用CODE_EXTRACTORS")
+	rulesFile := flags.String("rules", cfg.CodeRulesFile, "规则文件路径，默认使用CODE_RULES_FILE")
+	deferred := flags.Bool("ai", false, "同步运行AI等延迟的提取器（需要配置模型服务）")
+	jsonOutput := flags.Bool("json", false, "以JSON格式输出结果")
+	verbose := flags.Bool("v", false, "输出提取过程的日志")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if !*verbose {
+		log.SetOutput(io.Discard)
+	}
+
+	evalConfig := *cfg
+	evalConfig.CodeExtractors = nil
+	for _, name := range strings.Split(*extractors, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			evalConfig.CodeExtractors = append(evalConfig.CodeExtractors, name)
+		}
+	}
+	evalConfig.CodeRulesFile = *rulesFile
+
+	extractor, err := email.NewConfiguredExtractor(&evalConfig)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "创建验证码提取器失败: %v\n", err)
+		return 1
+	}
+
+	report, err := email.EvaluateCorpus(context.Background(), email.NewPipeline(extractor), *corpus, *deferred)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "评估失败: %v\n", err)
+		return 1
+	}
+
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			fmt.Fprintf(os.Stderr, "输出结果失败: %v\n", err)
+			return 1
+		}
+	} else {
+		printEvalReport(report)
+	}
+
+	if len(report.Failures) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// printEvalReport 以文本格式输出评估结果
+func printEvalReport(report *email.EvalReport) {
+	fmt.Printf("语料: %s（%d封邮件）\n", report.Corpus, report.Total)
+	fmt.Printf("提取器: %s", report.Extractors)
+	if report.Deferred {
+		fmt.Print("（包含延迟的提取器）")
+	}
+	fmt.Println()
+	fmt.Println()
+
+	for _, row := range []struct {
+		name  string
+		score email.EvalScore
+	}{{"验证码", report.Code}, {"链接", report.Link}} {
+		fmt.Printf("%s: 准确率 %.1f%%  召回率 %.1f%%  (TP %d, FP %d, FN %d)\n",
+			row.name, row.score.Precision*100, row.score.Recall*100,
+			row.score.TruePositives, row.score.FalsePositives, row.score.FalseNegatives)
+	}
+
+	if len(report.Failures) == 0 {
+		fmt.Println("\n全部通过")
+		return
+	}
+
+	fmt.Printf("\n失败 %d 项:\n", len(report.Failures))
+	for _, failure := range report.Failures {
+		fmt.Printf("  %s [%s] 期望 %q，实际 %q", failure.File, failure.Field, failure.Expected, failure.Got)
+		if failure.Extractor != "" {
+			fmt.Printf("（%s）", failure.Extractor)
+		}
+		fmt.Println()
+	}
+}
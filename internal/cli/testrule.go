@@ -0,0 +1,149 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"mail-temp/config"
+	"mail-temp/internal/email"
+	"mail-temp/internal/repository"
+)
+
+// runTestRule 使用规则文件测试一封邮件，邮件可以来自.eml文件、运行中的服务或Redis存储
+func runTestRule(args []string) int {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "加载配置失败: %v\n", err)
+		return 1
+	}
+
+	flags := flag.NewFlagSet("test-rule", flag.ContinueOnError)
+	rulesFile := flags.String("rules", cfg.CodeRulesFile, "规则文件路径，默认使用CODE_RULES_FILE")
+	ruleName := flags.String("rule", "", "只测试指定名称的规则")
+	emlFile := flags.String("eml", "", "从.eml文件读取邮件")
+	server := flags.String("server", "", "从运行中的服务读取邮件，例如http://localhost:8080（需要-email、-token和-id）")
+	address := flags.String("email", "", "邮件所属的邮箱地址")
+	token := flags.String("token", "", "使用-server时邮箱的访问令牌（创建邮箱时返回）")
+	id := flags.String("id", "", "邮件ID；未指定-server时从REDIS_URL配置的Redis中读取")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if *rulesFile == "" {
+		fmt.Fprintln(os.Stderr, "请使用-rules或CODE_RULES_FILE指定规则文件")
+		return 2
+	}
+	rules, err := email.NewRuleExtractor(*rulesFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	content, err := loadMessageContent(cfg, *emlFile, *server, *address, *token, *id)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "读取邮件失败: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("发件人: %s\n主题: %s\n\n", content.From, content.Subject)
+
+	results := rules.Test(content, *ruleName)
+	if len(results) == 0 {
+		fmt.Println("没有可测试的规则")
+		return 1
+	}
+
+	extracted := false
+	for _, result := range results {
+		switch {
+		case !result.Matched:
+			fmt.Printf("规则 %s: 发件人/主题/头部条件不匹配\n", result.Rule)
+		case result.Code == "":
+			fmt.Printf("规则 %s: 条件匹配，但没有提取到验证码\n", result.Rule)
+		default:
+			extracted = true
+			fmt.Printf("规则 %s: 验证码 %s（原文: %s，来源: %s）\n", result.Rule, result.Code, result.Display, result.Source)
+		}
+	}
+
+	if !extracted {
+		return 1
+	}
+	return 0
+}
+
+// loadMessageContent 按参数读取邮件内容
+func loadMessageContent(cfg *config.Config, emlFile, server, address, token, id string) (*email.MessageContent, error) {
+	switch {
+	case emlFile != "":
+		raw, err := os.ReadFile(emlFile)
+		if err != nil {
+			return nil, err
+		}
+		return email.ParseMessageContent(raw), nil
+
+	case server != "":
+		if address == "" || id == "" || token == "" {
+			return nil, fmt.Errorf("使用-server时需要-email、-token和-id")
+		}
+		raw, err := fetchRawMessage(server, address, token, id)
+		if err != nil {
+			return nil, err
+		}
+		return email.ParseMessageContent(raw), nil
+
+	case id != "":
+		if cfg.RedisURL == "" {
+			return nil, fmt.Errorf("内存存储中的邮件只能通过-server读取，或配置REDIS_URL")
+		}
+		storage, err := repository.NewRedisStorage(cfg.RedisURL)
+		if err != nil {
+			return nil, err
+		}
+		defer storage.Close()
+
+		message, err := storage.GetEmailByID(id)
+		if err != nil {
+			return nil, err
+		}
+		if message == nil {
+			return nil, fmt.Errorf("邮件不存在: %s", id)
+		}
+		return email.StoredMessageContent(message), nil
+	}
+
+	return nil, fmt.Errorf("请使用-eml、-server或-id指定邮件")
+}
+
+// fetchRawMessage 使用邮箱的访问令牌从运行中的服务下载原始邮件
+func fetchRawMessage(server, address, token, id string) ([]byte, error) {
+	endpoint := strings.TrimRight(server, "/") + "/api/email/" + url.PathEscape(address) + "/messages/" + url.PathEscape(id) + "/raw"
+
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Mailbox-Token", token)
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized:
+		return nil, fmt.Errorf("服务返回%s: 访问令牌与邮箱%s不匹配，或邮箱已过期；请使用-token传入创建邮箱时返回的token", resp.Status, address)
+	default:
+		return nil, fmt.Errorf("服务返回%s", resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
@@ -0,0 +1,319 @@
+package email
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	// 默认验证码长度范围（不含分隔符）
+	defaultCodeMinLength = 4
+	defaultCodeMaxLength = 8
+	// 分组验证码中每组的最大长度，例如"A7K-9QP"、"123 456"
+	maxCodeGroupLength = 5
+	// 查找验证码标签时向前、向后检查的字节数
+	codeLabelLookbehind = 64
+	codeLabelLookahead  = 32
+	// 查找订单号、电话等上下文时向前检查的字节数
+	codeContextLookbehind = 24
+)
+
+var (
+	// 由空格或连字符连接的字母数字片段
+	codeRunPattern = regexp.MustCompile(`[A-Za-z0-9]+(?:[ \-][A-Za-z0-9]+)*`)
+	// 日期，例如2024-05-01、01-05-2024
+	codeDatePattern = regexp.MustCompile(`^(?:(?:19|20)\d{2}[-. ]\d{1,2}[-. ]\d{1,2}|\d{1,2}[-. ]\d{1,2}[-. ](?:19|20)\d{2})$`)
+	// 本地电话号码，例如555-1234
+	codeLocalPhonePattern = regexp.MustCompile(`^\d{3}-\d{4}$`)
+	// 出现在前面时表示订单号、电话等非验证码数字的关键词；"ID"只在紧挨着数字时排除，
+	// 例如"Request ID 4839201"，而"your login ID, use 582716"中的仍然是验证码
+	codeContextExcludePattern = regexp.MustCompile(`(?i)order|invoice|receipt|tracking|reference|\bref\b|account|transaction|\bid\s*[:#]?\s*$|\bno\.?\s*$|phone|\btel\b|mobile|\bfax\b|\bcall|订单|单号|编号|发票|账号|帐号|交易|电话|手机|致电|客服|注文|電話|주문|전화|bestellung|rechnung|telefon|pedido|factura|teléfono|commande|facture|téléphone|encomenda|fatura|telefone|ordine|fattura|заказ|сч[её]т|телефон`)
+	// 句子结束后还有其他文字时，前一句中的标签不属于这个验证码，例如"This code expires in 15 minutes. Suite 1200"
+	codeSentenceBreakPattern = regexp.MustCompile(`[.!?]\s+[^.!?]*\pL[^.!?]*$`)
+	// 出现在后面时表示价格的单位
+	codePriceSuffixPattern = regexp.MustCompile(`(?i)^\s*(?:元|円|usd|rmb|cny|eur|dollars?)`)
+	// 出现在前面时表示价格的货币
+	codePricePrefixPattern = regexp.MustCompile(`(?i)(?:[$¥￥€£]|usd|rmb|cny|eur)\s*$`)
+)
+
+// CodeFinder 按配置的长度在文本中查找验证码，支持纯数字、字母数字混合以及带分隔符的格式
+type CodeFinder struct {
+	minLength int
+	maxLength int
+}
+
+// CodeMatch 文本中找到的验证码
+type CodeMatch struct {
+	Code    string // 去除分隔符后的验证码，用于复制和比较
+	Display string // 邮件中的原始写法
+	Labeled bool   // 附近是否有"验证码"等标签
+	Offset  int    // 在文本中的字节位置
+}
+
+// NewCodeFinder 创建验证码查找器，长度不合法时使用默认值
+func NewCodeFinder(minLength, maxLength int) *CodeFinder {
+	if minLength <= 0 {
+		minLength = defaultCodeMinLength
+	}
+	if maxLength <= 0 {
+		maxLength = defaultCodeMaxLength
+	}
+	if maxLength < minLength {
+		maxLength = minLength
+	}
+	return &CodeFinder{minLength: minLength, maxLength: maxLength}
+}
+
+// Find 返回最可能的验证码：优先带标签的候选，其次是第一个候选
+func (f *CodeFinder) Find(content string) (CodeMatch, bool) {
+	matches := f.FindAll(content)
+	if len(matches) == 0 {
+		return CodeMatch{}, false
+	}
+	for _, match := range matches {
+		if match.Labeled {
+			return match, true
+		}
+	}
+	return matches[0], true
+}
+
+// FindAll 按出现顺序返回所有可能的验证码，已排除颜色、年份、价格、电话和订单号等。
+// 验证码标签使用全部语言的关键词
+func (f *CodeFinder) FindAll(content string) []CodeMatch {
+	return f.FindAllLanguage(content, "")
+}
+
+// FindAllLanguage 与FindAll相同，但只使用指定语言（以及默认语言）的关键词识别标签
+func (f *CodeFinder) FindAllLanguage(content, lang string) []CodeMatch {
+	labels := labelSetFor(lang)
+	var matches []CodeMatch
+	for _, loc := range codeRunPattern.FindAllStringIndex(content, -1) {
+		for _, span := range splitCodeRun(content[loc[0]:loc[1]]) {
+			start, end := loc[0]+span[0], loc[0]+span[1]
+			if match, ok := f.candidate(content, start, end, labels); ok {
+				matches = append(matches, match)
+			}
+		}
+	}
+	return matches
+}
+
+// candidate 检查content[start:end]是否是验证码
+func (f *CodeFinder) candidate(content string, start, end int, labels *codeLabelSet) (CodeMatch, bool) {
+	display := content[start:end]
+	code := normalizeCode(display)
+	if len(code) < f.minLength || len(code) > f.maxLength || !containsDigit(code) {
+		return CodeMatch{}, false
+	}
+
+	match := CodeMatch{
+		Code:    code,
+		Display: display,
+		Labeled: labels.matches(content, start, end),
+		Offset:  start,
+	}
+
+	// 小写字母混合的片段通常是普通单词或标识符，只接受带标签的
+	if hasLower(code) && (!match.Labeled || len(code) != len(display)) {
+		return CodeMatch{}, false
+	}
+
+	// 未带标签的分组中出现较长的纯字母组时，通常是"COVID-19"这样的名称
+	if !match.Labeled && hasWordGroup(display) {
+		return CodeMatch{}, false
+	}
+
+	if isExcludedCode(content, start, end, match) {
+		return CodeMatch{}, false
+	}
+	return match, true
+}
+
+// normalizeCode 去除验证码中的分隔符
+func normalizeCode(display string) string {
+	return strings.NewReplacer(" ", "", "-", "").Replace(display)
+}
+
+// splitCodeRun 将一段由空格或连字符连接的片段拆分为可能的验证码范围。
+// 相邻的分组在格式兼容时会被合并，例如"Your code is 123 456"中的"123 456"
+func splitCodeRun(run string) [][2]int {
+	type group struct {
+		start, end int
+		sep        byte // 与前一组之间的分隔符
+	}
+
+	var groups []group
+	start := 0
+	for i := 0; i <= len(run); i++ {
+		if i < len(run) && run[i] != ' ' && run[i] != '-' {
+			continue
+		}
+		g := group{start: start, end: i}
+		if start > 0 {
+			g.sep = run[start-1]
+		}
+		groups = append(groups, g)
+		start = i + 1
+	}
+
+	var spans [][2]int
+	for i := 0; i < len(groups); {
+		j := i
+		// 分组验证码的每组都只包含数字和大写字母；以空格分隔时每组都需要包含数字
+		if isCodeGroup(run[groups[i].start:groups[i].end]) {
+			for j+1 < len(groups) {
+				next := groups[j+1]
+				text := run[next.start:next.end]
+				if !isCodeGroup(text) || (j > i && next.sep != groups[i+1].sep) {
+					break
+				}
+				if next.sep == ' ' && (!containsDigit(text) || !containsDigit(run[groups[i].start:groups[i].end])) {
+					break
+				}
+				j++
+			}
+		}
+		spans = append(spans, [2]int{groups[i].start, groups[j].end})
+		i = j + 1
+	}
+	return spans
+}
+
+// isCodeGroup 检查片段是否可以作为分组验证码的一组
+func isCodeGroup(text string) bool {
+	if len(text) < 2 || len(text) > maxCodeGroupLength {
+		return false
+	}
+	return !hasLower(text)
+}
+
+// hasWordGroup 检查分组中是否有4个及以上字母组成的组
+func hasWordGroup(display string) bool {
+	groups := strings.FieldsFunc(display, func(r rune) bool { return r == ' ' || r == '-' })
+	if len(groups) < 2 {
+		return false
+	}
+	for _, group := range groups {
+		if len(group) >= 4 && !containsDigit(group) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches 检查验证码前面同一行内或紧跟在后面是否有"验证码"等标签
+func (l *codeLabelSet) matches(content string, start, end int) bool {
+	before := lineBefore(content, start, codeLabelLookbehind)
+	if loc := codeSentenceBreakPattern.FindStringIndex(before); loc != nil {
+		before = before[loc[0]+1:]
+	}
+	if l.before.MatchString(before) {
+		return true
+	}
+	after := lineAfter(content, end, codeLabelLookahead)
+	return l.after.MatchString(after)
+}
+
+// isExcludedCode 排除常见的误判：颜色、年份、日期、价格、电话、订单号、URL和时间的一部分
+func isExcludedCode(content string, start, end int, match CodeMatch) bool {
+	prev, next := byteBefore(content, start), byteAt(content, end)
+
+	// 十六进制颜色、编号（#fff000、#12345）以及URL、邮箱地址、标识符的一部分
+	if prev != 0 && strings.IndexByte("#@/\\=&?%_+.,", prev) >= 0 {
+		// 句号或逗号前面是数字时表示小数或千位分隔，其他情况是正常的标点
+		if prev != '.' && prev != ',' || isDigitByte(byteBefore(content, start-1)) {
+			return true
+		}
+	}
+	if next != 0 && strings.IndexByte("@/\\=&_%", next) >= 0 {
+		return true
+	}
+	if (next == '.' || next == ',') && isDigitByte(byteAt(content, end+1)) {
+		return true
+	}
+
+	// 价格
+	before := lineBefore(content, start, codeContextLookbehind)
+	if codePricePrefixPattern.MatchString(before) || codePriceSuffixPattern.MatchString(content[end:]) {
+		return true
+	}
+
+	// 日期
+	if codeDatePattern.MatchString(match.Display) {
+		return true
+	}
+
+	if match.Labeled {
+		return false
+	}
+
+	// 年份
+	if len(match.Code) == 4 {
+		if year, err := strconv.Atoi(match.Code); err == nil && year >= 1900 && year <= 2099 {
+			return true
+		}
+	}
+
+	// 电话号码、订单号等
+	return codeLocalPhonePattern.MatchString(match.Display) || codeContextExcludePattern.MatchString(before)
+}
+
+// lineBefore 返回start之前同一行内最多n个字节
+func lineBefore(content string, start, n int) string {
+	from := start - n
+	if from < 0 {
+		from = 0
+	}
+	text := content[from:start]
+	if i := strings.LastIndexByte(text, '\n'); i >= 0 {
+		text = text[i+1:]
+	}
+	return strings.ToValidUTF8(text, "")
+}
+
+// lineAfter 返回end之后同一行内最多n个字节
+func lineAfter(content string, end, n int) string {
+	to := end + n
+	if to > len(content) {
+		to = len(content)
+	}
+	text := content[end:to]
+	if i := strings.IndexByte(text, '\n'); i >= 0 {
+		text = text[:i]
+	}
+	return strings.ToValidUTF8(text, "")
+}
+
+// byteBefore 返回位置i之前的字节，不存在时返回0
+func byteBefore(content string, i int) byte {
+	if i <= 0 || i > len(content) {
+		return 0
+	}
+	return content[i-1]
+}
+
+// byteAt 返回位置i的字节，不存在时返回0
+func byteAt(content string, i int) byte {
+	if i < 0 || i >= len(content) {
+		return 0
+	}
+	return content[i]
+}
+
+// isDigitByte 检查字节是否是ASCII数字
+func isDigitByte(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+// containsDigit 检查文本是否包含数字
+func containsDigit(text string) bool {
+	return strings.IndexFunc(text, unicode.IsDigit) >= 0
+}
+
+// hasLower 检查文本是否包含小写字母
+func hasLower(text string) bool {
+	return strings.IndexFunc(text, unicode.IsLower) >= 0
+}
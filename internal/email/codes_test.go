@@ -0,0 +1,128 @@
+package email
+
+import "testing"
+
+// TestCodeFinderFind 识别纯数字、字母数字混合和带分隔符的验证码，优先带标签的候选
+func TestCodeFinderFind(t *testing.T) {
+	finder := NewCodeFinder(4, 8)
+	tests := []struct {
+		name    string
+		content string
+		code    string
+		display string
+	}{
+		{"纯数字", "Your verification code is 482913.", "482913", "482913"},
+		{"空格分组", "Your code is 123 456", "123456", "123 456"},
+		{"连字符分组", "Use code ABC-123 to sign in", "ABC123", "ABC-123"},
+		{"三组", "Security code: 12-34-56", "123456", "12-34-56"},
+		{"大写字母数字", "验证码：K7Q2M9", "K7Q2M9", "K7Q2M9"},
+		{"标签在后", "482913 is your login code", "482913", "482913"},
+		{"带标签的小写", "Your code: a7b3c9", "a7b3c9", "a7b3c9"},
+		{"优先带标签", "Ticket 5521 was updated. Your code is 7788", "7788", "7788"},
+		{"没有标签时取第一个", "Enter 5521 or 7788", "5521", "5521"},
+	}
+	for _, tt := range tests {
+		match, ok := finder.Find(tt.content)
+		if !ok {
+			t.Errorf("%s: 期望找到%s，实际没有找到", tt.name, tt.code)
+			continue
+		}
+		if match.Code != tt.code || match.Display != tt.display {
+			t.Errorf("%s: 期望%s(%q)，实际%s(%q)", tt.name, tt.code, tt.display, match.Code, match.Display)
+		}
+	}
+}
+
+// TestCodeFinderExclusions 排除颜色、年份、日期、价格、电话、订单号、URL片段、小数和普通单词
+func TestCodeFinderExclusions(t *testing.T) {
+	finder := NewCodeFinder(4, 8)
+	for name, content := range map[string]string{
+		"颜色":    "<td style=\"color:#123456\">",
+		"编号":    "Issue #12345 was closed",
+		"年份":    "© 2024 ACME Inc.",
+		"日期":    "Sent on 2024-01-15",
+		"价格前缀":  "Total: $1299",
+		"价格后缀":  "共计 3999 元",
+		"本地电话":  "Call 555-1234 today",
+		"订单号":   "Order number 88213456",
+		"电话":    "电话 13800138000",
+		"URL路径": "https://example.com/users/123456/profile",
+		"查询参数":  "https://example.com/?id=482913&x=1",
+		"邮箱":    "user123456@example.com",
+		"小数":    "Version 1234.56",
+		"千位分隔":  "Balance 1,234,567",
+		"小写单词":  "Download the app2024x now",
+		"名称":    "COVID-19 update",
+		"没有数字":  "ABCDEF",
+		"太短":    "Code 123",
+		"太长":    "Code 1234567890",
+	} {
+		if match, ok := finder.Find(content); ok {
+			t.Errorf("%s: 期望没有验证码，实际%s(%q)", name, match.Code, match.Display)
+		}
+	}
+}
+
+// TestCodeFinderLabeledOverridesContext 带标签时年份形式的验证码也被接受，但日期和价格仍被排除
+func TestCodeFinderLabeledOverridesContext(t *testing.T) {
+	finder := NewCodeFinder(4, 8)
+	if match, ok := finder.Find("Your code is 2024"); !ok || match.Code != "2024" || !match.Labeled {
+		t.Errorf("期望带标签的2024，实际 %+v, %v", match, ok)
+	}
+	for _, content := range []string{"Your code is 2024-01-15", "Your code costs $4829"} {
+		if match, ok := finder.Find(content); ok {
+			t.Errorf("%s: 期望没有验证码，实际 %+v", content, match)
+		}
+	}
+}
+
+// TestCodeFinderFindAll 按出现顺序返回所有候选，并记录位置
+func TestCodeFinderFindAll(t *testing.T) {
+	content := "Code A: 1111, code B: 2222 33"
+	matches := NewCodeFinder(4, 6).FindAll(content)
+	if len(matches) != 2 {
+		t.Fatalf("期望2个候选，实际 %+v", matches)
+	}
+	for i, want := range []string{"1111", "222233"} {
+		if matches[i].Code != want || content[matches[i].Offset:matches[i].Offset+len(matches[i].Display)] != matches[i].Display {
+			t.Errorf("第%d个候选不正确: %+v", i+1, matches[i])
+		}
+	}
+}
+
+// TestNewCodeFinderDefaults 长度不合法时使用默认值，最大长度不小于最小长度
+func TestNewCodeFinderDefaults(t *testing.T) {
+	if f := NewCodeFinder(0, -1); f.minLength != defaultCodeMinLength || f.maxLength != defaultCodeMaxLength {
+		t.Errorf("期望默认长度，实际 %+v", f)
+	}
+	if f := NewCodeFinder(6, 4); f.maxLength != 6 {
+		t.Errorf("期望最大长度调整为6，实际 %+v", f)
+	}
+}
+
+// TestSplitCodeRun 相邻分组在格式兼容时合并，分隔符不一致或纯字母组不合并
+func TestSplitCodeRun(t *testing.T) {
+	for run, want := range map[string][]string{
+		"123 456":        {"123 456"},
+		"AB12-CD34":      {"AB12-CD34"},
+		"12-34 56":       {"12-34", "56"},
+		"is 482913":      {"is", "482913"},
+		"CODE 123":       {"CODE", "123"},
+		"123456 Welcome": {"123456", "Welcome"},
+	} {
+		var got []string
+		for _, span := range splitCodeRun(run) {
+			got = append(got, run[span[0]:span[1]])
+		}
+		if len(got) != len(want) {
+			t.Errorf("%q: 期望%q，实际%q", run, want, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != want[i] {
+				t.Errorf("%q: 期望%q，实际%q", run, want, got)
+				break
+			}
+		}
+	}
+}
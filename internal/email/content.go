@@ -0,0 +1,67 @@
+package email
+
+import (
+	"strings"
+
+	"mail-temp/internal/repository"
+)
+
+// ParseMessageContent 解析原始邮件，得到用于验证码提取的内容（不改写图片地址）
+func ParseMessageContent(raw []byte) *MessageContent {
+	return contentOf(parseMessage(raw), string(raw))
+}
+
+// contentOf 由解析后的邮件得到用于验证码提取的内容，SMTP接收、嵌入邮件和重新提取共用；
+// 结构化解析没有得到主题或正文时，回退到从原始数据data中提取，data为空时不回退
+func contentOf(parsed *parsedMessage, data string) *MessageContent {
+	content := &MessageContent{
+		From:        parsed.Header("From"),
+		Headers:     parsed.Headers,
+		Subject:     parsed.Header("Subject"),
+		Attachments: attachmentTexts(parsed.Attachments),
+		Images:      decodeImageCodes(parsed.Attachments, parsed.HTML),
+	}
+	if content.Subject == "" && data != "" {
+		if rawSubject := extractHeaderField(data, "Subject"); rawSubject != "" {
+			content.Subject = decodeEmailSubject(rawSubject)
+		}
+	}
+
+	plainText, htmlContent := parsed.Text, parsed.HTML
+	if strings.TrimSpace(plainText) == "" && strings.TrimSpace(htmlContent) == "" && data != "" {
+		plainText, htmlContent = extractBodyFallback(data)
+	}
+
+	// 清理HTML中的脚本、事件处理器等危险内容；远程图片保留原地址，展示时才改写为代理地址
+	content.HTML = sanitizeHTML(htmlContent, nil)
+	// 优先使用text/plain部分，只有HTML时由HTML转换，避免CSS颜色、宽度和追踪ID等被误识别为验证码
+	if strings.TrimSpace(plainText) == "" && content.HTML != "" {
+		plainText = htmlToText(content.HTML)
+	}
+	content.Text = strings.TrimSpace(plainText)
+	return content
+}
+
+// StoredMessageContent 获取已存储邮件的内容，有原始邮件时重新解析以包含附件
+func StoredMessageContent(message *repository.EmailMessage) *MessageContent {
+	if len(message.RawMessage) > 0 {
+		if raw, err := decompressRaw(message.RawMessage); err == nil {
+			return ParseMessageContent(raw)
+		}
+	}
+
+	content := &MessageContent{
+		From:    message.From,
+		Headers: message.Headers,
+		Subject: message.Subject,
+		Text:    message.TextContent,
+		HTML:    message.HtmlContent,
+	}
+	for _, header := range message.Headers {
+		if strings.EqualFold(header.Name, "From") {
+			content.From = header.Value
+			break
+		}
+	}
+	return content
+}
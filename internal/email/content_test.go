@@ -0,0 +1,45 @@
+package email
+
+import (
+	"io"
+	"log"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestParseMessageContentMatchesPipeline 重新提取时解析得到的内容与SMTP接收时保存的一致
+func TestParseMessageContentMatchesPipeline(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	raw := "From: =?UTF-8?B?QUNNRSDlronlhag=?= <security@acme.example>\r\n" +
+		"Subject: =?UTF-8?Q?Your_c=C3=B3digo?=\r\n" +
+		"Content-Type: text/html; charset=utf-8\r\n" +
+		"\r\n" +
+		"<style>.x{color:#123456}</style><p>Your code is <b>482913</b></p><script>alert(1)</script>\r\n"
+
+	extractor, err := NewCodeExtractorChain([]string{"regex"}, ExtractorOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mail := &Mail{From: "security@acme.example", Timestamp: time.Now(), Raw: []byte(raw)}
+	NewPipeline(extractor).Process(mail, raw)
+
+	content := ParseMessageContent([]byte(raw))
+	if content.Subject != mail.Subject || content.Subject != "Your código" {
+		t.Errorf("主题不一致: 解析%q，接收%q", content.Subject, mail.Subject)
+	}
+	if content.Text != mail.TextContent || content.Text == "" {
+		t.Errorf("正文不一致: 解析%q，接收%q", content.Text, mail.TextContent)
+	}
+	if content.HTML != mail.HtmlContent {
+		t.Errorf("HTML不一致: 解析%q，接收%q", content.HTML, mail.HtmlContent)
+	}
+	if content.From != "ACME 安全 <security@acme.example>" {
+		t.Errorf("期望解码后的发件人，实际%q", content.From)
+	}
+	if mail.Code != "482913" {
+		t.Errorf("期望验证码482913，实际%q", mail.Code)
+	}
+}
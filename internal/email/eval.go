@@ -0,0 +1,201 @@
+package email
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// CorpusFile 评估语料中记录期望结果的文件名
+const CorpusFile = "expected.json"
+
+// CorpusFixture 评估语料中的一封邮件及其期望结果
+type CorpusFixture struct {
+	File     string `json:"file"`               // 相对于语料目录的.eml文件
+	Language string `json:"language,omitempty"` // 期望检测出的语言，为空时不检查
+	Code     string `json:"code"`               // 期望的验证码，为空表示邮件中没有验证码
+	Link     string `json:"link,omitempty"`     // 期望的操作链接，为空表示没有操作链接
+	// 期望的验证码有效期（Go时长格式，例如"10m"），即过期时间与接收时间之差；为空时不检查
+	ExpiresIn string `json:"expiresIn,omitempty"`
+}
+
+// Corpus 评估语料
+type Corpus struct {
+	Fixtures []CorpusFixture `json:"fixtures"`
+}
+
+// EvalScore 一类提取结果的统计：结果正确为TP，提取到错误或多余的结果为FP，期望的结果没有被提取到为FN
+type EvalScore struct {
+	TruePositives  int     `json:"truePositives"`
+	FalsePositives int     `json:"falsePositives"`
+	FalseNegatives int     `json:"falseNegatives"`
+	Precision      float64 `json:"precision"`
+	Recall         float64 `json:"recall"`
+}
+
+// EvalFailure 结果与期望不一致的邮件
+type EvalFailure struct {
+	File      string `json:"file"`
+	Field     string `json:"field"` // code/link/language/expiry/error
+	Expected  string `json:"expected"`
+	Got       string `json:"got"`
+	Extractor string `json:"extractor,omitempty"` // 给出错误验证码的提取器
+}
+
+// EvalReport 评估结果
+type EvalReport struct {
+	Corpus     string        `json:"corpus"`
+	Extractors string        `json:"extractors"`
+	Deferred   bool          `json:"deferred"` // 是否同步运行了延迟的提取器（AI）
+	Total      int           `json:"total"`
+	Code       EvalScore     `json:"code"`
+	Link       EvalScore     `json:"link"`
+	Failures   []EvalFailure `json:"failures"`
+}
+
+// LoadCorpus 读取语料目录中的expected.json
+func LoadCorpus(dir string) (*Corpus, error) {
+	data, err := os.ReadFile(filepath.Join(dir, CorpusFile))
+	if err != nil {
+		return nil, err
+	}
+	var corpus Corpus
+	if err := json.Unmarshal(data, &corpus); err != nil {
+		return nil, fmt.Errorf("解析%s失败: %w", CorpusFile, err)
+	}
+	return &corpus, nil
+}
+
+// EvaluateCorpus 使用与SMTP接收相同的流程处理语料中的每封邮件，并与期望结果比较；
+// deferred为true时同步运行延迟的提取器（例如AI），否则只评估接收时的启发式结果
+func EvaluateCorpus(ctx context.Context, pipeline *Pipeline, dir string, deferred bool) (*EvalReport, error) {
+	corpus, err := LoadCorpus(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &EvalReport{
+		Corpus:     dir,
+		Extractors: pipeline.extractor.Name(),
+		Deferred:   deferred,
+		Total:      len(corpus.Fixtures),
+		Failures:   []EvalFailure{},
+	}
+
+	for _, fixture := range corpus.Fixtures {
+		raw, err := os.ReadFile(filepath.Join(dir, fixture.File))
+		if err != nil {
+			return nil, err
+		}
+
+		mail := &Mail{ID: fixture.File, Raw: raw, Body: string(raw), Timestamp: time.Now()}
+		pipeline.Process(mail, string(raw))
+		if deferred && mail.ExtractionStatus == ExtractionPending {
+			candidates, err := pipeline.extractor.ExtractDeferred(ctx, mail.content, mail.CodeCandidates)
+			if err != nil {
+				report.Failures = append(report.Failures, EvalFailure{File: fixture.File, Field: "error", Got: err.Error()})
+			}
+			if chosen, ok := chooseCode(candidates); ok {
+				mail.Code, mail.CodeCandidates = chosen.Code, candidates
+			}
+		}
+
+		extractor := ""
+		if len(mail.CodeCandidates) > 0 {
+			extractor = mail.CodeCandidates[0].Extractor
+		}
+		if !scoreResult(&report.Code, fixture.Code, mail.Code, strings.EqualFold) {
+			report.Failures = append(report.Failures, EvalFailure{
+				File:      fixture.File,
+				Field:     "code",
+				Expected:  fixture.Code,
+				Got:       mail.Code,
+				Extractor: extractor,
+			})
+		}
+		if !scoreResult(&report.Link, fixture.Link, mail.PrimaryLink, func(a, b string) bool { return a == b }) {
+			report.Failures = append(report.Failures, EvalFailure{
+				File:     fixture.File,
+				Field:    "link",
+				Expected: fixture.Link,
+				Got:      mail.PrimaryLink,
+			})
+		}
+
+		if fixture.ExpiresIn != "" {
+			if got := codeValidityOf(mail); got != fixture.ExpiresIn {
+				report.Failures = append(report.Failures, EvalFailure{
+					File:     fixture.File,
+					Field:    "expiry",
+					Expected: fixture.ExpiresIn,
+					Got:      got,
+				})
+			}
+		}
+
+		if fixture.Language != "" {
+			if lang := DetectLanguage(ParseMessageContent(raw)); lang != fixture.Language {
+				report.Failures = append(report.Failures, EvalFailure{
+					File:     fixture.File,
+					Field:    "language",
+					Expected: fixture.Language,
+					Got:      lang,
+				})
+			}
+		}
+	}
+
+	report.Code.finish()
+	report.Link.finish()
+	return report, nil
+}
+
+// codeValidityOf 返回验证码过期时间与接收时间之差，格式与CorpusFixture.ExpiresIn一致
+func codeValidityOf(mail *Mail) string {
+	if mail.CodeExpiresAt == nil {
+		return ""
+	}
+	// 去掉多余的零，例如"10m0s"写作"10m"，"1h0m0s"写作"1h"
+	validity := mail.CodeExpiresAt.Sub(mail.Timestamp).String()
+	if strings.HasSuffix(validity, "m0s") {
+		validity = strings.TrimSuffix(validity, "0s")
+	}
+	if strings.HasSuffix(validity, "h0m") {
+		validity = strings.TrimSuffix(validity, "0m")
+	}
+	return validity
+}
+
+// scoreResult 统计一个结果，返回结果是否与期望一致
+func scoreResult(score *EvalScore, expected, got string, equal func(a, b string) bool) bool {
+	switch {
+	case expected == "" && got == "":
+		return true
+	case expected != "" && equal(expected, got):
+		score.TruePositives++
+		return true
+	}
+
+	if got != "" {
+		score.FalsePositives++
+	}
+	if expected != "" {
+		score.FalseNegatives++
+	}
+	return false
+}
+
+// finish 计算准确率和召回率，没有样本时为1
+func (s *EvalScore) finish() {
+	s.Precision, s.Recall = 1, 1
+	if n := s.TruePositives + s.FalsePositives; n > 0 {
+		s.Precision = float64(s.TruePositives) / float64(n)
+	}
+	if n := s.TruePositives + s.FalseNegatives; n > 0 {
+		s.Recall = float64(s.TruePositives) / float64(n)
+	}
+}
@@ -0,0 +1,31 @@
+package email
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"testing"
+)
+
+// TestCorpusExtraction 在testdata/corpus上评估启发式提取器，任何一封邮件的结果与期望不一致都会失败
+func TestCorpusExtraction(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	extractor, err := NewCodeExtractorChain([]string{"regex", "html"}, ExtractorOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := EvaluateCorpus(context.Background(), NewPipeline(extractor), "../../testdata/corpus", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Logf("%d封邮件，验证码准确率 %.2f 召回率 %.2f，链接准确率 %.2f 召回率 %.2f",
+		report.Total, report.Code.Precision, report.Code.Recall, report.Link.Precision, report.Link.Recall)
+	for _, failure := range report.Failures {
+		t.Errorf("%s [%s] 期望 %q，实际 %q %s", failure.File, failure.Field, failure.Expected, failure.Got, failure.Extractor)
+	}
+}
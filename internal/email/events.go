@@ -0,0 +1,74 @@
+package email
+
+import (
+	"sync"
+)
+
+// 邮件事件类型
+const (
+	EventMessage = "message" // 收到新邮件
+	EventUpdate  = "update"  // 已保存的邮件被更新，例如后台提取到验证码
+)
+
+// 每个订阅者缓冲的事件数，订阅者处理不及时时丢弃新事件
+const eventBufferSize = 16
+
+// MailEvent 邮箱中的邮件事件
+type MailEvent struct {
+	Type    string `json:"type"`
+	Email   string `json:"email"`
+	Message *Mail  `json:"message"`
+}
+
+// EventBus 进程内按邮箱发布和订阅邮件事件
+type EventBus struct {
+	mu          sync.Mutex
+	subscribers map[string]map[chan MailEvent]struct{}
+}
+
+// NewEventBus 创建事件总线
+func NewEventBus() *EventBus {
+	return &EventBus{
+		subscribers: make(map[string]map[chan MailEvent]struct{}),
+	}
+}
+
+// Subscribe 订阅指定用户名的邮件事件，返回事件通道和取消订阅函数
+func (b *EventBus) Subscribe(username string) (<-chan MailEvent, func()) {
+	ch := make(chan MailEvent, eventBufferSize)
+
+	b.mu.Lock()
+	if b.subscribers[username] == nil {
+		b.subscribers[username] = make(map[chan MailEvent]struct{})
+	}
+	b.subscribers[username][ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			delete(b.subscribers[username], ch)
+			if len(b.subscribers[username]) == 0 {
+				delete(b.subscribers, username)
+			}
+			close(ch)
+		})
+	}
+	return ch, cancel
+}
+
+// Publish 向指定用户名的全部订阅者发布事件，不会阻塞
+func (b *EventBus) Publish(username string, event MailEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subscribers[username] {
+		select {
+		case ch <- event:
+		default:
+			// 订阅者的缓冲区已满，丢弃事件；客户端仍可以通过接口拉取最新邮件
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package email
+
+import (
+	"net/mail"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// 在验证码前后多少字节内查找有效期
+	codeExpiryWindow = 300
+	// 验证码不在正文中（例如只在主题里）时，查找正文开头的字节数
+	codeExpiryHeadBytes = 1000
+	// 有效期关键词与时长或时间之间的最大字节数
+	codeExpiryKeywordDistance = 48
+	// 超过该时长的有效期通常不是验证码的（例如账号、优惠），忽略
+	maxCodeValidity = 30 * 24 * time.Hour
+)
+
+// codeValidityUnits 按语言区分的时长单位
+var codeValidityUnits = []struct {
+	unit  time.Duration
+	words []string
+}{
+	{time.Second, []string{"seconds", "second", "secs", "sec", "秒钟", "秒鐘", "秒", "초", "Sekunden", "Sekunde", "segundos", "segundo", "secondes", "seconde", "secondi", "secondo", "секунд", "секунды", "секунду"}},
+	{time.Minute, []string{"minutes", "minute", "mins", "min", "分钟", "分鐘", "分間", "分", "분", "Minuten", "Minute", "minutos", "minuto", "minuti", "минут", "минуты", "минуту"}},
+	{time.Hour, []string{"hours", "hour", "hrs", "hr", "小时", "小時", "時間", "시간", "Stunden", "Stunde", "horas", "hora", "heures", "heure", "ore", "ora", "часов", "часа", "час"}},
+	{24 * time.Hour, []string{"days", "day", "天", "日間", "日", "일", "Tagen", "Tage", "Tag", "días", "día", "dias", "dia", "jours", "jour", "giorni", "giorno", "дней", "дня", "день"}},
+}
+
+// codeValidityNumbers 英文中常见的数字单词，例如"valid for one hour"
+var codeValidityNumbers = map[string]int{
+	"a": 1, "an": 1, "one": 1, "two": 2, "three": 3, "four": 4, "five": 5, "six": 6, "seven": 7,
+	"eight": 8, "nine": 9, "ten": 10, "fifteen": 15, "twenty": 20, "thirty": 30, "sixty": 60,
+}
+
+// codeExpiryKeywords 按语言区分的有效期关键词，出现在时长或时间附近时才认为是验证码的有效期
+var codeExpiryKeywords = map[string][]string{
+	"zh": {"有效期", "有效", "过期", "過期", "失效", "内", "內", "之前", "截止", "至"},
+	"en": {"valid", "expires", "expire", "expired", "expiry", "expiration", "within", "for the next", "until", "before"},
+	"ja": {"有効期限", "有効", "期限", "以内", "まで"},
+	"ko": {"유효", "만료", "이내", "까지", "동안"},
+	"de": {"gültig", "läuft", "abläuft", "verfällt", "innerhalb", "bis"},
+	"es": {"válido", "válida", "caduca", "expira", "vence", "durante", "hasta"},
+	"fr": {"valable", "valide", "expire", "pendant", "jusqu'à"},
+	"pt": {"válido", "válida", "expira", "durante", "até"},
+	"it": {"valido", "valida", "scade", "entro", "fino alle", "fino a"},
+	"ru": {"действителен", "действительна", "действует", "истекает", "истечёт", "течение", "до"},
+}
+
+var (
+	// 时长，例如"10 minutes"、"5分钟"、"one hour"
+	codeValidityPattern = buildCodeValidityPattern()
+	// 有效期关键词，全部语言合并
+	codeExpiryKeywordPattern = buildCodeExpiryKeywordPattern()
+	// 时间，可带日期和时区，例如"14:30"、"2025-09-01 14:30:00 UTC"、"2025年9月1日 14:30"
+	codeExpiryTimePattern = regexp.MustCompile(`(?i)(?:(\d{4})\s*[-/.年]\s*(\d{1,2})\s*[-/.月]\s*(\d{1,2})\s*日?[\sT,]*)?(\d{1,2})[:：](\d{2})(?:[:：](\d{2}))?(?:\s*(UTC|GMT|Z|[+-]\d{2}:?\d{2}))?`)
+)
+
+// buildCodeValidityPattern 生成匹配"数字+单位"的正则表达式，较长的单位在前
+func buildCodeValidityPattern() *regexp.Regexp {
+	var units []string
+	for _, u := range codeValidityUnits {
+		units = append(units, u.words...)
+	}
+	var numbers []string
+	for word := range codeValidityNumbers {
+		numbers = append(numbers, word)
+	}
+	return regexp.MustCompile(`(?i)(\d{1,4}|\b(?:` + keywordAlternation(numbers) + `))\s*(` + unitAlternation(units) + `)`)
+}
+
+// unitAlternation 与keywordAlternation相同，但只在单位后面加单词边界，允许"10min"这样紧贴数字的写法
+func unitAlternation(units []string) string {
+	parts := strings.Split(keywordAlternation(units), "|")
+	for i, part := range parts {
+		parts[i] = strings.TrimPrefix(part, `\b`)
+	}
+	return strings.Join(parts, "|")
+}
+
+// buildCodeExpiryKeywordPattern 合并全部语言的有效期关键词
+func buildCodeExpiryKeywordPattern() *regexp.Regexp {
+	var keywords []string
+	for _, words := range codeExpiryKeywords {
+		keywords = append(keywords, words...)
+	}
+	return regexp.MustCompile(`(?i)` + keywordAlternation(keywords))
+}
+
+// DetectCodeExpiry 在验证码附近查找有效期（例如"10分钟内有效"、"valid until 14:30 UTC"），
+// 返回按接收时间计算的过期时间；没有找到时返回零值
+func DetectCodeExpiry(content *MessageContent, display string, received time.Time) time.Time {
+	if display == "" {
+		return time.Time{}
+	}
+
+	// 验证码不在正文中时，在包含它的附件（例如PDF）中查找
+	text := content.Text
+	if !strings.Contains(text, display) {
+		for _, attachment := range content.Attachments {
+			if strings.Contains(attachment.Text, display) {
+				text = attachment.Text
+				break
+			}
+		}
+	}
+	if i := strings.Index(text, display); i >= 0 {
+		start, end := i-codeExpiryWindow, i+len(display)+codeExpiryWindow
+		if start < 0 {
+			start = 0
+		}
+		if end > len(text) {
+			end = len(text)
+		}
+		text = strings.ToValidUTF8(text[start:end], "")
+	} else {
+		text = truncateUTF8(text, codeExpiryHeadBytes)
+	}
+
+	// 没有时区的时间按邮件Date头部的时区解释
+	loc := received.Location()
+	for _, header := range content.Headers {
+		if strings.EqualFold(header.Name, "Date") {
+			if date, err := mail.ParseDate(header.Value); err == nil {
+				loc = date.Location()
+			}
+			break
+		}
+	}
+
+	if expires, ok := absoluteCodeExpiry(text, received, loc); ok {
+		return expires
+	}
+	if validity, ok := codeValidity(text); ok {
+		return received.Add(validity)
+	}
+	return time.Time{}
+}
+
+// codeValidity 返回附近有有效期关键词的第一个时长
+func codeValidity(text string) (time.Duration, bool) {
+	for _, m := range codeValidityPattern.FindAllStringSubmatchIndex(text, -1) {
+		// "9月1日"是日期而不是时长
+		if !nearExpiryKeyword(text, m[0], m[1]) || strings.HasSuffix(text[:m[0]], "月") {
+			continue
+		}
+
+		number := strings.ToLower(text[m[2]:m[3]])
+		n, err := strconv.Atoi(number)
+		if err != nil {
+			n = codeValidityNumbers[number]
+		}
+		unit := validityUnit(text[m[4]:m[5]])
+		if n <= 0 || unit == 0 {
+			continue
+		}
+
+		if validity := time.Duration(n) * unit; validity <= maxCodeValidity {
+			return validity, true
+		}
+	}
+	return 0, false
+}
+
+// validityUnit 返回单位对应的时长
+func validityUnit(word string) time.Duration {
+	for _, u := range codeValidityUnits {
+		for _, w := range u.words {
+			if strings.EqualFold(w, word) {
+				return u.unit
+			}
+		}
+	}
+	return 0
+}
+
+// absoluteCodeExpiry 返回附近有有效期关键词的第一个晚于接收时间的时间点；
+// 只有时间没有日期时取接收当天，已经过去则取第二天
+func absoluteCodeExpiry(text string, received time.Time, loc *time.Location) (time.Time, bool) {
+	for _, m := range codeExpiryTimePattern.FindAllStringSubmatchIndex(text, -1) {
+		if !nearExpiryKeyword(text, m[0], m[1]) {
+			continue
+		}
+		group := func(i int) string {
+			if m[2*i] < 0 {
+				return ""
+			}
+			return text[m[2*i]:m[2*i+1]]
+		}
+
+		zone := loc
+		switch z := strings.ToUpper(group(7)); {
+		case z == "UTC" || z == "GMT" || z == "Z":
+			zone = time.UTC
+		case z != "":
+			offset, err := time.Parse("-0700", strings.Replace(z, ":", "", 1))
+			if err != nil {
+				continue
+			}
+			_, seconds := offset.Zone()
+			zone = time.FixedZone(z, seconds)
+		}
+
+		hour, _ := strconv.Atoi(group(4))
+		minute, _ := strconv.Atoi(group(5))
+		second, _ := strconv.Atoi(group(6))
+		if hour > 23 || minute > 59 || second > 59 {
+			continue
+		}
+
+		local := received.In(zone)
+		year, month, day := local.Date()
+		dated := group(1) != ""
+		if dated {
+			year, _ = strconv.Atoi(group(1))
+			mon, _ := strconv.Atoi(group(2))
+			month = time.Month(mon)
+			day, _ = strconv.Atoi(group(3))
+		}
+
+		expires := time.Date(year, month, day, hour, minute, second, 0, zone)
+		if !dated && !expires.After(received) {
+			expires = expires.AddDate(0, 0, 1)
+		}
+		if expires.After(received) && expires.Sub(received) <= maxCodeValidity {
+			return expires, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// nearExpiryKeyword 检查text[start:end]前后同一行内是否有有效期关键词
+func nearExpiryKeyword(text string, start, end int) bool {
+	return codeExpiryKeywordPattern.MatchString(lineBefore(text, start, codeExpiryKeywordDistance)) ||
+		codeExpiryKeywordPattern.MatchString(lineAfter(text, end, codeExpiryKeywordDistance/2))
+}
+
+// embeddedReceivedTime 嵌入邮件（例如转发的邮件）的有效期从其Date头部开始计算，
+// Date无法解析或晚于外层邮件的接收时间时使用接收时间
+func embeddedReceivedTime(date string, received time.Time) time.Time {
+	if sent, err := mail.ParseDate(date); err == nil && !sent.After(received) {
+		return sent
+	}
+	return received
+}
+
+// formatExpiry 将过期时间格式化为RFC3339，nil或零值返回空字符串
+func formatExpiry(expiresAt *time.Time) string {
+	if expiresAt == nil || expiresAt.IsZero() {
+		return ""
+	}
+	return expiresAt.Format(time.RFC3339)
+}
+
+// parseExpiry 解析保存的过期时间，为空或无法解析时返回nil
+func parseExpiry(value string) *time.Time {
+	if value == "" {
+		return nil
+	}
+	expiresAt, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil
+	}
+	return &expiresAt
+}
+
+// expiryPointer 零值返回nil
+func expiryPointer(expiresAt time.Time) *time.Time {
+	if expiresAt.IsZero() {
+		return nil
+	}
+	return &expiresAt
+}
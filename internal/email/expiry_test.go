@@ -0,0 +1,113 @@
+package email
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"mail-temp/internal/repository"
+)
+
+// TestDetectCodeExpiry 识别各语言的时长和带时区的时间点，按接收时间计算过期时间
+func TestDetectCodeExpiry(t *testing.T) {
+	received := time.Date(2025, 9, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		text string
+		want time.Time
+	}{
+		{"英文时长", "Your code is 482913. It expires in 10 minutes.", received.Add(10 * time.Minute)},
+		{"数字单词", "Code 482913 is valid for one hour", received.Add(time.Hour)},
+		{"紧贴单位", "Code 482913, valid 5min", received.Add(5 * time.Minute)},
+		{"中文时长", "您的验证码是482913，5分钟内有效。", received.Add(5 * time.Minute)},
+		{"日文时长", "認証コード：482913（有効期限は30分です）", received.Add(30 * time.Minute)},
+		{"德文时长", "Ihr Code 482913 ist 15 Minuten gültig.", received.Add(15 * time.Minute)},
+		{"UTC时间", "Code 482913 is valid until 14:30 UTC", time.Date(2025, 9, 1, 14, 30, 0, 0, time.UTC)},
+		{"时区偏移", "Code 482913 expires at 21:00 +08:00", time.Date(2025, 9, 1, 13, 0, 0, 0, time.UTC)},
+		{"带日期", "验证码482913，有效期至2025年9月2日 08:00:00 UTC", time.Date(2025, 9, 2, 8, 0, 0, 0, time.UTC)},
+		{"已过去的时间取第二天", "Code 482913 valid until 09:00 UTC", time.Date(2025, 9, 2, 9, 0, 0, 0, time.UTC)},
+		{"时间点优先", "Code 482913 is valid for 10 minutes, until 12:05 UTC", time.Date(2025, 9, 1, 12, 5, 0, 0, time.UTC)},
+		{"没有关键词", "Code 482913. Call us between 9:00 and 17:00, 7 days a week.", time.Time{}},
+		{"日期不是时长", "验证码482913，截止9月1日", time.Time{}},
+		{"超过最长有效期", "Code 482913. Your account is valid for 90 days.", time.Time{}},
+	}
+	for _, tt := range tests {
+		got := DetectCodeExpiry(&MessageContent{Text: tt.text}, "482913", received)
+		if !got.Equal(tt.want) {
+			t.Errorf("%s: 期望%v，实际%v", tt.name, tt.want, got)
+		}
+	}
+}
+
+// TestDetectCodeExpiryWindow 只在验证码附近查找，验证码不在正文中时查找包含它的附件或正文开头
+func TestDetectCodeExpiryWindow(t *testing.T) {
+	received := time.Date(2025, 9, 1, 12, 0, 0, 0, time.UTC)
+	padding := strings.Repeat(" ", codeExpiryWindow+10)
+
+	far := &MessageContent{Text: "Your code is 482913." + padding + "This offer is valid for 2 hours."}
+	if got := DetectCodeExpiry(far, "482913", received); !got.IsZero() {
+		t.Errorf("期望忽略远离验证码的有效期，实际%v", got)
+	}
+
+	attachment := &MessageContent{
+		Text:        "See the attached PDF. The link is valid for 1 day.",
+		Attachments: []AttachmentText{{Text: "Code 482913, valid for 20 minutes"}},
+	}
+	if got := DetectCodeExpiry(attachment, "482913", received); !got.Equal(received.Add(20 * time.Minute)) {
+		t.Errorf("期望使用附件中的有效期，实际%v", got)
+	}
+
+	subjectOnly := &MessageContent{Subject: "482913", Text: "This code expires in 3 minutes."}
+	if got := DetectCodeExpiry(subjectOnly, "482913", received); !got.Equal(received.Add(3 * time.Minute)) {
+		t.Errorf("期望查找正文开头，实际%v", got)
+	}
+
+	if got := DetectCodeExpiry(subjectOnly, "", received); !got.IsZero() {
+		t.Errorf("没有验证码时期望零值，实际%v", got)
+	}
+}
+
+// TestDetectCodeExpiryDateHeader 没有时区的时间按Date头部的时区解释
+func TestDetectCodeExpiryDateHeader(t *testing.T) {
+	received := time.Date(2025, 9, 1, 12, 0, 0, 0, time.UTC)
+	content := &MessageContent{
+		Headers: []repository.Header{{Name: "Date", Value: "Mon, 1 Sep 2025 20:00:00 +0800"}},
+		Text:    "验证码482913，请在21:00之前使用",
+	}
+	if got, want := DetectCodeExpiry(content, "482913", received), time.Date(2025, 9, 1, 13, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("期望%v，实际%v", want, got)
+	}
+}
+
+// TestEmbeddedReceivedTime 嵌入邮件使用不晚于接收时间的Date头部
+func TestEmbeddedReceivedTime(t *testing.T) {
+	received := time.Date(2025, 9, 1, 12, 0, 0, 0, time.UTC)
+	sent := time.Date(2025, 9, 1, 11, 50, 0, 0, time.UTC)
+	for date, want := range map[string]time.Time{
+		"Mon, 1 Sep 2025 11:50:00 +0000": sent,
+		"Mon, 1 Sep 2025 12:10:00 +0000": received,
+		"not a date":                     received,
+		"":                               received,
+	} {
+		if got := embeddedReceivedTime(date, received); !got.Equal(want) {
+			t.Errorf("%q: 期望%v，实际%v", date, want, got)
+		}
+	}
+}
+
+// TestExpiryFormatting 零值和nil格式化为空字符串，空字符串和无效值解析为nil
+func TestExpiryFormatting(t *testing.T) {
+	expires := time.Date(2025, 9, 1, 12, 10, 0, 0, time.UTC)
+	if got := formatExpiry(&expires); got != "2025-09-01T12:10:00Z" {
+		t.Errorf("期望RFC3339格式，实际%q", got)
+	}
+	if got := parseExpiry(formatExpiry(&expires)); got == nil || !got.Equal(expires) {
+		t.Errorf("期望解析回%v，实际%v", expires, got)
+	}
+	if formatExpiry(nil) != "" || formatExpiry(expiryPointer(time.Time{})) != "" {
+		t.Error("期望nil和零值格式化为空字符串")
+	}
+	if parseExpiry("") != nil || parseExpiry("tomorrow") != nil {
+		t.Error("期望空字符串和无效值解析为nil")
+	}
+}
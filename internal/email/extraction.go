@@ -0,0 +1,164 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"mail-temp/internal/llm"
+	"mail-temp/internal/repository"
+)
+
+// 验证码提取状态
+const (
+	ExtractionPending = "pending" // 已保存启发式结果，等待后台AI提取
+	ExtractionDone    = "done"    // 提取完成
+	ExtractionFailed  = "failed"  // 后台提取失败（例如模型服务不可用），保留启发式结果
+	ExtractionSkipped = "skipped" // 后台队列已满，未运行AI提取
+)
+
+// extractionJob 后台验证码提取任务
+type extractionJob struct {
+	username string
+	id       string
+	content  *MessageContent
+}
+
+// extractionPool 运行延迟提取器（例如AI）的后台任务池，任务数和并发数都有上限
+type extractionPool struct {
+	chain   *CodeExtractorChain
+	storage repository.EmailStorage
+	events  *EventBus
+	jobs    chan extractionJob
+	ctx     context.Context
+	cancel  context.CancelFunc
+}
+
+// newExtractionPool 创建并启动后台任务池
+func newExtractionPool(chain *CodeExtractorChain, storage repository.EmailStorage, events *EventBus, workers, queueSize int) *extractionPool {
+	if workers <= 0 {
+		workers = 1
+	}
+	if queueSize <= 0 {
+		queueSize = 1
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	pool := &extractionPool{
+		chain:   chain,
+		storage: storage,
+		events:  events,
+		jobs:    make(chan extractionJob, queueSize),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+	for i := 0; i < workers; i++ {
+		go pool.work()
+	}
+	return pool
+}
+
+// QueueStats 后台队列统计
+type QueueStats struct {
+	Pending  int `json:"pending"`
+	Capacity int `json:"capacity"`
+}
+
+// Stats 返回后台队列中等待的任务数和容量
+func (p *extractionPool) Stats() QueueStats {
+	return QueueStats{Pending: len(p.jobs), Capacity: cap(p.jobs)}
+}
+
+// Enqueue 提交任务，队列已满时返回false
+func (p *extractionPool) Enqueue(job extractionJob) bool {
+	select {
+	case p.jobs <- job:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close 取消正在进行的模型调用，未处理的任务保持pending状态
+func (p *extractionPool) Close() {
+	p.cancel()
+}
+
+// work 依次处理队列中的任务
+func (p *extractionPool) work() {
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case job := <-p.jobs:
+			p.run(job)
+		}
+	}
+}
+
+// run 运行延迟提取器并更新已保存的邮件
+func (p *extractionPool) run(job extractionJob) {
+	message, err := p.storage.GetEmailByID(job.id)
+	if err != nil {
+		log.Printf("后台提取验证码时获取邮件失败: %v", err)
+		return
+	}
+	if message == nil {
+		// 邮箱在提取前已被删除
+		return
+	}
+
+	candidates, err := p.chain.ExtractDeferred(p.ctx, job.content, message.CodeCandidates)
+	if p.ctx.Err() != nil {
+		return
+	}
+	status := ExtractionDone
+	if err != nil {
+		// 熔断期间不重复记录错误，状态变化由熔断器记录
+		if !errors.Is(err, llm.ErrCircuitOpen) {
+			log.Printf("后台提取验证码失败: %v", err)
+		}
+		status = ExtractionFailed
+	}
+	logCodeCandidates(candidates)
+	p.finish(job, candidates, status)
+}
+
+// finish 保存提取结果和状态，并发布更新事件
+func (p *extractionPool) finish(job extractionJob, candidates []repository.CodeCandidate, status string) {
+	// 重新读取邮件，只修改验证码相关的字段
+	message, err := p.storage.GetEmailByID(job.id)
+	if err != nil || message == nil {
+		return
+	}
+	updated := *message
+	updated.ExtractionStatus = status
+	if candidates != nil {
+		updated.CodeCandidates = candidates
+		if chosen, ok := chooseCode(candidates); ok {
+			if chosen.Code != message.Code {
+				// 验证码变化时按新验证码附近的内容重新计算有效期和PDF文本片段
+				received := fromEmailMessage(message).Timestamp
+				updated.CodeExpiresAt = formatExpiry(expiryPointer(DetectCodeExpiry(job.content, chosen.Display, received)))
+				updated.PDFTexts = pdfSnippets(job.content.Attachments, chosen.Display)
+			}
+			updated.Code, updated.CodeDisplay = chosen.Code, chosen.Display
+		}
+	}
+
+	if err := p.storage.UpdateEmail(job.username, &updated); err != nil {
+		if !errors.Is(err, repository.ErrMessageNotFound) {
+			log.Printf("更新邮件失败: %v", err)
+		}
+		return
+	}
+	if updated.Code != message.Code {
+		log.Printf("后台提取到验证码: %s", updated.Code)
+	}
+
+	p.events.Publish(job.username, MailEvent{
+		Type:    EventUpdate,
+		Email:   updated.To,
+		Message: fromEmailMessage(&updated),
+	})
+}
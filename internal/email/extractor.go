@@ -0,0 +1,419 @@
+package email
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"mail-temp/internal/llm"
+	"mail-temp/internal/repository"
+)
+
+// 验证码候选的来源
+const (
+	SourceSubject    = "subject"
+	SourceText       = "text"
+	SourceHTML       = "html"
+	SourceAttachment = "attachment"
+	SourceImage      = "image" // 图片中的二维码、条形码
+)
+
+const (
+	// 最可信的候选达到该得分时跳过链中后续的提取器（例如AI）
+	codeChainStopScore = 0.7
+	// 同一验证码被多个来源或提取器找到时的加分
+	codeAgreementBonus = 0.1
+	// 得分上限
+	maxCodeScore = 1.0
+)
+
+// DefaultCodeExtractors 默认的提取器链
+var DefaultCodeExtractors = []string{"regex", "html", "ai"}
+
+// MessageContent 提供给验证码提取器的邮件内容
+type MessageContent struct {
+	From        string
+	Headers     []repository.Header
+	Language    string // 邮件语言，为空时由提取器链自动检测
+	Subject     string
+	Text        string
+	HTML        string
+	Attachments []AttachmentText
+	Images      []repository.ImageCode // 图片中解码出的二维码、条形码
+}
+
+// AttachmentText 附件中的文本内容
+type AttachmentText struct {
+	Filename    string
+	ContentType string // text/plain、text/html或application/pdf
+	Pages       int    // PDF附件解析的页数
+	Text        string
+}
+
+// CodeExtractor 验证码提取器，返回带得分和来源的候选
+type CodeExtractor interface {
+	Name() string
+	Extract(ctx context.Context, content *MessageContent) []repository.CodeCandidate
+}
+
+// DeferredExtractor 耗时较长的提取器（例如AI），不在接收邮件时运行，
+// 而是在邮件保存后由后台任务调用ExtractDeferred
+type DeferredExtractor interface {
+	CodeExtractor
+	ExtractDeferred(ctx context.Context, content *MessageContent) ([]repository.CodeCandidate, error)
+}
+
+// CodeExtractorChain 按顺序运行多个提取器并合并结果
+type CodeExtractorChain struct {
+	extractors []CodeExtractor
+}
+
+// ExtractorOptions 创建提取器链所需的依赖
+type ExtractorOptions struct {
+	Codes  *CodeFinder
+	LLM    llm.Provider // ai提取器使用的模型服务
+	Prompt string       // ai提取器的提示词模板，为空时使用默认模板
+}
+
+// NewCodeExtractorChain 按名称创建提取器链，支持regex、html和ai
+func NewCodeExtractorChain(names []string, opts ExtractorOptions) (*CodeExtractorChain, error) {
+	if len(names) == 0 {
+		names = DefaultCodeExtractors
+	}
+	codes := opts.Codes
+	if codes == nil {
+		codes = NewCodeFinder(0, 0)
+	}
+
+	chain := &CodeExtractorChain{}
+	for _, name := range names {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "regex":
+			chain.extractors = append(chain.extractors, &regexCodeExtractor{codes: codes})
+		case "html":
+			chain.extractors = append(chain.extractors, &htmlCodeExtractor{codes: codes})
+		case "ai":
+			if opts.LLM == nil {
+				log.Printf("未配置模型服务地址，跳过AI验证码提取")
+				continue
+			}
+			extractor, err := newAICodeExtractor(opts.LLM, opts.Prompt, codes)
+			if err != nil {
+				return nil, err
+			}
+			chain.extractors = append(chain.extractors, extractor)
+		case "":
+		default:
+			return nil, fmt.Errorf("未知的验证码提取器: %s", name)
+		}
+	}
+	return chain, nil
+}
+
+// Prepend 将提取器放在链的最前面，例如按发件人配置的规则
+func (c *CodeExtractorChain) Prepend(extractor CodeExtractor) {
+	c.extractors = append([]CodeExtractor{extractor}, c.extractors...)
+}
+
+// Name 实现CodeExtractor接口
+func (c *CodeExtractorChain) Name() string {
+	names := make([]string, 0, len(c.extractors))
+	for _, extractor := range c.extractors {
+		names = append(names, extractor.Name())
+	}
+	return strings.Join(names, ",")
+}
+
+// Extract 实现CodeExtractor接口，只运行非延迟的提取器，返回按得分从高到低排序的候选
+func (c *CodeExtractorChain) Extract(ctx context.Context, content *MessageContent) []repository.CodeCandidate {
+	if content.Language == "" {
+		content.Language = DetectLanguage(content)
+	}
+
+	var candidates []repository.CodeCandidate
+	for _, extractor := range c.extractors {
+		if isConfident(candidates) {
+			break
+		}
+		if _, ok := extractor.(DeferredExtractor); ok {
+			continue
+		}
+		candidates = mergeCodeCandidates(candidates, extractor.Extract(ctx, content))
+	}
+	return candidates
+}
+
+// NeedsDeferred 检查是否需要在后台运行延迟的提取器：链中有延迟的提取器，且现有候选不够可信
+func (c *CodeExtractorChain) NeedsDeferred(candidates []repository.CodeCandidate) bool {
+	if isConfident(candidates) {
+		return false
+	}
+	for _, extractor := range c.extractors {
+		if _, ok := extractor.(DeferredExtractor); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ExtractDeferred 运行延迟的提取器并与Extract的结果合并，返回第一个错误
+func (c *CodeExtractorChain) ExtractDeferred(ctx context.Context, content *MessageContent, candidates []repository.CodeCandidate) ([]repository.CodeCandidate, error) {
+	if content.Language == "" {
+		content.Language = DetectLanguage(content)
+	}
+
+	var firstErr error
+	for _, extractor := range c.extractors {
+		if isConfident(candidates) {
+			break
+		}
+		deferred, ok := extractor.(DeferredExtractor)
+		if !ok {
+			continue
+		}
+		found, err := deferred.ExtractDeferred(ctx, content)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		candidates = mergeCodeCandidates(candidates, found)
+	}
+	return candidates, firstErr
+}
+
+// isConfident 检查最可信的候选是否达到跳过后续提取器的得分
+func isConfident(candidates []repository.CodeCandidate) bool {
+	return len(candidates) > 0 && candidates[0].Score >= codeChainStopScore
+}
+
+// mergeCodeCandidates 按验证码合并候选：保留得分最高的一个，多处一致时加分
+func mergeCodeCandidates(existing, found []repository.CodeCandidate) []repository.CodeCandidate {
+	merged := make([]repository.CodeCandidate, len(existing))
+	copy(merged, existing)
+
+	for _, candidate := range found {
+		index := -1
+		for i := range merged {
+			if strings.EqualFold(merged[i].Code, candidate.Code) {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			merged = append(merged, candidate)
+			continue
+		}
+
+		current := &merged[index]
+		agreed := current.Source != candidate.Source || current.Extractor != candidate.Extractor
+		if candidate.Score > current.Score {
+			*current = candidate
+		}
+		if agreed {
+			current.Score = minScore(current.Score + codeAgreementBonus)
+		}
+	}
+
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].Score > merged[j].Score
+	})
+	return merged
+}
+
+// chooseCode 返回得分最高的候选
+func chooseCode(candidates []repository.CodeCandidate) (repository.CodeCandidate, bool) {
+	if len(candidates) == 0 {
+		return repository.CodeCandidate{}, false
+	}
+	return candidates[0], true
+}
+
+// minScore 将得分限制在上限以内
+func minScore(score float64) float64 {
+	if score > maxCodeScore {
+		return maxCodeScore
+	}
+	return score
+}
+
+// regexCodeExtractor 基于格式规则和标签的启发式提取器
+type regexCodeExtractor struct {
+	codes *CodeFinder
+}
+
+// Name 实现CodeExtractor接口
+func (e *regexCodeExtractor) Name() string {
+	return "regex"
+}
+
+// Extract 实现CodeExtractor接口，依次检查主题、正文和文本附件
+func (e *regexCodeExtractor) Extract(ctx context.Context, content *MessageContent) []repository.CodeCandidate {
+	var candidates []repository.CodeCandidate
+	candidates = append(candidates, e.extractFrom(content.Subject, content.Language, SourceSubject)...)
+	candidates = append(candidates, e.extractFrom(content.Text, content.Language, SourceText)...)
+	for _, attachment := range content.Attachments {
+		candidates = append(candidates, e.extractFrom(attachment.Text, content.Language, SourceAttachment)...)
+	}
+	for _, image := range content.Images {
+		if image.Kind == ImageCodeText {
+			candidates = append(candidates, e.extractFromImage(image.Payload, content.Language)...)
+		}
+	}
+	return mergeCodeCandidates(nil, candidates)
+}
+
+// extractFromImage 从图片中解码出的文本提取候选：整个二维码只包含一个验证码时可信度较高
+func (e *regexCodeExtractor) extractFromImage(payload, lang string) []repository.CodeCandidate {
+	if matches := e.codes.FindAll(payload); len(matches) == 1 && matches[0].Display == payload {
+		return []repository.CodeCandidate{{
+			Code:      matches[0].Code,
+			Display:   matches[0].Display,
+			Source:    SourceImage,
+			Extractor: e.Name(),
+			Score:     0.65,
+		}}
+	}
+	return e.extractFrom(payload, lang, SourceImage)
+}
+
+// extractFrom 从一段文本中提取候选并打分，使用邮件语言的关键词识别标签
+func (e *regexCodeExtractor) extractFrom(text, lang, source string) []repository.CodeCandidate {
+	matches := e.codes.FindAllLanguage(text, lang)
+	candidates := make([]repository.CodeCandidate, 0, len(matches))
+	for i, match := range matches {
+		score := 0.3
+		if match.Labeled {
+			score += 0.4
+		}
+		if i == 0 {
+			score += 0.05 // 第一个候选更可能是验证码
+		}
+		switch source {
+		case SourceSubject:
+			score += 0.1
+		case SourceAttachment, SourceImage:
+			score -= 0.1
+		}
+		candidates = append(candidates, repository.CodeCandidate{
+			Code:      match.Code,
+			Display:   match.Display,
+			Source:    source,
+			Extractor: e.Name(),
+			Score:     minScore(score),
+		})
+	}
+	return candidates
+}
+
+// htmlCodeExtractor 查找HTML中被突出显示的验证码（加粗、标题、大号字体或加宽字距）
+type htmlCodeExtractor struct {
+	codes *CodeFinder
+}
+
+// Name 实现CodeExtractor接口
+func (e *htmlCodeExtractor) Name() string {
+	return "html"
+}
+
+// 表示突出显示的元素
+var emphasisElements = map[atom.Atom]bool{
+	atom.B:      true,
+	atom.Strong: true,
+	atom.H1:     true,
+	atom.H2:     true,
+	atom.H3:     true,
+	atom.H4:     true,
+	atom.Code:   true,
+	atom.Kbd:    true,
+	atom.Tt:     true,
+}
+
+// 20px及以上或1.5em及以上的字号
+var largeFontPattern = regexp.MustCompile(`font-size\s*:\s*(?:(?:[2-9]\d|\d{3,})(?:\.\d+)?px|(?:[2-9]|1\.[5-9])(?:\.\d+)?(?:em|rem))`)
+
+// Extract 实现CodeExtractor接口
+func (e *htmlCodeExtractor) Extract(ctx context.Context, content *MessageContent) []repository.CodeCandidate {
+	if strings.TrimSpace(content.HTML) == "" {
+		return nil
+	}
+	doc, err := html.Parse(strings.NewReader(content.HTML))
+	if err != nil {
+		return nil
+	}
+
+	var candidates []repository.CodeCandidate
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			if isHiddenElement(n) {
+				return
+			}
+			if candidate, ok := e.emphasized(n); ok {
+				candidates = append(candidates, candidate)
+				return
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	return mergeCodeCandidates(nil, candidates)
+}
+
+// emphasized 检查元素是否是单独突出显示的验证码
+func (e *htmlCodeExtractor) emphasized(n *html.Node) (repository.CodeCandidate, bool) {
+	style := strings.ToLower(getAttr(n, "style"))
+	emphasis := emphasisElements[n.DataAtom] ||
+		strings.Contains(style, "letter-spacing") ||
+		strings.Contains(style, "font-weight:bold") || strings.Contains(style, "font-weight: bold") ||
+		largeFontPattern.MatchString(style)
+	if !emphasis {
+		return repository.CodeCandidate{}, false
+	}
+
+	text := nodeText(n)
+	matches := e.codes.FindAll(text)
+	if len(matches) != 1 || matches[0].Display != text {
+		return repository.CodeCandidate{}, false
+	}
+	return repository.CodeCandidate{
+		Code:      matches[0].Code,
+		Display:   matches[0].Display,
+		Source:    SourceHTML,
+		Extractor: e.Name(),
+		Score:     0.6,
+	}, true
+}
+
+// attachmentTexts 提取文本类附件和PDF附件的内容
+func attachmentTexts(parts []parsedPart) []AttachmentText {
+	var texts []AttachmentText
+	for _, part := range parts {
+		if !strings.HasPrefix(part.ContentType, "text/") || !utf8.Valid(part.Data) {
+			continue
+		}
+		text := string(part.Data)
+		if part.ContentType == "text/html" {
+			text = htmlToText(text)
+		}
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		texts = append(texts, AttachmentText{Filename: part.Filename, ContentType: part.ContentType, Text: text})
+	}
+	return append(texts, pdfAttachmentTexts(parts)...)
+}
+
+// logCodeCandidates 记录提取到的候选
+func logCodeCandidates(candidates []repository.CodeCandidate) {
+	for _, candidate := range candidates {
+		log.Printf("验证码候选: %s (来源: %s, 提取器: %s, 得分: %.2f)", candidate.Code, candidate.Source, candidate.Extractor, candidate.Score)
+	}
+}
@@ -0,0 +1,213 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"math"
+	"os"
+	"testing"
+
+	"mail-temp/internal/repository"
+)
+
+// staticExtractor 返回固定候选的提取器，记录调用次数
+type staticExtractor struct {
+	name       string
+	candidates []repository.CodeCandidate
+	calls      int
+}
+
+// Name 实现CodeExtractor接口
+func (e *staticExtractor) Name() string {
+	return e.name
+}
+
+// Extract 实现CodeExtractor接口
+func (e *staticExtractor) Extract(ctx context.Context, content *MessageContent) []repository.CodeCandidate {
+	e.calls++
+	return e.candidates
+}
+
+// deferredStaticExtractor 返回固定候选和错误的延迟提取器
+type deferredStaticExtractor struct {
+	staticExtractor
+	err error
+}
+
+// ExtractDeferred 实现DeferredExtractor接口
+func (e *deferredStaticExtractor) ExtractDeferred(ctx context.Context, content *MessageContent) ([]repository.CodeCandidate, error) {
+	e.calls++
+	return e.candidates, e.err
+}
+
+// nearlyEqual 比较得分
+func nearlyEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+// TestMergeCodeCandidates 同一验证码只保留得分最高的一个；来源或提取器不同时加分，不超过上限
+func TestMergeCodeCandidates(t *testing.T) {
+	existing := []repository.CodeCandidate{
+		{Code: "482913", Source: SourceText, Extractor: "regex", Score: 0.5},
+		{Code: "AB12", Source: SourceText, Extractor: "regex", Score: 0.3},
+	}
+	found := []repository.CodeCandidate{
+		{Code: "482913", Source: SourceHTML, Extractor: "html", Score: 0.6},
+		{Code: "ab12", Source: SourceText, Extractor: "regex", Score: 0.2},
+		{Code: "7788", Source: SourceSubject, Extractor: "regex", Score: 0.95},
+	}
+	merged := mergeCodeCandidates(existing, found)
+
+	if len(merged) != 3 {
+		t.Fatalf("期望3个候选，实际 %+v", merged)
+	}
+	if merged[0].Code != "7788" || merged[1].Code != "482913" || merged[2].Code != "AB12" {
+		t.Errorf("期望按得分排序，实际 %+v", merged)
+	}
+	if merged[1].Source != SourceHTML || !nearlyEqual(merged[1].Score, 0.7) {
+		t.Errorf("期望保留html候选并加分为0.7，实际 %+v", merged[1])
+	}
+	if !nearlyEqual(merged[2].Score, 0.3) {
+		t.Errorf("相同来源和提取器不加分，实际 %+v", merged[2])
+	}
+	if existing[0].Score != 0.5 {
+		t.Error("期望不修改原有的候选列表")
+	}
+
+	capped := mergeCodeCandidates([]repository.CodeCandidate{{Code: "1111", Source: SourceText, Score: 0.95}},
+		[]repository.CodeCandidate{{Code: "1111", Source: SourceHTML, Score: 0.9}})
+	if capped[0].Score != maxCodeScore {
+		t.Errorf("期望得分不超过%.1f，实际%.2f", maxCodeScore, capped[0].Score)
+	}
+}
+
+// TestCodeExtractorChain 候选足够可信时跳过后续提取器，延迟提取器只在ExtractDeferred中运行
+func TestCodeExtractorChain(t *testing.T) {
+	weak := &staticExtractor{name: "weak", candidates: []repository.CodeCandidate{{Code: "1111", Source: SourceText, Score: 0.4}}}
+	strong := &staticExtractor{name: "strong", candidates: []repository.CodeCandidate{{Code: "2222", Source: SourceHTML, Score: 0.8}}}
+	later := &staticExtractor{name: "later", candidates: []repository.CodeCandidate{{Code: "3333", Score: 0.9}}}
+	deferred := &deferredStaticExtractor{staticExtractor: staticExtractor{name: "ai", candidates: []repository.CodeCandidate{{Code: "4444", Score: 0.9}}}}
+
+	chain := &CodeExtractorChain{extractors: []CodeExtractor{weak, deferred, strong, later}}
+	candidates := chain.Extract(context.Background(), &MessageContent{Text: "hello"})
+	if len(candidates) != 2 || candidates[0].Code != "2222" {
+		t.Errorf("期望[2222 1111]，实际 %+v", candidates)
+	}
+	if deferred.calls != 0 || later.calls != 0 {
+		t.Errorf("期望跳过延迟提取器和可信候选之后的提取器，实际调用%d、%d次", deferred.calls, later.calls)
+	}
+	if chain.NeedsDeferred(candidates) {
+		t.Error("候选可信时不需要延迟提取")
+	}
+	if name := chain.Name(); name != "weak,ai,strong,later" {
+		t.Errorf("期望链名称weak,ai,strong,later，实际%s", name)
+	}
+}
+
+// TestCodeExtractorChainDeferred 候选不够可信时运行延迟提取器并合并结果，返回第一个错误
+func TestCodeExtractorChainDeferred(t *testing.T) {
+	weak := &staticExtractor{name: "weak", candidates: []repository.CodeCandidate{{Code: "1111", Source: SourceText, Score: 0.4}}}
+	failed := &deferredStaticExtractor{staticExtractor: staticExtractor{name: "ai1"}, err: errors.New("超时")}
+	ai := &deferredStaticExtractor{staticExtractor: staticExtractor{name: "ai2", candidates: []repository.CodeCandidate{{Code: "1111", Source: SourceText, Extractor: "ai2", Score: 0.8}}}}
+	chain := &CodeExtractorChain{extractors: []CodeExtractor{weak, failed, ai}}
+
+	content := &MessageContent{Text: "hello"}
+	candidates := chain.Extract(context.Background(), content)
+	if !chain.NeedsDeferred(candidates) {
+		t.Fatal("候选不可信时期望需要延迟提取")
+	}
+	candidates, err := chain.ExtractDeferred(context.Background(), content, candidates)
+	if err == nil || err.Error() != "超时" {
+		t.Errorf("期望返回第一个错误，实际 %v", err)
+	}
+	if len(candidates) != 1 || candidates[0].Extractor != "ai2" || !nearlyEqual(candidates[0].Score, 0.9) {
+		t.Errorf("期望合并为ai2的候选并加分，实际 %+v", candidates)
+	}
+
+	noDeferred := &CodeExtractorChain{extractors: []CodeExtractor{weak}}
+	if noDeferred.NeedsDeferred(nil) {
+		t.Error("没有延迟提取器时不需要延迟提取")
+	}
+}
+
+// TestNewCodeExtractorChain 未配置模型服务时跳过ai，未知名称返回错误
+func TestNewCodeExtractorChain(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	chain, err := NewCodeExtractorChain([]string{" Regex ", "", "html", "ai"}, ExtractorOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := chain.Name(); name != "regex,html" {
+		t.Errorf("期望regex,html，实际%s", name)
+	}
+	if _, err := NewCodeExtractorChain([]string{"regex", "ocr"}, ExtractorOptions{}); err == nil {
+		t.Error("期望未知的提取器返回错误")
+	}
+	chain.Prepend(&staticExtractor{name: "rules"})
+	if name := chain.Name(); name != "rules,regex,html" {
+		t.Errorf("期望规则在最前，实际%s", name)
+	}
+}
+
+// TestRegexCodeExtractorScores 带标签、第一个候选和主题中的候选得分更高，附件中的更低
+func TestRegexCodeExtractorScores(t *testing.T) {
+	e := &regexCodeExtractor{codes: NewCodeFinder(4, 8)}
+	candidates := e.Extract(context.Background(), &MessageContent{
+		Subject:     "Your code is 482913",
+		Text:        "Ticket 5521. Your code is 482913",
+		Attachments: []AttachmentText{{Text: "Reference 7788"}},
+	})
+
+	scores := make(map[string]repository.CodeCandidate)
+	for _, candidate := range candidates {
+		scores[candidate.Code] = candidate
+	}
+	// 主题：0.3 + 标签0.4 + 第一个0.05 + 主题0.1；正文中同一验证码来源不同，再加0.1
+	if c := scores["482913"]; c.Source != SourceSubject || !nearlyEqual(c.Score, 0.95) {
+		t.Errorf("482913得分不正确: %+v", c)
+	}
+	if c := scores["5521"]; c.Source != SourceText || !nearlyEqual(c.Score, 0.35) {
+		t.Errorf("5521得分不正确: %+v", c)
+	}
+	if _, ok := scores["7788"]; ok {
+		t.Errorf("期望排除附件中的参考编号，实际 %+v", candidates)
+	}
+	if candidates[0].Code != "482913" {
+		t.Errorf("期望得分最高的在前，实际 %+v", candidates)
+	}
+}
+
+// TestHTMLCodeExtractor 只接受单独突出显示的验证码，忽略隐藏元素和包含其他文字的元素
+func TestHTMLCodeExtractor(t *testing.T) {
+	e := &htmlCodeExtractor{codes: NewCodeFinder(4, 8)}
+	tests := []struct {
+		name string
+		html string
+		want string
+	}{
+		{"加粗", `<p>Use <strong>482913</strong> to continue</p>`, "482913"},
+		{"字距", `<div style="letter-spacing: 6px">K7Q2M9</div>`, "K7Q2M9"},
+		{"大号字体", `<span style="font-size:28px">123 456</span>`, "123456"},
+		{"粗体样式", `<table><tr><td style="font-weight:bold">7788</td></tr></table>`, "7788"},
+		{"小号字体", `<span style="font-size:12px">482913</span>`, ""},
+		{"包含其他文字", `<b>Code 482913</b>`, ""},
+		{"隐藏元素", `<div style="display:none"><b>482913</b></div>`, ""},
+	}
+	for _, tt := range tests {
+		candidates := e.Extract(context.Background(), &MessageContent{HTML: tt.html})
+		got := ""
+		if len(candidates) > 0 {
+			got = candidates[0].Code
+			if candidates[0].Source != SourceHTML || candidates[0].Score != 0.6 {
+				t.Errorf("%s: 候选不正确: %+v", tt.name, candidates[0])
+			}
+		}
+		if got != tt.want {
+			t.Errorf("%s: 期望%q，实际%q", tt.name, tt.want, got)
+		}
+	}
+}
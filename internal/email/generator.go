@@ -3,49 +3,363 @@ package email
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
+	"sort"
+	"strings"
+	"time"
 
 	"mail-temp/internal/repository"
 )
 
+const (
+	// RFC 5321规定的本地部分最大长度
+	maxUsernameLength = 64
+	// 指定的用户名已被使用时，最多尝试多少个后缀
+	usernameSuffixAttempts = 5
+	// 后缀的随机字符数
+	usernameSuffixLength = 4
+	// 随机生成的用户名已被使用时，最多重新生成的次数
+	usernameGenerateAttempts = 5
+)
+
+var (
+	// ErrInvalidUsername 用户名不符合RFC 5321本地部分的规则
+	ErrInvalidUsername = errors.New("无效的用户名")
+	// ErrReservedUsername 用户名是保留名称
+	ErrReservedUsername = errors.New("用户名是保留名称")
+	// ErrUsernameTaken 用户名已被使用
+	ErrUsernameTaken = errors.New("用户名已被使用")
+	// ErrUsernameExhausted 多次随机生成的用户名都已被使用
+	ErrUsernameExhausted = errors.New("无法生成未被使用的用户名")
+	// ErrRandomUnavailable 系统随机数生成器不可用，无法生成不可预测的用户名
+	ErrRandomUnavailable = errors.New("生成随机数失败")
+	// ErrInvalidTTL 邮箱有效期超出配置的范围
+	ErrInvalidTTL = errors.New("无效的有效期")
+	// ErrMailboxNotFound 邮箱不存在或已过期
+	ErrMailboxNotFound = errors.New("邮箱不存在或已过期")
+)
+
+// reservedUsernames 不允许创建的用户名（RFC 2142中的角色邮箱和常见的管理地址），不区分大小写
+var reservedUsernames = map[string]bool{
+	"postmaster": true, "abuse": true, "admin": true, "administrator": true, "hostmaster": true,
+	"webmaster": true, "root": true, "security": true, "mailer-daemon": true, "noc": true,
+	"info": true, "support": true, "noreply": true, "no-reply": true,
+}
+
+// usernameSpecials RFC 5321中atext允许的特殊字符，不含"/"、"?"、"#"和"%"：
+// 它们在API路径中分别会被当作路径分隔符、查询串、片段和转义序列，未转义时无法访问邮箱
+const usernameSpecials = "!$&'*+=^_`{|}~-"
+
+// MailboxTTLOptions 邮箱有效期配置
+type MailboxTTLOptions struct {
+	Default time.Duration // 创建时没有指定有效期时使用
+	Min     time.Duration // 允许的最短有效期
+	Max     time.Duration // 允许的最长有效期
+}
+
+// Mailbox 临时邮箱及其过期时间
+type Mailbox struct {
+	Address   string    `json:"email"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	Token     string    `json:"token,omitempty"` // 访问令牌，只在创建时返回
+}
+
 // EmailGenerator 临时邮箱生成器
 type EmailGenerator struct {
-	domain  string
-	storage repository.EmailStorage
+	domain     string
+	storage    repository.EmailStorage
+	strategies map[string]UsernameStrategy // 按名称索引的用户名生成策略
+	strategy   UsernameStrategy            // 默认策略
+	ttl        MailboxTTLOptions
 }
 
-// NewEmailGenerator 创建新的邮箱生成器
-func NewEmailGenerator(domain string, storage repository.EmailStorage) *EmailGenerator {
-	return &EmailGenerator{
-		domain:  domain,
-		storage: storage,
+// NewEmailGenerator 创建新的邮箱生成器，opts.Strategy为默认的用户名生成策略
+func NewEmailGenerator(domain string, storage repository.EmailStorage, opts UsernameOptions, ttl MailboxTTLOptions) (*EmailGenerator, error) {
+	if ttl.Min <= 0 || ttl.Min > ttl.Default || ttl.Default > ttl.Max {
+		return nil, fmt.Errorf("%w: 必须满足0 < 最短有效期(%s) <= 默认有效期(%s) <= 最长有效期(%s)",
+			ErrInvalidTTL, formatTTL(ttl.Min), formatTTL(ttl.Default), formatTTL(ttl.Max))
+	}
+
+	g := &EmailGenerator{
+		domain:     domain,
+		storage:    storage,
+		strategies: make(map[string]UsernameStrategy),
+		ttl:        ttl,
+	}
+	for _, name := range UsernameStrategies() {
+		strategy, err := NewUsernameStrategy(name, opts)
+		if err != nil {
+			return nil, err
+		}
+		g.strategies[name] = strategy
 	}
+
+	strategy, err := g.usernameStrategy(opts.Strategy)
+	if err != nil {
+		return nil, err
+	}
+	g.strategy = strategy
+	g.warnLegacyMailboxes()
+	return g, nil
+}
+
+// usernameStrategy 返回指定名称的策略，名称为空时返回默认策略
+func (g *EmailGenerator) usernameStrategy(name string) (UsernameStrategy, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		if g.strategy != nil {
+			return g.strategy, nil
+		}
+		name = UsernameHex
+	}
+	strategy, ok := g.strategies[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s（支持%s）", ErrUnknownUsernameStrategy, name, strings.Join(UsernameStrategies(), "、"))
+	}
+	return strategy, nil
 }
 
-// GenerateEmail 生成一个随机临时邮箱地址
-func (g *EmailGenerator) GenerateEmail() string {
-	username := generateRandomString(10)
-	email := fmt.Sprintf("%s@%s", username, g.domain)
+// mailboxTTL 检查有效期是否在配置的范围内，为0时返回默认有效期
+func (g *EmailGenerator) mailboxTTL(ttl time.Duration) (time.Duration, error) {
+	if ttl == 0 {
+		return g.ttl.Default, nil
+	}
+	if ttl < g.ttl.Min || ttl > g.ttl.Max {
+		return 0, fmt.Errorf("%w: 必须在%s到%s之间", ErrInvalidTTL, formatTTL(g.ttl.Min), formatTTL(g.ttl.Max))
+	}
+	return ttl, nil
+}
+
+// formatTTL 格式化有效期，去掉末尾为0的单位，例如168h0m0s显示为168h
+func formatTTL(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = s[:len(s)-2]
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = s[:len(s)-2]
+	}
+	return s
+}
 
-	err := g.storage.AddActiveEmail(username)
+// GenerateEmail 使用指定的策略生成一个未被使用的随机临时邮箱，ttl后过期，并签发访问令牌；
+// strategy为空时使用默认策略，ttl为0时使用默认有效期
+func (g *EmailGenerator) GenerateEmail(strategy string, ttl time.Duration) (*Mailbox, error) {
+	s, err := g.usernameStrategy(strategy)
 	if err != nil {
-		log.Printf("添加活跃邮箱失败: %v", err)
+		return nil, err
+	}
+	ttl, err = g.mailboxTTL(ttl)
+	if err != nil {
+		return nil, err
+	}
+	token, tokenHash, err := newAccessToken()
+	if err != nil {
+		return nil, err
 	}
 
-	return email
+	for attempt := 0; attempt < usernameGenerateAttempts; attempt++ {
+		username, err := s.Generate()
+		if err != nil {
+			return nil, err
+		}
+		if reservedUsernames[username] {
+			continue
+		}
+		created, err := g.storage.CreateActiveEmail(username, ttl, tokenHash)
+		if err != nil {
+			return nil, fmt.Errorf("添加活跃邮箱失败: %w", err)
+		}
+		if !created {
+			log.Printf("随机生成的用户名已被使用，重新生成: %s", username)
+			continue
+		}
+		mailbox := g.mailbox(username, time.Now().Add(ttl))
+		mailbox.Token = token
+		return mailbox, nil
+	}
+	return nil, ErrUsernameExhausted
 }
 
-// IsValidEmail 检查邮箱是否有效（是否由本生成器创建）
-func (g *EmailGenerator) IsValidEmail(email string) bool {
-	// 从邮箱地址提取用户名部分
-	var username string
-	for i, c := range email {
-		if c == '@' {
-			username = email[:i]
-			break
+// CreateEmailOptions 创建邮箱的参数
+type CreateEmailOptions struct {
+	Username string        // 指定的用户名，为空时按Strategy随机生成
+	Suffix   bool          // 指定的用户名已被使用时是否加上随机后缀
+	Strategy string        // 随机生成用户名的策略，为空时使用默认策略
+	TTL      time.Duration // 邮箱的有效期，为0时使用默认有效期
+}
+
+// CreateEmail 使用指定的用户名创建临时邮箱并签发访问令牌，用户名为空时按策略随机生成；
+// 用户名已被使用时，Suffix为true则在后面加上随机后缀（例如qa-signup-42-7f3a），否则返回ErrUsernameTaken
+func (g *EmailGenerator) CreateEmail(opts CreateEmailOptions) (*Mailbox, error) {
+	username := opts.Username
+	if username == "" {
+		return g.GenerateEmail(opts.Strategy, opts.TTL)
+	}
+	suffix := opts.Suffix
+
+	username = strings.ToLower(username)
+	if err := ValidateUsername(username); err != nil {
+		return nil, err
+	}
+	ttl, err := g.mailboxTTL(opts.TTL)
+	if err != nil {
+		return nil, err
+	}
+	token, tokenHash, err := newAccessToken()
+	if err != nil {
+		return nil, err
+	}
+
+	candidate := username
+	for attempt := 0; ; attempt++ {
+		created, err := g.storage.CreateActiveEmail(candidate, ttl, tokenHash)
+		if err != nil {
+			return nil, fmt.Errorf("添加活跃邮箱失败: %w", err)
+		}
+		if created {
+			mailbox := g.mailbox(candidate, time.Now().Add(ttl))
+			mailbox.Token = token
+			return mailbox, nil
 		}
+		if !suffix || attempt >= usernameSuffixAttempts {
+			return nil, ErrUsernameTaken
+		}
+		s, err := generateRandomString(usernameSuffixLength)
+		if err != nil {
+			return nil, err
+		}
+		candidate = withUsernameSuffix(username, s)
 	}
+}
+
+// ExtendEmail 将邮箱的过期时间重新设置为ttl之后，ttl为0时使用默认有效期
+func (g *EmailGenerator) ExtendEmail(email string, ttl time.Duration) (*Mailbox, error) {
+	ttl, err := g.mailboxTTL(ttl)
+	if err != nil {
+		return nil, err
+	}
+	active, err := g.storage.ExtendActiveEmail(usernameOf(email), ttl)
+	if err != nil {
+		return nil, fmt.Errorf("延长邮箱有效期失败: %w", err)
+	}
+	if active == nil {
+		return nil, ErrMailboxNotFound
+	}
+	return g.mailbox(active.Username, active.ExpiresAt), nil
+}
+
+// Authorize 检查访问令牌是否属于邮箱；邮箱不存在、已过期或令牌不匹配时都返回ErrInvalidToken，
+// 不泄露邮箱是否存在
+func (g *EmailGenerator) Authorize(email, token string) error {
+	active, err := g.storage.GetActiveEmail(usernameOf(email))
+	if err != nil {
+		return fmt.Errorf("检查邮箱是否活跃失败: %w", err)
+	}
+	if active != nil && !isTokenHash(active.TokenHash) {
+		log.Printf("邮箱%s创建于启用访问令牌之前，需要管理员重新签发访问令牌后才能读取", email)
+		return ErrInvalidToken
+	}
+	if active == nil || !tokenMatches(token, active.TokenHash) {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+// IssueToken 为邮箱签发新的访问令牌，旧令牌立即失效；用于启用访问令牌之前创建的邮箱和丢失令牌的邮箱
+func (g *EmailGenerator) IssueToken(email string) (*Mailbox, error) {
+	token, tokenHash, err := newAccessToken()
+	if err != nil {
+		return nil, err
+	}
+	username := usernameOf(email)
+	updated, err := g.storage.SetActiveEmailToken(username, tokenHash)
+	if err != nil {
+		return nil, fmt.Errorf("保存访问令牌失败: %w", err)
+	}
+	if !updated {
+		return nil, ErrMailboxNotFound
+	}
+	active, err := g.storage.GetActiveEmail(username)
+	if err != nil {
+		return nil, fmt.Errorf("检查邮箱是否活跃失败: %w", err)
+	}
+	if active == nil {
+		return nil, ErrMailboxNotFound
+	}
+	mailbox := g.mailbox(active.Username, active.ExpiresAt)
+	mailbox.Token = token
+	return mailbox, nil
+}
+
+// warnLegacyMailboxes 提示启用访问令牌之前创建、还没有令牌的邮箱，它们在重新签发令牌之前无法读取
+func (g *EmailGenerator) warnLegacyMailboxes() {
+	active, err := g.storage.GetActiveEmails()
+	if err != nil {
+		log.Printf("检查没有访问令牌的邮箱失败: %v", err)
+		return
+	}
+	legacy := 0
+	for _, a := range active {
+		if !isTokenHash(a.TokenHash) {
+			legacy++
+		}
+	}
+	if legacy > 0 {
+		log.Printf("警告: 有%d个邮箱创建于启用访问令牌之前，需要使用ADMIN_TOKEN调用POST /api/email/:email/token签发令牌后才能读取，"+
+			"否则到期后自动删除", legacy)
+	}
+}
+
+// mailbox 返回用户名对应的邮箱，过期时间精确到秒
+func (g *EmailGenerator) mailbox(username string, expiresAt time.Time) *Mailbox {
+	return &Mailbox{
+		Address:   fmt.Sprintf("%s@%s", username, g.domain),
+		ExpiresAt: expiresAt.Truncate(time.Second),
+	}
+}
+
+// ValidateUsername 按RFC 5321检查用户名（邮箱地址的本地部分）：由字母、数字和atext特殊字符组成，
+// 可以用单个"."分隔，不能以"."开头或结尾，最长64个字符；不支持带引号的本地部分，也不允许保留名称
+func ValidateUsername(username string) error {
+	if username == "" || len(username) > maxUsernameLength {
+		return fmt.Errorf("%w: 长度必须为1到%d个字符", ErrInvalidUsername, maxUsernameLength)
+	}
+	for _, atom := range strings.Split(username, ".") {
+		if atom == "" {
+			return fmt.Errorf("%w: 不能以\".\"开头或结尾，也不能包含连续的\".\"", ErrInvalidUsername)
+		}
+		for _, c := range atom {
+			if !isUsernameChar(c) {
+				return fmt.Errorf("%w: 不允许的字符%q", ErrInvalidUsername, c)
+			}
+		}
+	}
+	if reservedUsernames[strings.ToLower(username)] {
+		return fmt.Errorf("%w: %s", ErrReservedUsername, username)
+	}
+	return nil
+}
+
+// isUsernameChar 检查字符是否是RFC 5321 atext中的字符
+func isUsernameChar(c rune) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune(usernameSpecials, c)
+}
+
+// withUsernameSuffix 在用户名后加上"-后缀"，总长度超过上限时截短用户名
+func withUsernameSuffix(username, suffix string) string {
+	if max := maxUsernameLength - len(suffix) - 1; len(username) > max {
+		username = strings.TrimRight(username[:max], ".")
+	}
+	return username + "-" + suffix
+}
+
+// IsValidEmail 检查邮箱是否有效（是否由本生成器创建）
+func (g *EmailGenerator) IsValidEmail(email string) bool {
+	// 从邮箱地址中提取用户名
+	username := usernameOf(email)
 
 	active, err := g.storage.IsActiveEmail(username)
 	if err != nil {
@@ -55,32 +369,48 @@ func (g *EmailGenerator) IsValidEmail(email string) bool {
 	return active
 }
 
-// GetActiveEmails 获取所有活跃的邮箱
-func (g *EmailGenerator) GetActiveEmails() []string {
-	usernames, err := g.storage.GetActiveEmails()
+// GetActiveEmails 获取所有活跃的邮箱，最晚过期的在前
+func (g *EmailGenerator) GetActiveEmails() []Mailbox {
+	return g.activeMailboxes(func(repository.ActiveEmail) bool { return true })
+}
+
+// GetEmailsByTokens 获取访问令牌对应的活跃邮箱，最晚过期的在前
+func (g *EmailGenerator) GetEmailsByTokens(tokens []string) []Mailbox {
+	if len(tokens) == 0 {
+		return []Mailbox{}
+	}
+	hashes := make(map[string]bool, len(tokens))
+	for _, token := range tokens {
+		hashes[hashAccessToken(token)] = true
+	}
+	return g.activeMailboxes(func(a repository.ActiveEmail) bool { return hashes[a.TokenHash] })
+}
+
+// activeMailboxes 获取满足条件的活跃邮箱，最晚过期的在前
+func (g *EmailGenerator) activeMailboxes(match func(repository.ActiveEmail) bool) []Mailbox {
+	active, err := g.storage.GetActiveEmails()
 	if err != nil {
 		log.Printf("获取活跃邮箱列表失败: %v", err)
-		return []string{}
+		return []Mailbox{}
 	}
 
-	emails := make([]string, 0, len(usernames))
-	for _, username := range usernames {
-		emails = append(emails, fmt.Sprintf("%s@%s", username, g.domain))
+	emails := make([]Mailbox, 0, len(active))
+	for _, a := range active {
+		if match(a) {
+			emails = append(emails, *g.mailbox(a.Username, a.ExpiresAt))
+		}
 	}
+	sort.Slice(emails, func(i, j int) bool {
+		return emails[i].ExpiresAt.After(emails[j].ExpiresAt)
+	})
 
 	return emails
 }
 
 // DeleteEmail 删除一个临时邮箱
 func (g *EmailGenerator) DeleteEmail(email string) bool {
-	// 从邮箱地址提取用户名部分
-	var username string
-	for i, c := range email {
-		if c == '@' {
-			username = email[:i]
-			break
-		}
-	}
+	// 从邮箱地址中提取用户名
+	username := usernameOf(email)
 
 	active, err := g.storage.IsActiveEmail(username)
 	if err != nil {
@@ -100,12 +430,21 @@ func (g *EmailGenerator) DeleteEmail(email string) bool {
 	return false
 }
 
-// generateRandomString 生成指定长度的随机字符串
-func generateRandomString(length int) string {
-	b := make([]byte, length/2)
+// generateRandomString 生成指定长度的随机十六进制字符串；随机数生成失败时返回错误，
+// 不能退回到可预测的值，否则不同用户会得到同一个邮箱
+func generateRandomString(length int) (string, error) {
+	b := make([]byte, (length+1)/2)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrRandomUnavailable, err)
+	}
+	return hex.EncodeToString(b)[:length], nil
+}
+
+// newMessageID 生成邮件ID
+func newMessageID() string {
+	b := make([]byte, 12)
 	if _, err := rand.Read(b); err != nil {
-		// 如果随机数生成失败，使用备用方法
-		return fmt.Sprintf("temp%d", len(b))
+		return fmt.Sprintf("%x", time.Now().UnixNano())
 	}
 	return hex.EncodeToString(b)
 }
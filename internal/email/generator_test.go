@@ -0,0 +1,127 @@
+package email
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// TestValidateUsername 按RFC 5321本地部分的规则检查用户名，不允许无法直接出现在API路径中的字符
+func TestValidateUsername(t *testing.T) {
+	valid := []string{
+		"a",
+		"qa-signup-42",
+		"first.last",
+		"user+tag",
+		"o'brien",
+		"x_y=z!$&*^`{|}~",
+		strings.Repeat("a", maxUsernameLength),
+	}
+	for _, username := range valid {
+		if err := ValidateUsername(username); err != nil {
+			t.Errorf("%q: 期望有效，实际 %v", username, err)
+		}
+	}
+
+	invalid := []string{
+		"",
+		strings.Repeat("a", maxUsernameLength+1),
+		".leading",
+		"trailing.",
+		"double..dot",
+		"with space",
+		"a/b",
+		"a?b",
+		"a#b",
+		"a%41",
+		"a@b",
+		`"quoted"`,
+		"中文",
+	}
+	for _, username := range invalid {
+		if err := ValidateUsername(username); !errors.Is(err, ErrInvalidUsername) {
+			t.Errorf("%q: 期望ErrInvalidUsername，实际 %v", username, err)
+		}
+	}
+}
+
+// TestValidateUsernameReserved 保留名称不区分大小写
+func TestValidateUsernameReserved(t *testing.T) {
+	for _, username := range []string{"postmaster", "Abuse", "ADMIN", "mailer-daemon", "No-Reply"} {
+		if err := ValidateUsername(username); !errors.Is(err, ErrReservedUsername) {
+			t.Errorf("%q: 期望ErrReservedUsername，实际 %v", username, err)
+		}
+	}
+	generator, _ := newTestGenerator(t)
+	if _, err := generator.CreateEmail(CreateEmailOptions{Username: "PostMaster"}); !errors.Is(err, ErrReservedUsername) {
+		t.Errorf("创建保留名称: 期望ErrReservedUsername，实际 %v", err)
+	}
+}
+
+// TestCreateEmailSuffix 用户名已被使用时，Suffix为true则加上"-xxxx"后缀，否则返回ErrUsernameTaken
+func TestCreateEmailSuffix(t *testing.T) {
+	generator, _ := newTestGenerator(t)
+	first, err := generator.CreateEmail(CreateEmailOptions{Username: "QA-Signup-42"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Address != "qa-signup-42@t.test" {
+		t.Errorf("期望用户名转为小写，实际 %s", first.Address)
+	}
+
+	if _, err := generator.CreateEmail(CreateEmailOptions{Username: "qa-signup-42"}); !errors.Is(err, ErrUsernameTaken) {
+		t.Errorf("不加后缀: 期望ErrUsernameTaken，实际 %v", err)
+	}
+
+	second, err := generator.CreateEmail(CreateEmailOptions{Username: "qa-signup-42", Suffix: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !regexp.MustCompile(`^qa-signup-42-[0-9a-f]{4}@t\.test$`).MatchString(second.Address) {
+		t.Errorf("期望qa-signup-42-xxxx@t.test，实际 %s", second.Address)
+	}
+	if second.Token == first.Token {
+		t.Error("期望加后缀的邮箱使用新的令牌")
+	}
+}
+
+// TestWithUsernameSuffix 加上后缀超过长度上限时截短用户名，并去掉截断处的"."
+func TestWithUsernameSuffix(t *testing.T) {
+	if got := withUsernameSuffix("name", "7f3a"); got != "name-7f3a" {
+		t.Errorf("期望name-7f3a，实际 %s", got)
+	}
+
+	long := strings.Repeat("a", maxUsernameLength-6) + ".bcdef"
+	got := withUsernameSuffix(long, "7f3a")
+	if len(got) > maxUsernameLength {
+		t.Errorf("期望长度不超过%d，实际 %d", maxUsernameLength, len(got))
+	}
+	if !strings.HasSuffix(got, "-7f3a") || strings.Contains(got, ".-") {
+		t.Errorf("截短结果不正确: %s", got)
+	}
+	if err := ValidateUsername(got); err != nil {
+		t.Errorf("截短后的用户名无效: %v", err)
+	}
+}
+
+// TestEmailAddressCaseInsensitive 收件地址和API中的邮箱地址不区分大小写
+func TestEmailAddressCaseInsensitive(t *testing.T) {
+	generator, _ := newTestGenerator(t)
+	mailbox, err := generator.CreateEmail(CreateEmailOptions{Username: "qa-signup-42"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, address := range []string{"qa-signup-42@t.test", "QA-Signup-42@t.test", "QA-SIGNUP-42@T.TEST"} {
+		if !generator.IsValidEmail(address) {
+			t.Errorf("%s: 期望是有效的收件地址", address)
+		}
+		if err := generator.Authorize(address, mailbox.Token); err != nil {
+			t.Errorf("%s: 期望令牌有效，实际 %v", address, err)
+		}
+	}
+	if generator.IsValidEmail("qa-signup-43@t.test") {
+		t.Error("期望未创建的邮箱无效")
+	}
+}
@@ -0,0 +1,97 @@
+package email
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+
+	"golang.org/x/text/encoding/htmlindex"
+
+	"mail-temp/internal/repository"
+)
+
+// headerDecoder 解码RFC 2047编码的头部值，支持GBK等常见字符集
+var headerDecoder = &mime.WordDecoder{
+	CharsetReader: func(charset string, input io.Reader) (io.Reader, error) {
+		encoding, err := htmlindex.Get(charset)
+		if err != nil {
+			return nil, fmt.Errorf("不支持的字符集: %s", charset)
+		}
+		return encoding.NewDecoder().Reader(input), nil
+	},
+}
+
+// parseHeaders 按原始顺序解析邮件头部，同名头部保留多个值
+func parseHeaders(raw []byte) []repository.Header {
+	reader := bufio.NewReader(bytes.NewReader(raw))
+
+	var headers []repository.Header
+	for {
+		line, err := reader.ReadString('\n')
+		trimmed := strings.TrimRight(line, "\r\n")
+
+		// 空行表示头部结束
+		if trimmed == "" {
+			break
+		}
+
+		if (trimmed[0] == ' ' || trimmed[0] == '\t') && len(headers) > 0 {
+			// 折叠行，拼接到上一个头部
+			headers[len(headers)-1].Value += " " + strings.TrimSpace(trimmed)
+		} else if i := strings.IndexByte(trimmed, ':'); i > 0 {
+			headers = append(headers, repository.Header{
+				Name:  strings.TrimSpace(trimmed[:i]),
+				Value: strings.TrimSpace(trimmed[i+1:]),
+			})
+		}
+
+		if err != nil {
+			break
+		}
+	}
+
+	for i := range headers {
+		headers[i].Value = decodeHeaderValue(headers[i].Value)
+	}
+	return headers
+}
+
+// decodeHeaderValue 解码头部中的编码字，失败时返回原值
+func decodeHeaderValue(value string) string {
+	if !strings.Contains(value, "=?") {
+		return value
+	}
+	decoded, err := headerDecoder.DecodeHeader(value)
+	if err != nil {
+		return value
+	}
+	return decoded
+}
+
+// HeaderValues 获取指定名称的所有头部值（名称不区分大小写）
+func (m *Mail) HeaderValues(name string) []string {
+	var values []string
+	for _, header := range m.Headers {
+		if strings.EqualFold(header.Name, name) {
+			values = append(values, header.Value)
+		}
+	}
+	return values
+}
+
+// MatchHeader 检查邮件是否包含指定头部；value为空时只检查头部是否存在
+func (m *Mail) MatchHeader(name, value string) bool {
+	values := m.HeaderValues(name)
+	if value == "" {
+		return len(values) > 0
+	}
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
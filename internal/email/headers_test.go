@@ -0,0 +1,73 @@
+package email
+
+import (
+	"reflect"
+	"testing"
+
+	"mail-temp/internal/repository"
+)
+
+// TestParseHeaders 按原始顺序解析头部，拼接折叠行，保留同名头部，并解码RFC 2047编码字
+func TestParseHeaders(t *testing.T) {
+	raw := "Received: from a.example\r\n" +
+		"\tby b.example; Mon, 1 Jan 2024 00:00:00 +0000\r\n" +
+		"Received: from c.example\r\n" +
+		"Subject: =?GBK?B?0enWpMLr?= 482913\r\n" +
+		"From: =?UTF-8?Q?Jos=C3=A9?= <jose@example.com>\r\n" +
+		"X-Broken: =?x-unknown?B?AAAA?=\r\n" +
+		"not a header line\r\n" +
+		"\r\n" +
+		"Body: not a header\r\n"
+
+	want := []repository.Header{
+		{Name: "Received", Value: "from a.example by b.example; Mon, 1 Jan 2024 00:00:00 +0000"},
+		{Name: "Received", Value: "from c.example"},
+		{Name: "Subject", Value: "验证码 482913"},
+		{Name: "From", Value: "José <jose@example.com>"},
+		{Name: "X-Broken", Value: "=?x-unknown?B?AAAA?="},
+	}
+	if got := parseHeaders([]byte(raw)); !reflect.DeepEqual(got, want) {
+		t.Errorf("期望\n%+v\n实际\n%+v", want, got)
+	}
+}
+
+// TestDecodeHeaderValue 解码多个相邻的编码字和常见字符集，不含编码字时原样返回
+func TestDecodeHeaderValue(t *testing.T) {
+	for value, want := range map[string]string{
+		"plain =? text": "plain =? text",
+		"=?utf-8?b?5L2g5aW9?= =?utf-8?b?5LiW55WM?=":  "你好世界",
+		"=?ISO-8859-1?Q?C=F3digo?= de acceso":        "Código de acceso",
+		"=?gb2312?B?xPq1xNHp1qTC68rHIDQ4MjkxMw==?=":  "您的验证码是 482913",
+		"=?ISO-2022-JP?B?GyRCRyc+WiUzITwlSRsoQg==?=": "認証コード",
+		"=?KOI8-R?B?8NLJ18XUIDQ4MjkxMw==?=":          "Привет 482913",
+	} {
+		if got := decodeHeaderValue(value); got != want {
+			t.Errorf("%s: 期望%q，实际%q", value, want, got)
+		}
+	}
+}
+
+// TestMailHeaderValues 头部名称不区分大小写，MatchHeader的值需要完全匹配
+func TestMailHeaderValues(t *testing.T) {
+	mail := &Mail{Headers: []repository.Header{
+		{Name: "X-Tag", Value: "a"},
+		{Name: "x-tag", Value: "b"},
+		{Name: "List-Id", Value: "news.example"},
+	}}
+	if got := mail.HeaderValues("X-TAG"); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("期望[a b]，实际%v", got)
+	}
+	for _, tt := range []struct {
+		name, value string
+		want        bool
+	}{
+		{"x-tag", "b", true},
+		{"X-Tag", "", true},
+		{"List-Id", "news", false},
+		{"X-Missing", "", false},
+	} {
+		if got := mail.MatchHeader(tt.name, tt.value); got != tt.want {
+			t.Errorf("%s=%s: 期望%v，实际%v", tt.name, tt.value, tt.want, got)
+		}
+	}
+}
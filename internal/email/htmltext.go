@@ -0,0 +1,207 @@
+package email
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// 转换为纯文本时整体忽略的元素
+var textSkippedElements = map[atom.Atom]bool{
+	atom.Head:     true,
+	atom.Title:    true,
+	atom.Script:   true,
+	atom.Style:    true,
+	atom.Noscript: true,
+	atom.Template: true,
+	atom.Svg:      true,
+	atom.Math:     true,
+	atom.Select:   true,
+	atom.Button:   true,
+}
+
+// 块级元素，前后需要换行
+var textBlockElements = map[atom.Atom]bool{
+	atom.Address:    true,
+	atom.Article:    true,
+	atom.Aside:      true,
+	atom.Blockquote: true,
+	atom.Center:     true,
+	atom.Dd:         true,
+	atom.Div:        true,
+	atom.Dl:         true,
+	atom.Dt:         true,
+	atom.Fieldset:   true,
+	atom.Figcaption: true,
+	atom.Figure:     true,
+	atom.Footer:     true,
+	atom.Form:       true,
+	atom.H1:         true,
+	atom.H2:         true,
+	atom.H3:         true,
+	atom.H4:         true,
+	atom.H5:         true,
+	atom.H6:         true,
+	atom.Header:     true,
+	atom.Hr:         true,
+	atom.Li:         true,
+	atom.Main:       true,
+	atom.Nav:        true,
+	atom.Ol:         true,
+	atom.P:          true,
+	atom.Pre:        true,
+	atom.Section:    true,
+	atom.Table:      true,
+	atom.Tr:         true,
+	atom.Ul:         true,
+}
+
+var (
+	textSpacePattern     = regexp.MustCompile(`[ \t\f\v\x{00a0}\x{200b}\x{200c}\x{200d}\x{feff}]+`)
+	textBlankLinePattern = regexp.MustCompile(`\n{3,}`)
+	// 邮件预览文本常用的隐藏写法
+	textHiddenPattern = regexp.MustCompile(`(?i)(?:^|;|\s)(?:max-height|font-size|line-height)\s*:\s*0(?:px)?\s*(?:!important)?\s*(?:;|$)`)
+)
+
+// htmlTextRenderer HTML转纯文本渲染器
+type htmlTextRenderer struct {
+	buf       strings.Builder
+	links     []string
+	linkIndex map[string]int
+	preDepth  int
+}
+
+// htmlToText 将HTML转换为纯文本：保留块结构，链接以脚注形式列在末尾，隐藏元素被忽略
+func htmlToText(content string) string {
+	if strings.TrimSpace(content) == "" {
+		return ""
+	}
+
+	doc, err := html.Parse(strings.NewReader(content))
+	if err != nil {
+		return ""
+	}
+
+	r := &htmlTextRenderer{linkIndex: make(map[string]int)}
+	r.render(doc)
+
+	text := strings.TrimSpace(r.normalize(r.buf.String()))
+	if len(r.links) > 0 {
+		var footnotes strings.Builder
+		footnotes.WriteString("\n\n")
+		for i, link := range r.links {
+			fmt.Fprintf(&footnotes, "[%d] %s\n", i+1, link)
+		}
+		text += strings.TrimRight(footnotes.String(), "\n")
+	}
+
+	return strings.TrimSpace(text)
+}
+
+// render 递归渲染节点
+func (r *htmlTextRenderer) render(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		r.writeText(n.Data)
+		return
+	case html.ElementNode:
+		if textSkippedElements[n.DataAtom] || n.Namespace != "" || isHiddenElement(n) {
+			return
+		}
+	case html.CommentNode, html.DoctypeNode:
+		return
+	}
+
+	switch n.DataAtom {
+	case atom.Br:
+		r.buf.WriteString("\n")
+		return
+	case atom.Img:
+		// 只保留有意义的替代文本
+		if alt := strings.TrimSpace(getAttr(n, "alt")); alt != "" && !isTrackingPixel(n) {
+			r.writeText(alt)
+		}
+		return
+	case atom.Td, atom.Th:
+		r.buf.WriteString(" ")
+	case atom.Li:
+		r.buf.WriteString("\n- ")
+	case atom.Pre:
+		r.preDepth++
+		defer func() { r.preDepth-- }()
+	}
+
+	block := textBlockElements[n.DataAtom] && n.DataAtom != atom.Li
+	if block {
+		r.buf.WriteString("\n")
+	}
+
+	start := r.buf.Len()
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		r.render(c)
+	}
+
+	if n.DataAtom == atom.A {
+		r.writeLink(n, r.buf.String()[start:])
+	}
+
+	if block {
+		r.buf.WriteString("\n")
+	}
+	if n.DataAtom == atom.Td || n.DataAtom == atom.Th {
+		r.buf.WriteString(" ")
+	}
+}
+
+// writeText 写入文本，非<pre>内的空白被折叠
+func (r *htmlTextRenderer) writeText(text string) {
+	if r.preDepth > 0 {
+		r.buf.WriteString(text)
+		return
+	}
+	text = strings.NewReplacer("\r", " ", "\n", " ").Replace(text)
+	r.buf.WriteString(textSpacePattern.ReplaceAllString(text, " "))
+}
+
+// writeLink 为链接添加脚注编号
+func (r *htmlTextRenderer) writeLink(n *html.Node, text string) {
+	href := strings.TrimSpace(getAttr(n, "href"))
+	if !isRemoteURL(href) {
+		return
+	}
+
+	// 链接文字本身就是地址时不重复标注
+	if strings.TrimSpace(text) == href {
+		return
+	}
+
+	index, ok := r.linkIndex[href]
+	if !ok {
+		r.links = append(r.links, href)
+		index = len(r.links)
+		r.linkIndex[href] = index
+	}
+	fmt.Fprintf(&r.buf, " [%d]", index)
+}
+
+// normalize 整理空白：去除行首尾空格，合并多余空行
+func (r *htmlTextRenderer) normalize(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(textSpacePattern.ReplaceAllString(line, " "))
+	}
+	text = strings.Join(lines, "\n")
+	return textBlankLinePattern.ReplaceAllString(text, "\n\n")
+}
+
+// isHiddenElement 检查元素是否被隐藏
+func isHiddenElement(n *html.Node) bool {
+	if hasAttr(n, "hidden") || strings.EqualFold(getAttr(n, "aria-hidden"), "true") {
+		return true
+	}
+	style := getAttr(n, "style")
+	return styleHiddenPattern.MatchString(style) || textHiddenPattern.MatchString(style)
+}
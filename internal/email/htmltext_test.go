@@ -0,0 +1,34 @@
+package email
+
+import "testing"
+
+// TestHTMLToText 保留块结构和表格单元格间隔，忽略脚本、样式、隐藏元素和追踪像素，链接以脚注列出
+func TestHTMLToText(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want string
+	}{
+		{"空内容", "  ", ""},
+		{"块结构", "<h1>Welcome</h1><p>Your code is <b>482913</b>.</p><p>Thanks</p>",
+			"Welcome\n\nYour code is 482913.\n\nThanks"},
+		{"换行和空白折叠", "<div>Line  one<br>Line\n\t two&nbsp;&nbsp;end</div>", "Line one\nLine two end"},
+		{"表格单元格", "<table><tr><td>Code</td><td>482913</td></tr><tr><td>Expires</td><td>10 min</td></tr></table>",
+			"Code 482913\n\nExpires 10 min"},
+		{"列表", "<ul><li>First</li><li>Second</li></ul>", "- First\n- Second"},
+		{"忽略的元素", `<head><title>T</title><style>.a{color:#123456}</style></head><body><script>var c="999999"</script>` +
+			`<noscript>x</noscript><svg><text>111111</text></svg><button>Copy</button><p>Visible</p></body>`, "Visible"},
+		{"隐藏元素", `<div style="display:none">Preview 111111</div><span hidden>222222</span>` +
+			`<span aria-hidden="true">333333</span><div style="max-height:0px;">444444</div><p>Shown</p>`, "Shown"},
+		{"图片替代文本", `<img src="https://cdn.example/logo.png" alt="ACME"><img src="https://t.example/o.gif" width="1" height="1" alt="tracker"><p>Hi</p>`,
+			"ACME\nHi"},
+		{"链接脚注", `<p><a href="https://example.com/verify?t=1">Verify</a> or <a href="https://example.com/verify?t=1">again</a>` +
+			` <a href="https://example.com/help">https://example.com/help</a> <a href="mailto:x@example.com">mail</a></p>`,
+			"Verify [1] or again [1] https://example.com/help mail\n\n[1] https://example.com/verify?t=1"},
+	}
+	for _, tt := range tests {
+		if got := htmlToText(tt.html); got != tt.want {
+			t.Errorf("%s: 期望\n%q\n实际\n%q", tt.name, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package email
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	_ "image/gif"  // 注册GIF解码器
+	_ "image/jpeg" // 注册JPEG解码器
+	_ "image/png"  // 注册PNG解码器
+	"log"
+	"strings"
+
+	"github.com/makiuchi-d/gozxing"
+	"github.com/makiuchi-d/gozxing/datamatrix"
+	"github.com/makiuchi-d/gozxing/oned"
+	"github.com/makiuchi-d/gozxing/qrcode"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"mail-temp/internal/repository"
+)
+
+const (
+	// 解码的图片最大字节数，更大的图片通常是照片或横幅，不是二维码
+	maxImageCodeBytes = 2 << 20
+	// 解码的图片最大像素数，防止解压后占用过多内存
+	maxImageCodePixels = 4096 * 4096
+	// 每封邮件最多解码的图片数
+	maxImageCodeImages = 10
+)
+
+// 图片中解码出的内容类型
+const (
+	ImageCodeURL     = "url"     // http/https链接
+	ImageCodeOTPAuth = "otpauth" // otpauth://两步验证密钥
+	ImageCodeText    = "text"    // 其他文本，例如验证码
+)
+
+// 支持解码的图片类型
+var imageCodeContentTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/jpg":  true,
+	"image/gif":  true,
+}
+
+// newImageCodeReaders 创建二维码和条形码解码器，解码器有内部状态，每次解码单独创建
+func newImageCodeReaders() []gozxing.Reader {
+	return []gozxing.Reader{
+		qrcode.NewQRCodeReader(),
+		datamatrix.NewDataMatrixReader(),
+		oned.NewCode128Reader(),
+		oned.NewCode39Reader(),
+		oned.NewMultiFormatUPCEANReader(nil),
+	}
+}
+
+// decodeImageCodes 解码图片附件、内嵌图片以及HTML中data URI图片里的二维码和条形码，按内容去重
+func decodeImageCodes(parts []parsedPart, htmlContent string) []repository.ImageCode {
+	type sourcedImage struct {
+		source string
+		data   []byte
+	}
+
+	var images []sourcedImage
+	for _, part := range parts {
+		if !imageCodeContentTypes[part.ContentType] {
+			continue
+		}
+		source := part.Filename
+		if source == "" && part.ContentID != "" {
+			source = "cid:" + part.ContentID
+		}
+		images = append(images, sourcedImage{source: source, data: part.Data})
+	}
+	for _, data := range dataURIImages(htmlContent) {
+		images = append(images, sourcedImage{source: "data-uri", data: data})
+	}
+	if len(images) > maxImageCodeImages {
+		images = images[:maxImageCodeImages]
+	}
+
+	var codes []repository.ImageCode
+	seen := make(map[string]bool)
+	for _, img := range images {
+		code, ok := decodeImageCode(img.data)
+		if !ok || seen[code.Payload] {
+			continue
+		}
+		seen[code.Payload] = true
+		code.Source = img.source
+		log.Printf("从图片中解码到%s: %s", code.Format, code.Payload)
+		codes = append(codes, code)
+	}
+	return codes
+}
+
+// decodeImageCode 解码一张图片中的二维码或条形码，图片过大、无法解析或没有找到时返回false
+func decodeImageCode(data []byte) (code repository.ImageCode, ok bool) {
+	if len(data) == 0 || len(data) > maxImageCodeBytes {
+		return code, false
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || config.Width*config.Height > maxImageCodePixels {
+		return code, false
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return code, false
+	}
+
+	// 解码库在处理畸形图片时可能panic，不能影响邮件接收
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("解码图片中的二维码失败: %v", r)
+			ok = false
+		}
+	}()
+
+	bitmap, err := gozxing.NewBinaryBitmapFromImage(img)
+	if err != nil {
+		return code, false
+	}
+	hints := map[gozxing.DecodeHintType]interface{}{gozxing.DecodeHintType_TRY_HARDER: true}
+	for _, reader := range newImageCodeReaders() {
+		result, err := reader.Decode(bitmap, hints)
+		if err != nil {
+			continue
+		}
+		payload := strings.TrimSpace(result.GetText())
+		if payload == "" {
+			continue
+		}
+		return repository.ImageCode{
+			Format:  result.GetBarcodeFormat().String(),
+			Kind:    imageCodeKind(payload),
+			Payload: payload,
+		}, true
+	}
+	return code, false
+}
+
+// imageCodeKind 判断解码内容的类型
+func imageCodeKind(payload string) string {
+	lower := strings.ToLower(payload)
+	switch {
+	case strings.HasPrefix(lower, "otpauth://"):
+		return ImageCodeOTPAuth
+	case strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://"):
+		return ImageCodeURL
+	}
+	return ImageCodeText
+}
+
+// dataURIImages 返回HTML中<img src="data:image/...;base64,...">图片的内容
+func dataURIImages(content string) [][]byte {
+	if !strings.Contains(content, "data:image/") {
+		return nil
+	}
+	doc, err := html.Parse(strings.NewReader(content))
+	if err != nil {
+		return nil
+	}
+
+	var images [][]byte
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.DataAtom == atom.Img {
+			if data, ok := decodeDataURI(getAttr(n, "src")); ok {
+				images = append(images, data)
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	return images
+}
+
+// decodeDataURI 解码base64编码的图片data URI
+func decodeDataURI(uri string) ([]byte, bool) {
+	uri = strings.TrimSpace(uri)
+	if !strings.HasPrefix(strings.ToLower(uri), "data:image/") {
+		return nil, false
+	}
+	meta, payload, ok := strings.Cut(uri[len("data:"):], ",")
+	meta = strings.ToLower(meta)
+	if !ok || !strings.HasSuffix(meta, ";base64") {
+		return nil, false
+	}
+	if !imageCodeContentTypes[strings.TrimSuffix(meta, ";base64")] {
+		return nil, false
+	}
+	// 超过大小上限的图片不解码
+	if base64.StdEncoding.DecodedLen(len(payload)) > maxImageCodeBytes {
+		return nil, false
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(payload), ""))
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
@@ -0,0 +1,215 @@
+package email
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// 未能确定语言时与检测结果一起使用的默认语言
+var defaultKeywordLanguages = []string{"en", "zh"}
+
+// codeKeywords 按语言区分的验证码关键词
+var codeKeywords = map[string][]string{
+	"zh": {"验证码", "校验码", "确认码", "动态码", "激活码", "安全码", "登录码", "驗證碼", "認證碼", "確認碼"},
+	"en": {"verification code", "security code", "confirmation code", "one-time code", "one time code", "one-time passcode", "login code", "sign-in code", "passcode", "code", "otp", "pin"},
+	"ja": {"認証コード", "確認コード", "検証コード", "認証番号", "確認番号", "セキュリティコード", "ワンタイムパスワード", "ログインコード", "コード"},
+	"ko": {"인증번호", "인증 번호", "인증코드", "인증 코드", "확인 코드", "확인코드", "보안 코드", "보안코드", "코드"},
+	"de": {"Bestätigungscode", "Verifizierungscode", "Sicherheitscode", "Einmalcode", "Anmeldecode", "Code"},
+	"es": {"código de verificación", "código de seguridad", "código de confirmación", "código de acceso", "código"},
+	"fr": {"code de vérification", "code de sécurité", "code de confirmation", "code à usage unique", "code"},
+	"pt": {"código de verificação", "código de segurança", "código de confirmação", "código de acesso", "código"},
+	"it": {"codice di verifica", "codice di sicurezza", "codice di conferma", "codice"},
+	"ru": {"код подтверждения", "проверочный код", "код проверки", "код безопасности", "одноразовый код", "код"},
+}
+
+// codeKeywordConnectors 验证码后面紧跟关键词时的连接词，例如"123456 is your code"
+var codeKeywordConnectors = map[string][]string{
+	"zh": {"为您的", "是您的", "为你的", "是你的", "为", "是"},
+	"en": {"is your", "is the", "is", "are"},
+	"ja": {"が", "は"},
+	"ko": {"는", "은", "가", "이"},
+	"de": {"ist Ihr", "ist dein", "ist"},
+	"es": {"es tu", "es su", "es el", "es"},
+	"fr": {"est votre", "est ton", "est"},
+	"pt": {"é o seu", "é seu", "é o", "é"},
+	"it": {"è il tuo", "è il", "è"},
+	"ru": {"— ваш", "- ваш", "ваш", "это"},
+}
+
+// 拉丁字母语言的常见词，用于检测语言
+var languageStopwords = map[string][]string{
+	"en": {"the", "your", "you", "is", "to", "and", "this", "please"},
+	"de": {"der", "die", "das", "und", "ist", "ihr", "ihre", "bitte", "sie", "nicht"},
+	"es": {"el", "la", "los", "tu", "su", "es", "para", "por", "que", "usted"},
+	"fr": {"le", "la", "les", "votre", "vous", "est", "pour", "et", "ne", "pas"},
+	"pt": {"o", "os", "seu", "sua", "você", "para", "não", "que", "é", "por"},
+	"it": {"il", "lo", "di", "tuo", "tua", "per", "non", "che", "è", "questo"},
+}
+
+// codeLabelSet 一组语言的关键词正则表达式
+type codeLabelSet struct {
+	before *regexp.Regexp // 出现在验证码前面
+	after  *regexp.Regexp // 紧跟在验证码后面
+}
+
+// 按语言组合缓存的关键词正则表达式，程序启动时生成，之后只读
+var codeLabelSets = buildCodeLabelSets()
+
+// buildCodeLabelSets 为每种语言（加上默认语言）以及全部语言生成关键词正则表达式
+func buildCodeLabelSets() map[string]*codeLabelSet {
+	sets := make(map[string]*codeLabelSet)
+	all := make([]string, 0, len(codeKeywords))
+	for lang := range codeKeywords {
+		all = append(all, lang)
+		sets[lang] = newCodeLabelSet(append([]string{lang}, defaultKeywordLanguages...))
+	}
+	sets[""] = newCodeLabelSet(all)
+	return sets
+}
+
+// newCodeLabelSet 合并多种语言的关键词
+func newCodeLabelSet(languages []string) *codeLabelSet {
+	var keywords, connectors []string
+	seen := make(map[string]bool)
+	for _, lang := range languages {
+		if seen[lang] {
+			continue
+		}
+		seen[lang] = true
+		keywords = append(keywords, codeKeywords[lang]...)
+		connectors = append(connectors, codeKeywordConnectors[lang]...)
+	}
+
+	labels := keywordAlternation(keywords)
+	return &codeLabelSet{
+		before: regexp.MustCompile(`(?i)` + labels),
+		after:  regexp.MustCompile(`(?i)^[\s:：,，、]*(?:` + keywordAlternation(connectors) + `)?\s*(?:your|the|您的|你的)?\s*(?:` + labels + `)`),
+	}
+}
+
+// keywordAlternation 将关键词转换为正则表达式分支：较长的在前，空格可匹配任意空白，
+// 以ASCII字母结尾或开头的关键词加上单词边界，避免"code"匹配"barcode"
+func keywordAlternation(keywords []string) string {
+	sorted := append([]string(nil), keywords...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return len(sorted[i]) > len(sorted[j])
+	})
+
+	parts := make([]string, 0, len(sorted))
+	for _, keyword := range sorted {
+		part := strings.ReplaceAll(regexp.QuoteMeta(keyword), " ", `\s+`)
+		part = strings.ReplaceAll(part, "-", `[-\s]?`)
+		if isASCIIWordByte(keyword[0]) {
+			part = `\b` + part
+		}
+		if isASCIIWordByte(keyword[len(keyword)-1]) {
+			part += `\b`
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, "|")
+}
+
+// labelSetFor 返回指定语言的关键词，未知语言使用全部语言
+func labelSetFor(lang string) *codeLabelSet {
+	if set, ok := codeLabelSets[lang]; ok {
+		return set
+	}
+	return codeLabelSets[""]
+}
+
+// 从HTML根元素的lang属性中读取语言
+var htmlLangPattern = regexp.MustCompile(`(?i)<html[^>]*\slang\s*=\s*["']?([a-z]{2,3})`)
+
+// DetectLanguage 确定邮件的语言：优先使用Content-Language头部和HTML的lang属性，
+// 其次按文字系统和常见词判断；无法判断时返回空字符串
+func DetectLanguage(content *MessageContent) string {
+	for _, header := range content.Headers {
+		if strings.EqualFold(header.Name, "Content-Language") {
+			if lang := primaryLanguage(header.Value); lang != "" {
+				return lang
+			}
+		}
+	}
+	if matches := htmlLangPattern.FindStringSubmatch(content.HTML); len(matches) > 1 {
+		if lang := primaryLanguage(matches[1]); lang != "" {
+			return lang
+		}
+	}
+	return detectTextLanguage(content.Subject + "\n" + content.Text)
+}
+
+// primaryLanguage 从语言标签（例如de-DE、ja）中取出主语言，只返回有关键词的语言
+func primaryLanguage(tag string) string {
+	tag = strings.TrimSpace(strings.Split(tag, ",")[0])
+	if i := strings.IndexAny(tag, "-_"); i >= 0 {
+		tag = tag[:i]
+	}
+	tag = strings.ToLower(tag)
+	if _, ok := codeKeywords[tag]; ok {
+		return tag
+	}
+	return ""
+}
+
+// detectTextLanguage 按文字系统和常见词检测文本的语言
+func detectTextLanguage(text string) string {
+	var han, kana, hangul, cyrillic, latin int
+	for _, r := range text {
+		switch {
+		case unicode.In(r, unicode.Hiragana, unicode.Katakana):
+			kana++
+		case unicode.Is(unicode.Hangul, r):
+			hangul++
+		case unicode.Is(unicode.Han, r):
+			han++
+		case unicode.Is(unicode.Cyrillic, r):
+			cyrillic++
+		case unicode.Is(unicode.Latin, r):
+			latin++
+		}
+	}
+
+	switch {
+	case kana > 0 && kana*5 >= han:
+		return "ja"
+	case hangul > 0 && hangul >= han:
+		return "ko"
+	case han >= 10 || (han > 0 && han*4 >= latin):
+		// 一个汉字包含的信息量远大于一个字母，正文中的链接等不应掩盖中文内容
+		return "zh"
+	case cyrillic >= 10 || (cyrillic > 0 && cyrillic >= latin):
+		return "ru"
+	case latin == 0:
+		return ""
+	}
+
+	// 拉丁字母语言按常见词计数
+	counts := make(map[string]int)
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	}) {
+		for lang, stopwords := range languageStopwords {
+			for _, stopword := range stopwords {
+				if word == stopword {
+					counts[lang]++
+				}
+			}
+		}
+	}
+
+	best, bestCount := "", 1
+	for _, lang := range []string{"en", "de", "es", "fr", "pt", "it"} {
+		if counts[lang] > bestCount {
+			best, bestCount = lang, counts[lang]
+		}
+	}
+	return best
+}
+
+// isASCIIWordByte 检查字节是否是ASCII字母或数字
+func isASCIIWordByte(b byte) bool {
+	return b < unicode.MaxASCII && (b == '_' || unicode.IsLetter(rune(b)) || unicode.IsDigit(rune(b)))
+}
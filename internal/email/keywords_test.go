@@ -0,0 +1,94 @@
+package email
+
+import (
+	"testing"
+
+	"mail-temp/internal/repository"
+)
+
+// TestDetectLanguage 优先使用Content-Language和HTML的lang属性，其次按文字系统和常见词判断
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		name    string
+		content *MessageContent
+		want    string
+	}{
+		{"Content-Language", &MessageContent{
+			Headers: []repository.Header{{Name: "content-language", Value: "de-DE, en"}},
+			Text:    "Your verification code is 123456",
+		}, "de"},
+		{"没有关键词的Content-Language", &MessageContent{
+			Headers: []repository.Header{{Name: "Content-Language", Value: "nl"}},
+			HTML:    `<html lang="fr"><body>Votre code</body></html>`,
+		}, "fr"},
+		{"HTML的lang属性", &MessageContent{HTML: `<!DOCTYPE html><html dir="ltr" lang='pt-BR'>`}, "pt"},
+		{"中文", &MessageContent{Subject: "验证码", Text: "您的验证码是 123456，请在10分钟内使用。https://example.com/verify?token=abcdef"}, "zh"},
+		{"日文", &MessageContent{Text: "認証コードは 123456 です。このコードを入力してください。"}, "ja"},
+		{"韩文", &MessageContent{Text: "인증번호는 123456 입니다. 人證"}, "ko"},
+		{"俄文", &MessageContent{Text: "Ваш код подтверждения: 123456"}, "ru"},
+		{"英文", &MessageContent{Text: "Please use this code to sign in to your account. The code is 123456."}, "en"},
+		{"德文", &MessageContent{Text: "Bitte geben Sie den Code ein. Das ist Ihr Bestätigungscode und er ist nicht übertragbar."}, "de"},
+		{"西班牙文", &MessageContent{Text: "Usa el código para iniciar sesión. Es tu código de verificación, por favor no lo compartas con usted."}, "es"},
+		{"常见词不足", &MessageContent{Text: "Code 123456"}, ""},
+		{"没有文字", &MessageContent{Text: "123456"}, ""},
+	}
+	for _, tt := range tests {
+		if got := DetectLanguage(tt.content); got != tt.want {
+			t.Errorf("%s: 期望%q，实际%q", tt.name, tt.want, got)
+		}
+	}
+}
+
+// TestCodeKeywordTables 每种语言都有连接词，并且关键词正则表达式能匹配该语言的关键词
+func TestCodeKeywordTables(t *testing.T) {
+	for lang, keywords := range codeKeywords {
+		if len(codeKeywordConnectors[lang]) == 0 {
+			t.Errorf("%s: 缺少连接词", lang)
+		}
+		set := labelSetFor(lang)
+		for _, keyword := range keywords {
+			if !set.before.MatchString("Your " + keyword + ":") {
+				t.Errorf("%s: 关键词%q没有匹配", lang, keyword)
+			}
+		}
+	}
+	if labelSetFor("xx") != codeLabelSets[""] {
+		t.Error("期望未知语言使用全部语言的关键词")
+	}
+}
+
+// TestCodeLabelSet 关键词按单词边界匹配，验证码后面的关键词可以带连接词
+func TestCodeLabelSet(t *testing.T) {
+	en := labelSetFor("en")
+	for text, want := range map[string]bool{
+		"Your code:":        true,
+		"Scan the barcode":  false,
+		"One time code":     true,
+		"one-time-passcode": true,
+		"Enter PIN":         true,
+		"spinning":          false,
+		"你的验证码":             true, // 默认语言包含中文
+	} {
+		if got := en.before.MatchString(text); got != want {
+			t.Errorf("before %q: 期望%v，实际%v", text, want, got)
+		}
+	}
+	for text, want := range map[string]bool{
+		" is your verification code": true,
+		": your code":                true,
+		" 为您的验证码":                    true,
+		" was sent":                  false,
+	} {
+		if got := en.after.MatchString(text); got != want {
+			t.Errorf("after %q: 期望%v，实际%v", text, want, got)
+		}
+	}
+
+	ja := labelSetFor("ja")
+	if !ja.after.MatchString(" が認証コード") {
+		t.Error("期望日文连接词和关键词匹配")
+	}
+	if labelSetFor("de").before.MatchString("Ваш код") {
+		t.Error("期望德文关键词不包含俄文")
+	}
+}
@@ -0,0 +1,251 @@
+package email
+
+import (
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"mail-temp/internal/repository"
+)
+
+const (
+	// 最少得分，低于该分数的链接不会被选为主链接
+	primaryLinkMinScore = 3
+	// 作为链接上下文的文本最大长度
+	maxLinkContextLength = 300
+)
+
+// linkKeyword 链接关键词及其类型、权重
+type linkKeyword struct {
+	pattern *regexp.Regexp
+	kind    string
+	weight  int
+}
+
+// 表示可操作链接的关键词，按类型区分
+var linkKeywords = []linkKeyword{
+	{regexp.MustCompile(`(?i)verif|验证|驗證`), "verify", 4},
+	{regexp.MustCompile(`(?i)confirm|确认|確認`), "confirm", 4},
+	{regexp.MustCompile(`(?i)activat|激活|啟用`), "activate", 4},
+	{regexp.MustCompile(`(?i)reset|recover|重置|找回`), "reset", 4},
+	{regexp.MustCompile(`(?i)magic|log\s?in|sign\s?in|signin|login|登录|登入|登陆`), "login", 3},
+	{regexp.MustCompile(`(?i)validat|authori[sz]e|approve`), "verify", 3},
+	{regexp.MustCompile(`(?i)invit|join|accept|邀请|加入`), "invite", 2},
+}
+
+// 明显不是操作链接的关键词
+var linkNegativePatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)unsubscribe|opt[-_]?out|退订|取消订阅`),
+	regexp.MustCompile(`(?i)preferences|privacy|terms|policy|help|support|faq|contact|隐私|条款|帮助`),
+	regexp.MustCompile(`(?i)^([a-z0-9-]+\.)*(facebook|twitter|x|linkedin|instagram|youtube|weibo|tiktok)\.com(/|\?|$)`),
+	regexp.MustCompile(`(?i)\.(png|jpe?g|gif|webp|svg|ico|css|js)(\?|$)`),
+}
+
+// 链接URL中表示一次性令牌的特征
+var (
+	linkTokenParamPattern = regexp.MustCompile(`(?i)(^|&)(token|code|key|otp|ticket|signature|sig|hash|nonce|t|k)=[^&]{6,}`)
+	linkTokenPathPattern  = regexp.MustCompile(`[A-Za-z0-9_\-]{24,}`)
+	textURLPattern        = regexp.MustCompile(`https?://[^\s<>"'` + "`" + `\x{3000}-\x{303f}\x{ff01}-\x{ff0f}\x{ff1a}-\x{ff20}]+`)
+)
+
+// linkCandidate 提取过程中的候选链接
+type linkCandidate struct {
+	url     string
+	text    string
+	context string
+	source  string // 来源：image表示图片中的二维码，attachment表示附件，为空表示正文
+}
+
+// extractLinks 从HTML、纯文本、附件（包括PDF）和图片中的二维码提取链接，排除退订等无关链接，按得分从高到低排序
+func extractLinks(htmlContent, textContent string, attachments []AttachmentText, images []repository.ImageCode) []repository.Link {
+	var candidates []linkCandidate
+	candidates = append(candidates, htmlLinkCandidates(htmlContent)...)
+	candidates = append(candidates, textLinkCandidates(textContent)...)
+	for _, attachment := range attachments {
+		for _, candidate := range textLinkCandidates(attachment.Text) {
+			candidate.source = SourceAttachment
+			candidates = append(candidates, candidate)
+		}
+	}
+	for _, image := range images {
+		if image.Kind == ImageCodeURL {
+			candidates = append(candidates, linkCandidate{url: image.Payload, source: SourceImage})
+		}
+	}
+
+	// 按URL合并，保留锚文本和最高得分
+	merged := make(map[string]*repository.Link)
+	var order []string
+	for _, candidate := range candidates {
+		link := scoreLink(candidate)
+		if link == nil {
+			continue
+		}
+
+		existing, ok := merged[link.URL]
+		if !ok {
+			merged[link.URL] = link
+			order = append(order, link.URL)
+			continue
+		}
+		if existing.Text == "" {
+			existing.Text = link.Text
+		}
+		if link.Score > existing.Score {
+			existing.Score = link.Score
+			existing.Kind = link.Kind
+		}
+	}
+
+	links := make([]repository.Link, 0, len(order))
+	for _, u := range order {
+		// 退订、隐私政策等链接不保留
+		if merged[u].Score >= 0 {
+			links = append(links, *merged[u])
+		}
+	}
+	sort.SliceStable(links, func(i, j int) bool {
+		return links[i].Score > links[j].Score
+	})
+	return links
+}
+
+// primaryLink 返回得分最高的可操作链接
+func primaryLink(links []repository.Link) string {
+	if len(links) > 0 && links[0].Score >= primaryLinkMinScore && links[0].Kind != "" {
+		return links[0].URL
+	}
+	return ""
+}
+
+// htmlLinkCandidates 从HTML锚点中提取候选链接
+func htmlLinkCandidates(content string) []linkCandidate {
+	if strings.TrimSpace(content) == "" {
+		return nil
+	}
+	doc, err := html.Parse(strings.NewReader(content))
+	if err != nil {
+		return nil
+	}
+
+	var candidates []linkCandidate
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.DataAtom == atom.A {
+			href := strings.TrimSpace(getAttr(n, "href"))
+			if isRemoteURL(href) {
+				// 父元素文本过长时（例如直接位于<body>下）不作为上下文
+				context := nodeText(n.Parent)
+				if len(context) > maxLinkContextLength {
+					context = ""
+				}
+				candidates = append(candidates, linkCandidate{
+					url:     href,
+					text:    nodeText(n),
+					context: getAttr(n, "title") + " " + context,
+				})
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	return candidates
+}
+
+// textLinkCandidates 从纯文本中提取候选链接，以所在行及上一行作为上下文
+func textLinkCandidates(content string) []linkCandidate {
+	var candidates []linkCandidate
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		for _, match := range textURLPattern.FindAllString(line, -1) {
+			context := line
+			if i > 0 {
+				context = lines[i-1] + " " + line
+			}
+			candidates = append(candidates, linkCandidate{
+				url:     strings.TrimRight(match, ".,;:!?)]}>'\""),
+				context: context,
+			})
+		}
+	}
+	return candidates
+}
+
+// scoreLink 根据关键词和URL特征为链接打分，不可用的链接返回nil
+func scoreLink(candidate linkCandidate) *repository.Link {
+	u, err := url.Parse(candidate.url)
+	if err != nil || u.Host == "" {
+		return nil
+	}
+
+	text := strings.TrimSpace(candidate.text)
+	location := u.Host + u.Path + "?" + u.RawQuery
+
+	for _, pattern := range linkNegativePatterns {
+		if pattern.MatchString(location) || pattern.MatchString(text) {
+			return &repository.Link{URL: candidate.url, Text: text, Score: -1}
+		}
+	}
+
+	link := &repository.Link{URL: candidate.url, Text: text, Source: candidate.source}
+	best := 0
+	for _, keyword := range linkKeywords {
+		score := 0
+		if keyword.pattern.MatchString(text) {
+			score += keyword.weight + 1 // 锚文本最可靠
+		}
+		if keyword.pattern.MatchString(u.Path + "?" + u.RawQuery) {
+			score += keyword.weight
+		}
+		if keyword.pattern.MatchString(candidate.context) {
+			score += keyword.weight / 2
+		}
+		if score > best {
+			best = score
+			link.Kind = keyword.kind
+		}
+	}
+	link.Score = best
+
+	// 带有一次性令牌的链接更可能是操作链接
+	if linkTokenParamPattern.MatchString(u.RawQuery) {
+		link.Score += 2
+	}
+	if linkTokenPathPattern.MatchString(u.Path) {
+		link.Score++
+	}
+	if u.Scheme == "https" {
+		link.Score++
+	}
+	// 专门编码在二维码中的链接通常就是要访问的链接
+	if candidate.source == SourceImage {
+		link.Score++
+	}
+	return link
+}
+
+// nodeText 获取节点的纯文本内容
+func nodeText(n *html.Node) string {
+	if n == nil {
+		return ""
+	}
+	var sb strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			sb.WriteString(n.Data)
+			sb.WriteString(" ")
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return strings.Join(strings.Fields(sb.String()), " ")
+}
@@ -0,0 +1,108 @@
+package email
+
+import (
+	"testing"
+
+	"mail-temp/internal/repository"
+)
+
+// linkURLs 返回链接列表中的地址
+func linkURLs(links []repository.Link) []string {
+	urls := make([]string, 0, len(links))
+	for _, link := range links {
+		urls = append(urls, link.URL)
+	}
+	return urls
+}
+
+// TestExtractLinksHTML 操作链接排在最前，退订、隐私政策、社交网站和图片链接被排除，同一地址只保留一次
+func TestExtractLinksHTML(t *testing.T) {
+	html := `<p>Welcome!</p>
+<p><a href="https://acme.example/account/verify?token=8f3a9c2e71">Verify email address</a></p>
+<p>Or paste <a href="https://acme.example/account/verify?token=8f3a9c2e71">this link</a></p>
+<p><a href="https://acme.example/blog">Read our blog</a></p>
+<p><a href="https://acme.example/unsubscribe?u=1">Unsubscribe</a> · <a href="https://acme.example/privacy">Privacy</a>
+<a href="https://twitter.com/acme">Twitter</a> <a href="https://cdn.acme.example/logo.png">logo</a>
+<a href="mailto:help@acme.example">mail us</a></p>`
+
+	links := extractLinks(html, "", nil, nil)
+	if len(links) != 2 {
+		t.Fatalf("期望2个链接，实际 %v", linkURLs(links))
+	}
+	verify := links[0]
+	if verify.URL != "https://acme.example/account/verify?token=8f3a9c2e71" || verify.Kind != "verify" || verify.Text != "Verify email address" {
+		t.Errorf("第一个链接不正确: %+v", verify)
+	}
+	if links[1].URL != "https://acme.example/blog" || links[1].Kind != "" {
+		t.Errorf("第二个链接不正确: %+v", links[1])
+	}
+	if got := primaryLink(links); got != verify.URL {
+		t.Errorf("期望主链接为验证链接，实际%q", got)
+	}
+}
+
+// TestExtractLinksKinds 按锚文本、地址和上下文中的关键词确定链接类型
+func TestExtractLinksKinds(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		text string
+		kind string
+	}{
+		{"锚文本", `<a href="https://x.example/go/abc">Reset your password</a>`, "", "reset"},
+		{"地址", `<a href="https://x.example/activate/abcdef">Click here</a>`, "", "activate"},
+		{"中文", `<a href="https://x.example/c/1">确认邮箱</a>`, "", "confirm"},
+		{"登录", `<a href="https://x.example/magic?k=abcdefgh">Sign in to ACME</a>`, "", "login"},
+		{"纯文本上下文", "", "To join the team, open:\nhttps://x.example/i/abcdefgh", "invite"},
+	}
+	for _, tt := range tests {
+		links := extractLinks(tt.html, tt.text, nil, nil)
+		if len(links) != 1 || links[0].Kind != tt.kind {
+			t.Errorf("%s: 期望类型%s，实际 %+v", tt.name, tt.kind, links)
+		}
+	}
+}
+
+// TestExtractLinksSources 纯文本中的链接去掉结尾标点，附件和二维码中的链接标注来源
+func TestExtractLinksSources(t *testing.T) {
+	text := "Confirm your account: https://acme.example/confirm?code=123456789).\n"
+	attachments := []AttachmentText{{Text: "Activate: https://acme.example/activate?token=abcdefgh"}}
+	images := []repository.ImageCode{
+		{Kind: ImageCodeURL, Payload: "https://acme.example/login?t=qrcode123"},
+		{Kind: ImageCodeOTPAuth, Payload: "otpauth://totp/x?secret=JBSWY3DPEHPK3PXP"},
+	}
+
+	sources := make(map[string]string)
+	for _, link := range extractLinks("", text, attachments, images) {
+		sources[link.URL] = link.Source
+	}
+	want := map[string]string{
+		"https://acme.example/confirm?code=123456789":  "",
+		"https://acme.example/activate?token=abcdefgh": SourceAttachment,
+		"https://acme.example/login?t=qrcode123":       SourceImage,
+	}
+	if len(sources) != len(want) {
+		t.Errorf("期望%d个链接，实际 %v", len(want), sources)
+	}
+	for u, source := range want {
+		if got, ok := sources[u]; !ok || got != source {
+			t.Errorf("%s: 期望来源%q，实际%q（存在: %v）", u, source, got, ok)
+		}
+	}
+}
+
+// TestPrimaryLinkThreshold 得分不足或没有类型的链接不作为主链接
+func TestPrimaryLinkThreshold(t *testing.T) {
+	for _, links := range [][]repository.Link{
+		nil,
+		{{URL: "https://x.example/", Kind: "", Score: 10}},
+		{{URL: "https://x.example/verify", Kind: "verify", Score: primaryLinkMinScore - 1}},
+	} {
+		if got := primaryLink(links); got != "" {
+			t.Errorf("期望没有主链接，实际%q", got)
+		}
+	}
+	if got := primaryLink([]repository.Link{{URL: "https://x.example/verify", Kind: "verify", Score: primaryLinkMinScore}}); got == "" {
+		t.Error("期望得分达到阈值的链接作为主链接")
+	}
+}
@@ -0,0 +1,179 @@
+package email
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+
+	"golang.org/x/text/encoding/htmlindex"
+
+	"mail-temp/internal/repository"
+)
+
+const (
+	// 嵌套邮件的最大解析深度
+	maxMessageDepth = 5
+	// 多部分邮件的最大部分数，防止恶意构造的邮件耗尽资源
+	maxMessageParts = 100
+)
+
+// parsedMessage 按MIME结构解析后的邮件
+type parsedMessage struct {
+	Headers     []repository.Header
+	Text        string           // 第一个非附件的text/plain部分
+	HTML        string           // 第一个非附件的text/html部分
+	Attachments []parsedPart     // 其他部分（附件、内嵌图片等）
+	Embedded    []*parsedMessage // 以message/rfc822形式嵌入的邮件
+	parts       int
+}
+
+// parsedPart 邮件中的附件部分
+type parsedPart struct {
+	Filename    string
+	ContentType string
+	ContentID   string
+	Data        []byte
+}
+
+// parseMessage 递归解析邮件的MIME结构
+func parseMessage(raw []byte) *parsedMessage {
+	return parseMessageDepth(raw, 0)
+}
+
+// parseMessageDepth 解析指定深度的邮件
+func parseMessageDepth(raw []byte, depth int) *parsedMessage {
+	msg := &parsedMessage{Headers: parseHeaders(raw)}
+
+	m, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		log.Printf("解析邮件结构失败: %v", err)
+		return msg
+	}
+
+	msg.walk(textproto.MIMEHeader(m.Header), m.Body, depth)
+	return msg
+}
+
+// Header 获取第一个指定名称的头部值（名称不区分大小写）
+func (m *parsedMessage) Header(name string) string {
+	for _, header := range m.Headers {
+		if strings.EqualFold(header.Name, name) {
+			return header.Value
+		}
+	}
+	return ""
+}
+
+// walk 遍历一个MIME实体
+func (m *parsedMessage) walk(header textproto.MIMEHeader, body io.Reader, depth int) {
+	m.parts++
+	if m.parts > maxMessageParts {
+		return
+	}
+
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextRawPart()
+			if err != nil {
+				if err != io.EOF {
+					log.Printf("读取邮件部分失败: %v", err)
+				}
+				return
+			}
+			m.walk(part.Header, part, depth)
+		}
+	}
+
+	data, err := io.ReadAll(decodeTransferEncoding(header.Get("Content-Transfer-Encoding"), body))
+	if err != nil {
+		log.Printf("解码邮件部分失败: %v", err)
+		return
+	}
+
+	disposition, dispositionParams, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+	filename := dispositionParams["filename"]
+	if filename == "" {
+		filename = params["name"]
+	}
+	attachment := disposition == "attachment" || filename != ""
+
+	switch {
+	case mediaType == "message/rfc822" || mediaType == "message/global":
+		if depth+1 > maxMessageDepth {
+			return
+		}
+		m.Embedded = append(m.Embedded, parseMessageDepth(data, depth+1))
+	case mediaType == "text/plain" && !attachment && m.Text == "":
+		m.Text = decodeCharset(data, params["charset"])
+	case mediaType == "text/html" && !attachment && m.HTML == "":
+		m.HTML = decodeCharset(data, params["charset"])
+	default:
+		m.Attachments = append(m.Attachments, parsedPart{
+			Filename:    decodeHeaderValue(filename),
+			ContentType: mediaType,
+			ContentID:   strings.Trim(header.Get("Content-Id"), "<> "),
+			Data:        data,
+		})
+	}
+}
+
+// decodeTransferEncoding 按Content-Transfer-Encoding解码
+func decodeTransferEncoding(encoding string, r io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, &base64Cleaner{r: r})
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	default:
+		return r
+	}
+}
+
+// decodeCharset 将指定字符集的内容转换为UTF-8
+func decodeCharset(data []byte, charset string) string {
+	charset = strings.ToLower(strings.TrimSpace(charset))
+	if charset == "" || charset == "utf-8" || charset == "us-ascii" {
+		return string(data)
+	}
+
+	encoding, err := htmlindex.Get(charset)
+	if err != nil {
+		return string(data)
+	}
+	decoded, err := encoding.NewDecoder().Bytes(data)
+	if err != nil {
+		return string(data)
+	}
+	return string(decoded)
+}
+
+// base64Cleaner 过滤Base64内容中的非法字符（换行、空格等）
+type base64Cleaner struct {
+	r io.Reader
+}
+
+// Read 实现io.Reader接口
+func (c *base64Cleaner) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	kept := 0
+	for _, b := range p[:n] {
+		if (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z') || (b >= '0' && b <= '9') || b == '+' || b == '/' || b == '=' {
+			p[kept] = b
+			kept++
+		}
+	}
+	return kept, err
+}
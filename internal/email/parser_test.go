@@ -0,0 +1,148 @@
+package email
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestParseMessageMultipart 多部分邮件取第一个非附件的正文部分，按传输编码和字符集解码，其余部分作为附件
+func TestParseMessageMultipart(t *testing.T) {
+	raw := "Subject: test\r\n" +
+		"Content-Type: multipart/mixed; boundary=outer\r\n" +
+		"\r\n" +
+		"--outer\r\n" +
+		"Content-Type: multipart/alternative; boundary=inner\r\n" +
+		"\r\n" +
+		"--inner\r\n" +
+		"Content-Type: text/plain; charset=gb2312\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		"xPq1xNHp1qTC68rH\r\nIDQ4MjkxMw==\r\n" +
+		"--inner\r\n" +
+		"Content-Type: text/html; charset=ISO-8859-1\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n" +
+		"\r\n" +
+		"<p>C=F3digo: 482913 v=E1li=\r\ndo</p>\r\n" +
+		"--inner--\r\n" +
+		"--outer\r\n" +
+		"Content-Type: text/plain; name=\"=?UTF-8?B?5pS25o2uLnR4dA==?=\"\r\n" +
+		"Content-Disposition: attachment\r\n" +
+		"\r\n" +
+		"attached text\r\n" +
+		"--outer\r\n" +
+		"Content-Type: image/png\r\n" +
+		"Content-ID: <logo@example>\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		"iVBO\r\nRw0K\r\n" +
+		"--outer--\r\n"
+
+	msg := parseMessage([]byte(raw))
+	if msg.Text != "您的验证码是 482913" {
+		t.Errorf("期望解码GB2312正文，实际%q", msg.Text)
+	}
+	if strings.TrimSpace(msg.HTML) != "<p>Código: 482913 válido</p>" {
+		t.Errorf("期望解码ISO-8859-1的HTML，实际%q", msg.HTML)
+	}
+	if len(msg.Attachments) != 2 {
+		t.Fatalf("期望2个附件，实际 %+v", msg.Attachments)
+	}
+	if a := msg.Attachments[0]; a.Filename != "收据.txt" || a.ContentType != "text/plain" || strings.TrimSpace(string(a.Data)) != "attached text" {
+		t.Errorf("文本附件不正确: %+v", a)
+	}
+	if a := msg.Attachments[1]; a.ContentID != "logo@example" || string(a.Data) != "\x89PNG\r\n" {
+		t.Errorf("内嵌图片不正确: %+v", a)
+	}
+}
+
+// TestParseMessageSinglePart 没有Content-Type时按text/plain处理，无效的邮件只保留能解析的头部
+func TestParseMessageSinglePart(t *testing.T) {
+	msg := parseMessage([]byte("Subject: =?utf-8?q?hi?=\r\n\r\nYour code is 482913\r\n"))
+	if msg.Header("subject") != "hi" || strings.TrimSpace(msg.Text) != "Your code is 482913" {
+		t.Errorf("解析结果不正确: %+v", msg)
+	}
+
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	msg = parseMessage([]byte("no headers here"))
+	if msg.Text != "" || msg.HTML != "" || len(msg.Attachments) != 0 {
+		t.Errorf("期望无效邮件没有正文，实际 %+v", msg)
+	}
+}
+
+// TestDecodeCharset 未知字符集和UTF-8原样返回
+func TestDecodeCharset(t *testing.T) {
+	for _, tt := range []struct {
+		data, charset, want string
+	}{
+		{"\xd1\xe9\xd6\xa4\xc2\xeb", "GBK", "验证码"},
+		{"\xf0\xd2\xc9\xd7\xc5\xd4", "koi8-r", "Привет"},
+		{"héllo", "UTF-8", "héllo"},
+		{"plain", "x-unknown", "plain"},
+	} {
+		if got := decodeCharset([]byte(tt.data), tt.charset); got != tt.want {
+			t.Errorf("%s: 期望%q，实际%q", tt.charset, tt.want, got)
+		}
+	}
+}
+
+// embeddedMessage 构造一封把inner作为message/rfc822附件转发的邮件，分隔符带上主题以便多层嵌套
+func embeddedMessage(subject, inner string) string {
+	boundary := "fwd-" + strings.NewReplacer(" ", "-", ":", "").Replace(subject)
+	return "Subject: " + subject + "\r\n" +
+		"Content-Type: multipart/mixed; boundary=" + boundary + "\r\n" +
+		"\r\n" +
+		"--" + boundary + "\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"See the forwarded message.\r\n" +
+		"--" + boundary + "\r\n" +
+		"Content-Type: message/rfc822\r\n" +
+		"Content-Disposition: attachment; filename=\"original.eml\"\r\n" +
+		"\r\n" +
+		inner + "\r\n" +
+		"--" + boundary + "--\r\n"
+}
+
+// TestParseMessageEmbedded 以message/rfc822附件转发的邮件被解析为嵌入邮件，而不是附件或正文
+func TestParseMessageEmbedded(t *testing.T) {
+	inner := "From: ACME <no-reply@acme.example>\r\nSubject: Your code\r\nDate: Mon, 1 Jan 2024 00:00:00 +0000\r\n\r\nYour code is 482913"
+	msg := parseMessage([]byte(embeddedMessage("Fwd: Your code", inner)))
+
+	if strings.TrimSpace(msg.Text) != "See the forwarded message." {
+		t.Errorf("外层正文不正确: %q", msg.Text)
+	}
+	if len(msg.Attachments) != 0 {
+		t.Errorf("期望没有附件，实际 %+v", msg.Attachments)
+	}
+	if len(msg.Embedded) != 1 {
+		t.Fatalf("期望1封嵌入邮件，实际%d封", len(msg.Embedded))
+	}
+	embedded := msg.Embedded[0]
+	if embedded.Header("From") != "ACME <no-reply@acme.example>" || embedded.Header("Subject") != "Your code" {
+		t.Errorf("嵌入邮件头部不正确: %+v", embedded.Headers)
+	}
+	if strings.TrimSpace(embedded.Text) != "Your code is 482913" {
+		t.Errorf("嵌入邮件正文不正确: %q", embedded.Text)
+	}
+}
+
+// TestParseMessageEmbeddedDepth 嵌套超过最大深度的邮件不再解析
+func TestParseMessageEmbeddedDepth(t *testing.T) {
+	raw := "Subject: innermost\r\n\r\nYour code is 482913"
+	for i := 0; i < maxMessageDepth+2; i++ {
+		raw = embeddedMessage(fmt.Sprintf("Fwd %d", i), raw)
+	}
+
+	depth := 0
+	for msg := parseMessage([]byte(raw)); len(msg.Embedded) > 0; msg = msg.Embedded[0] {
+		depth++
+	}
+	if depth != maxMessageDepth {
+		t.Errorf("期望最多解析%d层嵌入邮件，实际%d层", maxMessageDepth, depth)
+	}
+}
@@ -0,0 +1,257 @@
+package email
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"strings"
+
+	"github.com/ledongthuc/pdf"
+
+	"mail-temp/internal/repository"
+)
+
+const (
+	// 解析的PDF附件最大字节数
+	maxPDFBytes = 5 << 20
+	// 每封邮件最多解析的PDF附件数
+	maxPDFAttachments = 3
+	// 每个PDF最多解析的页数
+	maxPDFPages = 20
+	// 每个PDF最多提取的文本字节数，验证码通常在第一页
+	maxPDFTextBytes = 64 << 10
+	// 每个PDF最多解释的内容流操作符数，防止构造的内容流长时间占用CPU
+	maxPDFOperators = 200000
+	// 保存的文本片段中验证码前后的字节数
+	pdfSnippetContext = 160
+	// 没有验证码时保存的文本开头字节数
+	pdfSnippetHeadBytes = 320
+)
+
+// errPDFLimit 文本或操作符数量达到上限，停止解析
+var errPDFLimit = errors.New("PDF内容超过上限")
+
+// isPDFPart 判断附件是否是PDF：按Content-Type，或文件名为.pdf且内容以%PDF-开头
+func isPDFPart(part parsedPart) bool {
+	if part.ContentType == "application/pdf" || part.ContentType == "application/x-pdf" {
+		return true
+	}
+	return strings.HasSuffix(strings.ToLower(part.Filename), ".pdf") && bytes.HasPrefix(part.Data, []byte("%PDF-"))
+}
+
+// pdfText 提取PDF中的文本，按行输出；PDF过大、加密、无法解析或没有文本时返回false
+func pdfText(data []byte) (text string, pages int, ok bool) {
+	if len(data) == 0 || len(data) > maxPDFBytes {
+		return "", 0, false
+	}
+
+	// 解析库在处理畸形文件时会panic，不能影响邮件接收
+	extractor := &pdfTextExtractor{}
+	defer func() {
+		if r := recover(); r != nil {
+			if r != errPDFLimit {
+				log.Printf("解析PDF失败: %v", r)
+			}
+			text, pages = extractor.text(), extractor.pages
+			ok = text != ""
+		}
+	}()
+
+	reader, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		log.Printf("无法打开PDF: %v", err)
+		return "", 0, false
+	}
+	n := reader.NumPage()
+	if n > maxPDFPages {
+		n = maxPDFPages
+	}
+	for i := 1; i <= n; i++ {
+		page := reader.Page(i)
+		if page.V.IsNull() {
+			break
+		}
+		extractor.pages = i
+		extractor.page(page)
+	}
+	text = extractor.text()
+	return text, extractor.pages, text != ""
+}
+
+// pdfTextExtractor 解释页面内容流中的文本操作符
+type pdfTextExtractor struct {
+	sb        strings.Builder
+	pages     int
+	operators int
+}
+
+// page 提取一页的文本，页面之间用空行分隔
+func (e *pdfTextExtractor) page(page pdf.Page) {
+	encoders := make(map[string]pdf.TextEncoding)
+	var enc pdf.TextEncoding
+	lastY, hasY := 0.0, false
+
+	show := func(raw string) {
+		if enc == nil {
+			e.write(raw)
+		} else {
+			e.write(enc.Decode(raw))
+		}
+	}
+	newline := func() {
+		e.write("\n")
+	}
+
+	interpret := func(stk *pdf.Stack, op string) {
+		e.operators++
+		if e.operators > maxPDFOperators {
+			panic(errPDFLimit)
+		}
+		args := make([]pdf.Value, stk.Len())
+		for i := len(args) - 1; i >= 0; i-- {
+			args[i] = stk.Pop()
+		}
+
+		switch op {
+		case "Tf": // 字体
+			if len(args) != 2 {
+				return
+			}
+			name := args[0].Name()
+			if _, ok := encoders[name]; !ok {
+				encoders[name] = page.Font(name).Encoder()
+			}
+			enc = encoders[name]
+		case "Td", "TD": // 相对移动：纵向移动表示换行
+			if len(args) != 2 {
+				return
+			}
+			if args[1].Float64() != 0 {
+				newline()
+			} else {
+				e.write(" ")
+			}
+		case "Tm": // 文本矩阵：纵坐标变化表示换行
+			if len(args) != 6 {
+				return
+			}
+			y := args[5].Float64()
+			if hasY && y != lastY {
+				newline()
+			} else {
+				e.write(" ")
+			}
+			lastY, hasY = y, true
+		case "T*":
+			newline()
+		case "'", "\"": // 换行并显示文本
+			if len(args) == 0 {
+				return
+			}
+			newline()
+			show(args[len(args)-1].RawString())
+		case "Tj":
+			if len(args) != 1 {
+				return
+			}
+			show(args[0].RawString())
+		case "TJ": // 带字距调整的文本，较大的间距视为空格
+			if len(args) != 1 {
+				return
+			}
+			for i := 0; i < args[0].Len(); i++ {
+				item := args[0].Index(i)
+				if item.Kind() == pdf.String {
+					show(item.RawString())
+				} else if item.Float64() < -200 {
+					e.write(" ")
+				}
+			}
+		case "ET":
+			e.write(" ")
+		}
+	}
+
+	// 页面内容可以是一个流或多个流组成的数组
+	contents := page.V.Key("Contents")
+	if contents.Kind() == pdf.Array {
+		for i := 0; i < contents.Len(); i++ {
+			pdf.Interpret(contents.Index(i), interpret)
+		}
+	} else {
+		pdf.Interpret(contents, interpret)
+	}
+	e.write("\n\n")
+}
+
+// write 追加文本，超过上限时停止解析
+func (e *pdfTextExtractor) write(s string) {
+	if e.sb.Len()+len(s) > maxPDFTextBytes {
+		panic(errPDFLimit)
+	}
+	e.sb.WriteString(s)
+}
+
+// text 返回整理后的文本：合并行内空白，去除空行
+func (e *pdfTextExtractor) text() string {
+	var lines []string
+	for _, line := range strings.Split(strings.ToValidUTF8(e.sb.String(), ""), "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// pdfAttachmentTexts 提取PDF附件的文本
+func pdfAttachmentTexts(parts []parsedPart) []AttachmentText {
+	var texts []AttachmentText
+	for _, part := range parts {
+		if !isPDFPart(part) {
+			continue
+		}
+		if len(texts) >= maxPDFAttachments {
+			break
+		}
+		text, pages, ok := pdfText(part.Data)
+		if !ok {
+			continue
+		}
+		log.Printf("从PDF附件%s中提取到%d页文本，长度: %d", part.Filename, pages, len(text))
+		texts = append(texts, AttachmentText{
+			Filename:    part.Filename,
+			ContentType: "application/pdf",
+			Pages:       pages,
+			Text:        text,
+		})
+	}
+	return texts
+}
+
+// pdfSnippets 为PDF附件生成保存的文本片段：包含验证码时取验证码附近的内容，否则取开头
+func pdfSnippets(attachments []AttachmentText, display string) []repository.PDFText {
+	var texts []repository.PDFText
+	for _, attachment := range attachments {
+		if attachment.ContentType != "application/pdf" {
+			continue
+		}
+		text := repository.PDFText{
+			Filename: attachment.Filename,
+			Pages:    attachment.Pages,
+			Snippet:  truncateUTF8(attachment.Text, pdfSnippetHeadBytes),
+		}
+		if i := strings.Index(attachment.Text, display); display != "" && i >= 0 {
+			start, end := i-pdfSnippetContext, i+len(display)+pdfSnippetContext
+			if start < 0 {
+				start = 0
+			}
+			if end > len(attachment.Text) {
+				end = len(attachment.Text)
+			}
+			text.Snippet = strings.TrimSpace(strings.ToValidUTF8(attachment.Text[start:end], ""))
+			text.ContainsCode = true
+		}
+		texts = append(texts, text)
+	}
+	return texts
+}
@@ -0,0 +1,159 @@
+package email
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"mail-temp/internal/repository"
+)
+
+// Pipeline 邮件解析和提取流程：MIME解析、正文清理、操作链接和验证码提取，
+// SMTP接收和离线评估（eval-extraction）共用
+type Pipeline struct {
+	extractor *CodeExtractorChain
+}
+
+// NewPipeline 创建邮件处理流程
+func NewPipeline(extractor *CodeExtractorChain) *Pipeline {
+	return &Pipeline{
+		extractor: extractor,
+	}
+}
+
+// Extractor 返回流程使用的验证码提取器链
+func (p *Pipeline) Extractor() *CodeExtractorChain {
+	return p.extractor
+}
+
+// Process 解析mail.Raw中的原始邮件，填充头部、主题、正文、操作链接和验证码；
+// data为不含本服务Received头的邮件内容，用于结构化解析失败时的回退
+func (p *Pipeline) Process(mail *Mail, data string) {
+	// 按MIME结构解析邮件，得到头部、主题、清理后的正文、附件文本和图片中的二维码
+	parsed := parseMessage(mail.Raw)
+	content := contentOf(parsed, data)
+	mail.Headers = content.Headers
+	mail.Subject = content.Subject
+
+	// 保存处理后的HTML内容
+	if content.HTML != "" {
+		mail.HtmlContent = content.HTML
+		log.Printf("成功设置HTML内容，长度: %d", len(content.HTML))
+	}
+	mail.TextContent = content.Text
+	mail.ImageCodes = content.Images
+
+	// 提取验证、激活、登录等操作链接
+	mail.Links = extractLinks(content.HTML, content.Text, content.Attachments, content.Images)
+	mail.PrimaryLink = primaryLink(mail.Links)
+
+	// 提取注册两步验证时发送的otpauth://链接或密钥
+	if content.From == "" {
+		content.From = mail.From
+	}
+	mail.TOTPKeys = extractTOTPKeys(content.Text, parsed.HTML, content.Images, content.From, mail.To)
+
+	// 解析嵌入的邮件（例如作为附件转发的邮件）
+	mail.EmbeddedMessages = p.embeddedMessages(parsed.Embedded, mail.Timestamp)
+
+	// 提取验证码：以纯文本正文作为主要输入，没有正文时直接使用原始数据
+	if content.Text == "" && len(mail.EmbeddedMessages) == 0 {
+		content.Text = data
+	}
+	mail.CodeCandidates = withoutTOTPSecrets(p.extractCodes(content), mail.TOTPKeys)
+	if chosen, ok := chooseCode(mail.CodeCandidates); ok {
+		mail.Code, mail.CodeDisplay = chosen.Code, chosen.Display
+		mail.CodeExpiresAt = expiryPointer(DetectCodeExpiry(content, mail.CodeDisplay, mail.Timestamp))
+		log.Printf("提取到验证码: %s", mail.Code)
+	} else if embedded := firstEmbeddedCode(mail.EmbeddedMessages); embedded != nil {
+		// 外层邮件没有验证码时，使用嵌入邮件中的
+		mail.Code, mail.CodeDisplay = embedded.Code, embedded.CodeDisplay
+		mail.CodeCandidates = embedded.CodeCandidates
+		mail.CodeExpiresAt = parseExpiry(embedded.CodeExpiresAt)
+		log.Printf("从嵌入的邮件中提取到验证码: %s", mail.Code)
+	} else {
+		log.Println("无法从邮件中提取验证码")
+	}
+	mail.PDFTexts = pdfSnippets(content.Attachments, mail.CodeDisplay)
+
+	// 启发式结果不够可信时，保存后在后台运行AI提取，不阻塞SMTP会话
+	mail.ExtractionStatus = ExtractionDone
+	if strings.TrimSpace(content.Text) != "" && p.extractor.NeedsDeferred(mail.CodeCandidates) {
+		mail.ExtractionStatus = ExtractionPending
+		mail.content = content
+	}
+
+	// 外层邮件没有操作链接时，使用嵌入邮件中的
+	if mail.PrimaryLink == "" {
+		for _, embedded := range mail.EmbeddedMessages {
+			if embedded.PrimaryLink != "" {
+				mail.PrimaryLink = embedded.PrimaryLink
+				break
+			}
+		}
+	}
+	if mail.PrimaryLink != "" {
+		log.Printf("提取到操作链接: %s", mail.PrimaryLink)
+	}
+}
+
+// embeddedMessages 将解析出的嵌入邮件转换为存储格式，并提取各自的验证码；received为外层邮件的接收时间
+func (p *Pipeline) embeddedMessages(messages []*parsedMessage, received time.Time) []repository.EmbeddedMessage {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	result := make([]repository.EmbeddedMessage, 0, len(messages))
+	for _, msg := range messages {
+		content := contentOf(msg, "")
+		embedded := repository.EmbeddedMessage{
+			From:             content.From,
+			To:               msg.Header("To"),
+			Subject:          content.Subject,
+			Date:             msg.Header("Date"),
+			TextContent:      content.Text,
+			HtmlContent:      content.HTML,
+			Headers:          content.Headers,
+			ImageCodes:       content.Images,
+			EmbeddedMessages: p.embeddedMessages(msg.Embedded, received),
+		}
+		embedded.CodeCandidates = p.extractCodes(content)
+		if chosen, ok := chooseCode(embedded.CodeCandidates); ok {
+			embedded.Code, embedded.CodeDisplay = chosen.Code, chosen.Display
+			expiresAt := DetectCodeExpiry(content, embedded.CodeDisplay, embeddedReceivedTime(embedded.Date, received))
+			embedded.CodeExpiresAt = formatExpiry(&expiresAt)
+		} else if nested := firstEmbeddedCode(embedded.EmbeddedMessages); nested != nil {
+			embedded.Code, embedded.CodeDisplay = nested.Code, nested.CodeDisplay
+			embedded.CodeCandidates = nested.CodeCandidates
+			embedded.CodeExpiresAt = nested.CodeExpiresAt
+		}
+		embedded.PDFTexts = pdfSnippets(content.Attachments, embedded.CodeDisplay)
+		embedded.Links = extractLinks(content.HTML, content.Text, content.Attachments, content.Images)
+		embedded.PrimaryLink = primaryLink(embedded.Links)
+
+		log.Printf("解析到嵌入的邮件: From=%s, Subject=%s, Code=%s", embedded.From, embedded.Subject, embedded.Code)
+		result = append(result, embedded)
+	}
+	return result
+}
+
+// extractCodes 使用配置的提取器链提取验证码候选
+func (p *Pipeline) extractCodes(content *MessageContent) []repository.CodeCandidate {
+	if strings.TrimSpace(content.Subject+content.Text+content.HTML) == "" && len(content.Attachments) == 0 {
+		return nil
+	}
+	candidates := p.extractor.Extract(context.Background(), content)
+	logCodeCandidates(candidates)
+	return candidates
+}
+
+// firstEmbeddedCode 返回第一个带有验证码的嵌入邮件
+func firstEmbeddedCode(messages []repository.EmbeddedMessage) *repository.EmbeddedMessage {
+	for i := range messages {
+		if messages[i].Code != "" {
+			return &messages[i]
+		}
+	}
+	return nil
+}
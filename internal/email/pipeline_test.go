@@ -0,0 +1,56 @@
+package email
+
+import (
+	"io"
+	"log"
+	"os"
+	"testing"
+	"time"
+)
+
+// newTestPipeline 创建使用regex和html提取器的处理流程
+func newTestPipeline(t *testing.T) *Pipeline {
+	t.Helper()
+	extractor, err := NewCodeExtractorChain([]string{"regex", "html"}, ExtractorOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewPipeline(extractor)
+}
+
+// TestProcessEmbeddedMessage 外层邮件没有验证码和操作链接时，使用嵌入邮件中的，并按嵌入邮件的发送时间计算有效期
+func TestProcessEmbeddedMessage(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	inner := "From: ACME <no-reply@acme.example>\r\n" +
+		"Subject: Verify your account\r\n" +
+		"Date: Mon, 1 Jan 2024 00:00:00 +0000\r\n" +
+		"Content-Type: text/html\r\n" +
+		"\r\n" +
+		`<p>Your verification code is 482913. It expires in 10 minutes.</p><p><a href="https://acme.example/verify?token=abc">Verify email</a></p>`
+	raw := embeddedMessage("Fwd: Verify your account", inner)
+	received := time.Date(2024, 1, 1, 0, 5, 0, 0, time.UTC)
+	mail := &Mail{From: "me@t.test", To: "inbox@t.test", Timestamp: received, Raw: []byte(raw)}
+	newTestPipeline(t).Process(mail, raw)
+
+	if len(mail.EmbeddedMessages) != 1 {
+		t.Fatalf("期望1封嵌入邮件，实际%d封", len(mail.EmbeddedMessages))
+	}
+	embedded := mail.EmbeddedMessages[0]
+	if embedded.From != "ACME <no-reply@acme.example>" || embedded.Subject != "Verify your account" || embedded.Code != "482913" {
+		t.Errorf("嵌入邮件不正确: %+v", embedded)
+	}
+	if embedded.CodeExpiresAt != "2024-01-01T00:10:00Z" {
+		t.Errorf("期望按嵌入邮件的发送时间计算有效期，实际%q", embedded.CodeExpiresAt)
+	}
+	if mail.Code != "482913" || len(mail.CodeCandidates) == 0 {
+		t.Errorf("期望外层邮件使用嵌入邮件的验证码，实际%q", mail.Code)
+	}
+	if mail.CodeExpiresAt == nil || !mail.CodeExpiresAt.Equal(time.Date(2024, 1, 1, 0, 10, 0, 0, time.UTC)) {
+		t.Errorf("期望外层邮件使用嵌入邮件的有效期，实际%v", mail.CodeExpiresAt)
+	}
+	if mail.PrimaryLink != "https://acme.example/verify?token=abc" {
+		t.Errorf("期望外层邮件使用嵌入邮件的操作链接，实际%q", mail.PrimaryLink)
+	}
+}
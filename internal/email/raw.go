@@ -0,0 +1,37 @@
+package email
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"log"
+)
+
+// compressRaw 使用gzip压缩原始邮件
+func compressRaw(raw []byte) []byte {
+	if len(raw) == 0 {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write(raw); err != nil {
+		log.Printf("压缩原始邮件失败: %v", err)
+		return nil
+	}
+	if err := writer.Close(); err != nil {
+		log.Printf("压缩原始邮件失败: %v", err)
+		return nil
+	}
+	return buf.Bytes()
+}
+
+// decompressRaw 解压原始邮件
+func decompressRaw(compressed []byte) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
@@ -1,52 +1,136 @@
 package email
 
 import (
+	"html"
 	"log"
-	"regexp"
+	"strings"
 	"time"
 
 	"mail-temp/config"
+	"mail-temp/internal/imageproxy"
+	"mail-temp/internal/llm"
 	"mail-temp/internal/repository"
 )
 
 // EmailReceiver 邮件接收器
 type EmailReceiver struct {
-	config      *config.Config
-	generator   *EmailGenerator
-	codePattern *regexp.Regexp
-	storage     repository.EmailStorage
-	smtpServer  *SMTPServer
+	config     *config.Config
+	generator  *EmailGenerator
+	pipeline   *Pipeline
+	storage    repository.EmailStorage
+	smtpServer *SMTPServer
+	events     *EventBus
+	extraction *extractionPool
+	ai         *aiBackend        // 未配置模型服务时为nil
+	imageProxy *imageproxy.Proxy // 为nil时展示邮件不改写远程图片地址
 }
 
 // Mail 存储邮件信息
 type Mail struct {
-	From        string    `json:"from"`
-	To          string    `json:"to"`
-	Subject     string    `json:"subject"`
-	Body        string    `json:"body"`
-	HtmlContent string    `json:"htmlContent,omitempty"` // 处理后的HTML内容
-	Code        string    `json:"code,omitempty"`
-	Timestamp   time.Time `json:"timestamp"`
+	ID             string                     `json:"id"`
+	From           string                     `json:"from"`
+	To             string                     `json:"to"`
+	Subject        string                     `json:"subject"`
+	Body           string                     `json:"body"`
+	TextContent    string                     `json:"textContent,omitempty"`    // 纯文本正文
+	HtmlContent    string                     `json:"htmlContent,omitempty"`    // 处理后的HTML内容
+	Code           string                     `json:"code,omitempty"`           // 去除分隔符后的验证码
+	CodeDisplay    string                     `json:"codeDisplay,omitempty"`    // 验证码在邮件中的原始写法，例如"123 456"
+	CodeCandidates []repository.CodeCandidate `json:"codeCandidates,omitempty"` // 所有验证码候选，按得分排序
+	CodeExpiresAt  *time.Time                 `json:"codeExpiresAt,omitempty"`  // 按邮件中的有效期计算的过期时间
+	CodeExpired    bool                       `json:"codeExpired,omitempty"`    // 读取时验证码是否已过期
+	Timestamp      time.Time                  `json:"timestamp"`
+	Raw            []byte                     `json:"-"` // 原始邮件字节，只在接收时存在
+
+	ExtractionStatus string          `json:"extractionStatus,omitempty"` // 验证码提取状态：pending/done/failed/skipped
+	content          *MessageContent // 提取验证码使用的内容，只在接收时存在，供后台提取使用
+
+	Headers          []repository.Header          `json:"headers,omitempty"`          // 按原始顺序保存的邮件头部
+	EmbeddedMessages []repository.EmbeddedMessage `json:"embeddedMessages,omitempty"` // 以附件形式嵌入的邮件
+	Links            []repository.Link            `json:"links,omitempty"`            // 可操作链接，按得分排序
+	PrimaryLink      string                       `json:"primaryLink,omitempty"`      // 最可能的操作链接
+	ImageCodes       []repository.ImageCode       `json:"imageCodes,omitempty"`       // 图片中解码出的二维码、条形码
+	TOTPKeys         []repository.TOTPKey         `json:"totpKeys,omitempty"`         // 两步验证（TOTP）密钥
+	PDFTexts         []repository.PDFText         `json:"pdfTexts,omitempty"`         // PDF附件中提取的文本片段
 }
 
 // NewEmailReceiver 创建邮件接收器
-func NewEmailReceiver(cfg *config.Config, generator *EmailGenerator, storage repository.EmailStorage) (*EmailReceiver, error) {
-	// 编译验证码匹配正则表达式
-	codePattern, err := regexp.Compile(`\b\d{4,8}\b`) // 匹配4-8位数字作为验证码
+func NewEmailReceiver(cfg *config.Config, generator *EmailGenerator, storage repository.EmailStorage, imageProxy *imageproxy.Proxy) (*EmailReceiver, error) {
+	extractor, ai, err := newConfiguredExtractor(cfg)
 	if err != nil {
 		return nil, err
 	}
 
 	receiver := &EmailReceiver{
-		config:      cfg,
-		generator:   generator,
-		codePattern: codePattern,
-		storage:     storage,
+		config:     cfg,
+		generator:  generator,
+		pipeline:   NewPipeline(extractor),
+		storage:    storage,
+		events:     NewEventBus(),
+		ai:         ai,
+		imageProxy: imageProxy,
 	}
+	receiver.extraction = newExtractionPool(extractor, storage, receiver.events, cfg.LLMWorkers, cfg.LLMQueueSize)
 
 	return receiver, nil
 }
 
+// aiBackend AI模型服务的熔断器和回复缓存，用于查看健康状态
+type aiBackend struct {
+	breaker *llm.Breaker
+	cache   *llm.CachedProvider
+}
+
+// NewConfiguredExtractor 按配置创建验证码提取器链，包括AI模型服务和按发件人配置的规则
+func NewConfiguredExtractor(cfg *config.Config) (*CodeExtractorChain, error) {
+	extractor, _, err := newConfiguredExtractor(cfg)
+	return extractor, err
+}
+
+// newConfiguredExtractor 按配置创建验证码提取器链，未配置模型服务时返回的aiBackend为nil
+func newConfiguredExtractor(cfg *config.Config) (*CodeExtractorChain, *aiBackend, error) {
+	codes := NewCodeFinder(cfg.CodeMinLength, cfg.CodeMaxLength)
+	opts := ExtractorOptions{Codes: codes, Prompt: cfg.LLMPrompt}
+	var ai *aiBackend
+	if cfg.LLMAPIURL != "" {
+		provider, err := llm.NewProvider(llm.Options{
+			Provider: cfg.LLMProvider,
+			URL:      cfg.LLMAPIURL,
+			APIKey:   cfg.LLMAPIKey,
+			Model:    cfg.LLMModel,
+			Timeout:  cfg.LLMTimeout,
+			Retries:  cfg.LLMRetries,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// 模型服务不可用时熔断，相同内容的邮件使用缓存的回复
+		breaker := llm.NewBreaker(provider, cfg.LLMBreakerThreshold, cfg.LLMBreakerCooldown)
+		ai = &aiBackend{
+			breaker: breaker,
+			cache:   llm.NewCachedProvider(breaker, cfg.LLMCacheSize, cfg.LLMCacheTTL),
+		}
+		opts.LLM = ai.cache
+		log.Printf("AI验证码提取使用模型服务: %s (%s)", provider.Name(), cfg.LLMAPIURL)
+	}
+
+	extractor, err := NewCodeExtractorChain(cfg.CodeExtractors, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// 按发件人配置的规则优先于通用的启发式提取
+	if cfg.CodeRulesFile != "" {
+		rules, err := NewRuleExtractor(cfg.CodeRulesFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		extractor.Prepend(rules)
+	}
+	return extractor, ai, nil
+}
+
 // Connect 启动SMTP服务器
 func (r *EmailReceiver) Connect() error {
 	// 使用配置的SMTP端口，默认为25
@@ -55,7 +139,7 @@ func (r *EmailReceiver) Connect() error {
 		port = r.config.SMTPPort
 	}
 
-	r.smtpServer = NewSMTPServer(r.config.MailDomain, port, r.generator)
+	r.smtpServer = NewSMTPServer(r.config.MailDomain, port, r.generator, r.pipeline)
 	go func() {
 		if err := r.smtpServer.Start(); err != nil {
 			log.Printf("SMTP服务器启动失败: %v", err)
@@ -69,6 +153,7 @@ func (r *EmailReceiver) Close() {
 	if r.smtpServer != nil {
 		r.smtpServer.Stop()
 	}
+	r.extraction.Close()
 }
 
 // StartListening 开始监听新邮件
@@ -77,47 +162,61 @@ func (r *EmailReceiver) StartListening(interval time.Duration) {
 	go func() {
 		mailCh := r.smtpServer.GetMailChannel()
 		for mail := range mailCh {
-			// 从收件人地址中提取用户名
-			var username string
-			for i, c := range mail.To {
-				if c == '@' {
-					username = mail.To[:i]
-					break
-				}
-			}
-
-			// 转换为存储格式
-			message := &repository.EmailMessage{
-				From:        mail.From,
-				To:          mail.To,
-				Subject:     mail.Subject,
-				Body:        mail.Body,
-				HtmlContent: mail.HtmlContent,
-				Code:        mail.Code,
-				Timestamp:   mail.Timestamp.Format(time.RFC3339),
-			}
+			// 从邮箱地址中提取用户名
+			username := usernameOf(mail.To)
 
-			// 存储邮件
+			// 先保存启发式提取的结果，不等待AI
+			message := toEmailMessage(mail)
 			err := r.storage.SaveEmail(username, message)
 			if err != nil {
 				log.Printf("保存邮件失败: %v", err)
-			} else {
-				log.Printf("收到新邮件: From=%s, To=%s, Subject=%s", mail.From, mail.To, mail.Subject)
+				continue
+			}
+			log.Printf("收到新邮件: From=%s, To=%s, Subject=%s", mail.From, mail.To, mail.Subject)
+			r.events.Publish(username, MailEvent{Type: EventMessage, Email: mail.To, Message: fromEmailMessage(message)})
+
+			// 在后台运行AI提取，完成后更新邮件并发布更新事件
+			if mail.ExtractionStatus == ExtractionPending {
+				job := extractionJob{username: username, id: mail.ID, content: mail.content}
+				if !r.extraction.Enqueue(job) {
+					log.Printf("后台提取队列已满，跳过AI提取: %s", mail.ID)
+					r.extraction.finish(job, nil, ExtractionSkipped)
+				}
 			}
 		}
 	}()
 }
 
+// AIStatus AI提取的运行状态
+type AIStatus struct {
+	Enabled bool            `json:"enabled"`
+	Health  *llm.Health     `json:"health,omitempty"`
+	Cache   *llm.CacheStats `json:"cache,omitempty"`
+	Queue   QueueStats      `json:"queue"`
+}
+
+// AIStatus 返回AI模型服务的健康状态、缓存统计和后台队列长度
+func (r *EmailReceiver) AIStatus() AIStatus {
+	status := AIStatus{Queue: r.extraction.Stats()}
+	if r.ai != nil {
+		health := r.ai.breaker.Health()
+		stats := r.ai.cache.Stats()
+		status.Enabled = true
+		status.Health = &health
+		status.Cache = &stats
+	}
+	return status
+}
+
+// Subscribe 订阅指定邮箱的新邮件和更新事件，使用完毕后需要调用返回的取消函数
+func (r *EmailReceiver) Subscribe(email string) (<-chan MailEvent, func()) {
+	return r.events.Subscribe(usernameOf(email))
+}
+
 // GetEmails 获取指定邮箱的所有邮件
 func (r *EmailReceiver) GetEmails(email string) []*Mail {
 	// 从邮箱地址中提取用户名
-	var username string
-	for i, c := range email {
-		if c == '@' {
-			username = email[:i]
-			break
-		}
-	}
+	username := usernameOf(email)
 
 	// 获取存储的邮件
 	messages, err := r.storage.GetEmails(username)
@@ -129,36 +228,108 @@ func (r *EmailReceiver) GetEmails(email string) []*Mail {
 	// 转换为API格式
 	mails := make([]*Mail, 0, len(messages))
 	for _, message := range messages {
-		timestamp, err := time.Parse(time.RFC3339, message.Timestamp)
-		if err != nil {
-			timestamp = time.Now() // 解析失败使用当前时间
+		mails = append(mails, fromEmailMessage(message))
+	}
+
+	return mails
+}
+
+// LatestCode 返回最近一封带有验证码的邮件，includeExpired为false时跳过验证码已过期的邮件；没有时返回nil
+func (r *EmailReceiver) LatestCode(email string, includeExpired bool) *Mail {
+	var latest *Mail
+	for _, mail := range r.GetEmails(email) {
+		if mail.Code == "" || (mail.CodeExpired && !includeExpired) {
+			continue
+		}
+		if latest == nil || mail.Timestamp.After(latest.Timestamp) {
+			latest = mail
+		}
+	}
+	return latest
+}
+
+// LatestTOTPCode 使用最近一封邮件中的两步验证密钥计算当前验证码，issuer和account不为空时按发行方和账号过滤；
+// 没有密钥时返回nil
+func (r *EmailReceiver) LatestTOTPCode(email, issuer, account string) (*TOTPCode, error) {
+	var latest *Mail
+	var key repository.TOTPKey
+	for _, mail := range r.GetEmails(email) {
+		if latest != nil && !mail.Timestamp.After(latest.Timestamp) {
+			continue
+		}
+		for _, k := range mail.TOTPKeys {
+			if matchesTOTPKey(k, issuer, account) {
+				latest, key = mail, k
+				break
+			}
 		}
+	}
+	if latest == nil {
+		return nil, nil
+	}
+	return newTOTPCode(key, latest.ID, time.Now())
+}
 
-		mail := &Mail{
-			From:        message.From,
-			To:          message.To,
-			Subject:     message.Subject,
-			Body:        message.Body,
-			HtmlContent: message.HtmlContent,
-			Code:        message.Code,
-			Timestamp:   timestamp,
+// GetEmail 获取指定邮箱中的某封邮件，不存在时返回nil
+func (r *EmailReceiver) GetEmail(email, id string) *Mail {
+	for _, mail := range r.GetEmails(email) {
+		if mail.ID == id {
+			return mail
 		}
-		mails = append(mails, mail)
 	}
+	return nil
+}
 
-	return mails
+// GetRawEmail 获取指定邮箱中某封邮件的原始字节
+func (r *EmailReceiver) GetRawEmail(email, id string) ([]byte, bool) {
+	messages, err := r.storage.GetEmails(usernameOf(email))
+	if err != nil {
+		log.Printf("获取邮件失败: %v", err)
+		return nil, false
+	}
+
+	for _, message := range messages {
+		if message.ID != id || len(message.RawMessage) == 0 {
+			continue
+		}
+		raw, err := decompressRaw(message.RawMessage)
+		if err != nil {
+			log.Printf("解压原始邮件失败: %v", err)
+			return nil, false
+		}
+		return raw, true
+	}
+
+	return nil, false
+}
+
+// RenderHTML 生成指定邮箱中某封邮件用于沙箱展示的HTML，邮件不属于该邮箱时返回false
+func (r *EmailReceiver) RenderHTML(email, id string) (string, bool) {
+	mail := r.GetEmail(email, id)
+	if mail == nil {
+		return "", false
+	}
+
+	// 存储的内容在接收时已清理过，这里再清理一次以防旧数据，并将远程图片改写为当前密钥签名的代理地址
+	content := sanitizeHTML(mail.HtmlContent, r.proxyImageURL)
+	if content == "" {
+		content = "<pre>" + html.EscapeString(mail.Body) + "</pre>"
+	}
+	return content, true
+}
+
+// proxyImageURL 将远程图片地址改写为内置图片代理地址
+func (r *EmailReceiver) proxyImageURL(remote string) string {
+	if r.imageProxy == nil {
+		return remote
+	}
+	return r.imageProxy.ProxyURL(remote)
 }
 
 // ClearEmails 清除指定邮箱的所有邮件
 func (r *EmailReceiver) ClearEmails(email string) {
 	// 从邮箱地址中提取用户名
-	var username string
-	for i, c := range email {
-		if c == '@' {
-			username = email[:i]
-			break
-		}
-	}
+	username := usernameOf(email)
 
 	// 清除存储
 	err := r.storage.ClearEmails(username)
@@ -166,3 +337,76 @@ func (r *EmailReceiver) ClearEmails(email string) {
 		log.Printf("清除邮件失败: %v", err)
 	}
 }
+
+// toEmailMessage 将邮件转换为存储格式
+func toEmailMessage(mail *Mail) *repository.EmailMessage {
+	return &repository.EmailMessage{
+		ID:             mail.ID,
+		From:           mail.From,
+		To:             mail.To,
+		Subject:        mail.Subject,
+		Body:           mail.Body,
+		TextContent:    mail.TextContent,
+		HtmlContent:    mail.HtmlContent,
+		Code:           mail.Code,
+		CodeDisplay:    mail.CodeDisplay,
+		CodeCandidates: mail.CodeCandidates,
+		CodeExpiresAt:  formatExpiry(mail.CodeExpiresAt),
+		Timestamp:      mail.Timestamp.Format(time.RFC3339),
+		RawMessage:     compressRaw(mail.Raw),
+		Headers:        mail.Headers,
+
+		ExtractionStatus: mail.ExtractionStatus,
+
+		EmbeddedMessages: mail.EmbeddedMessages,
+		Links:            mail.Links,
+		PrimaryLink:      mail.PrimaryLink,
+		ImageCodes:       mail.ImageCodes,
+		TOTPKeys:         mail.TOTPKeys,
+		PDFTexts:         mail.PDFTexts,
+	}
+}
+
+// fromEmailMessage 将存储格式转换为API格式
+func fromEmailMessage(message *repository.EmailMessage) *Mail {
+	timestamp, err := time.Parse(time.RFC3339, message.Timestamp)
+	if err != nil {
+		timestamp = time.Now() // 解析失败使用当前时间
+	}
+
+	expiresAt := parseExpiry(message.CodeExpiresAt)
+
+	return &Mail{
+		ID:             message.ID,
+		From:           message.From,
+		To:             message.To,
+		Subject:        message.Subject,
+		Body:           message.Body,
+		TextContent:    message.TextContent,
+		HtmlContent:    message.HtmlContent,
+		Code:           message.Code,
+		CodeDisplay:    message.CodeDisplay,
+		CodeCandidates: message.CodeCandidates,
+		CodeExpiresAt:  expiresAt,
+		CodeExpired:    expiresAt != nil && !time.Now().Before(*expiresAt),
+		Timestamp:      timestamp,
+		Headers:        message.Headers,
+
+		ExtractionStatus: message.ExtractionStatus,
+
+		EmbeddedMessages: message.EmbeddedMessages,
+		Links:            message.Links,
+		PrimaryLink:      message.PrimaryLink,
+		ImageCodes:       message.ImageCodes,
+		TOTPKeys:         message.TOTPKeys,
+		PDFTexts:         message.PDFTexts,
+	}
+}
+
+// usernameOf 从邮箱地址中提取用户名，统一转换为小写，与CreateEmail保存的用户名一致
+func usernameOf(email string) string {
+	if i := strings.IndexByte(email, '@'); i >= 0 {
+		return strings.ToLower(email[:i])
+	}
+	return ""
+}
@@ -0,0 +1,329 @@
+package email
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+	"gopkg.in/yaml.v2"
+
+	"mail-temp/internal/repository"
+)
+
+// 规则命中时的得分，高于所有启发式结果
+const ruleCodeScore = 1.0
+
+// ExtractionRule 针对特定发件人的验证码提取规则
+type ExtractionRule struct {
+	Name     string      `json:"name" yaml:"name"`
+	Sender   string      `json:"sender,omitempty" yaml:"sender,omitempty"`     // 发件人域名，同时匹配子域名
+	Subject  string      `json:"subject,omitempty" yaml:"subject,omitempty"`   // 主题正则表达式
+	Header   *RuleHeader `json:"header,omitempty" yaml:"header,omitempty"`     // 头部条件
+	Pattern  string      `json:"pattern,omitempty" yaml:"pattern,omitempty"`   // 提取正则表达式，有分组时使用第一个分组
+	Selector string      `json:"selector,omitempty" yaml:"selector,omitempty"` // HTML中验证码所在元素的CSS选择器
+}
+
+// RuleHeader 规则的头部条件，Pattern为空时只要求头部存在
+type RuleHeader struct {
+	Name    string `json:"name" yaml:"name"`
+	Pattern string `json:"pattern,omitempty" yaml:"pattern,omitempty"`
+}
+
+// ruleFile 规则文件结构
+type ruleFile struct {
+	Rules []ExtractionRule `json:"rules" yaml:"rules"`
+}
+
+// compiledRule 编译后的规则
+type compiledRule struct {
+	ExtractionRule
+	subject  *regexp.Regexp
+	header   *regexp.Regexp
+	pattern  *regexp.Regexp
+	selector cascadia.Sel
+}
+
+// RuleResult 规则对一封邮件的测试结果
+type RuleResult struct {
+	Rule    string `json:"rule"`
+	Matched bool   `json:"matched"` // 发件人、主题和头部条件是否满足
+	Code    string `json:"code,omitempty"`
+	Display string `json:"display,omitempty"`
+	Source  string `json:"source,omitempty"`
+}
+
+// RuleExtractor 按规则文件提取验证码，文件修改后自动重新加载
+type RuleExtractor struct {
+	path string
+
+	mu      sync.RWMutex
+	rules   []*compiledRule
+	modTime time.Time
+}
+
+// NewRuleExtractor 从YAML或JSON文件加载规则
+func NewRuleExtractor(path string) (*RuleExtractor, error) {
+	e := &RuleExtractor{path: path}
+	if err := e.load(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Name 实现CodeExtractor接口
+func (e *RuleExtractor) Name() string {
+	return "rules"
+}
+
+// Rules 返回当前加载的规则
+func (e *RuleExtractor) Rules() []ExtractionRule {
+	e.reloadIfChanged()
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	rules := make([]ExtractionRule, 0, len(e.rules))
+	for _, rule := range e.rules {
+		rules = append(rules, rule.ExtractionRule)
+	}
+	return rules
+}
+
+// Extract 实现CodeExtractor接口，返回第一条命中规则的结果
+func (e *RuleExtractor) Extract(ctx context.Context, content *MessageContent) []repository.CodeCandidate {
+	for _, result := range e.Test(content, "") {
+		if result.Code == "" {
+			continue
+		}
+		log.Printf("规则%s提取到验证码: %s", result.Rule, result.Code)
+		return []repository.CodeCandidate{{
+			Code:      result.Code,
+			Display:   result.Display,
+			Source:    result.Source,
+			Extractor: e.Name(),
+			Rule:      result.Rule,
+			Score:     ruleCodeScore,
+		}}
+	}
+	return nil
+}
+
+// Test 对邮件运行规则，name不为空时只运行同名规则
+func (e *RuleExtractor) Test(content *MessageContent, name string) []RuleResult {
+	e.reloadIfChanged()
+
+	e.mu.RLock()
+	rules := e.rules
+	e.mu.RUnlock()
+
+	var doc *html.Node
+	var results []RuleResult
+	for _, rule := range rules {
+		if name != "" && rule.Name != name {
+			continue
+		}
+
+		result := RuleResult{Rule: rule.Name, Matched: rule.matches(content)}
+		if result.Matched {
+			if rule.selector != nil && doc == nil && content.HTML != "" {
+				doc, _ = html.Parse(strings.NewReader(content.HTML))
+			}
+			result.Display, result.Source = rule.extract(content, doc)
+			result.Code = normalizeCode(result.Display)
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// matches 检查邮件是否满足规则的发件人、主题和头部条件
+func (r *compiledRule) matches(content *MessageContent) bool {
+	if r.Sender != "" && !senderMatches(content.From, r.Sender) {
+		return false
+	}
+	if r.subject != nil && !r.subject.MatchString(content.Subject) {
+		return false
+	}
+	if r.Header != nil {
+		found := false
+		for _, header := range content.Headers {
+			if strings.EqualFold(header.Name, r.Header.Name) && (r.header == nil || r.header.MatchString(header.Value)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// extract 按选择器或正则表达式提取验证码，返回原始写法和来源
+func (r *compiledRule) extract(content *MessageContent, doc *html.Node) (string, string) {
+	if r.selector != nil {
+		if doc == nil {
+			return "", ""
+		}
+		node := cascadia.Query(doc, r.selector)
+		if node == nil {
+			return "", ""
+		}
+		text := nodeText(node)
+		if r.pattern != nil {
+			text = matchRulePattern(r.pattern, text)
+		}
+		return text, SourceHTML
+	}
+
+	if r.pattern != nil {
+		if code := matchRulePattern(r.pattern, content.Text); code != "" {
+			return code, SourceText
+		}
+		if code := matchRulePattern(r.pattern, content.Subject); code != "" {
+			return code, SourceSubject
+		}
+	}
+	return "", ""
+}
+
+// matchRulePattern 返回正则表达式的第一个分组，没有分组时返回整个匹配
+func matchRulePattern(pattern *regexp.Regexp, text string) string {
+	matches := pattern.FindStringSubmatch(text)
+	if len(matches) == 0 {
+		return ""
+	}
+	if len(matches) > 1 {
+		return strings.TrimSpace(matches[1])
+	}
+	return strings.TrimSpace(matches[0])
+}
+
+// senderMatches 检查发件人地址是否属于指定域名或其子域名
+func senderMatches(from, domain string) bool {
+	address := from
+	if parsed, err := mail.ParseAddress(from); err == nil {
+		address = parsed.Address
+	}
+	at := strings.LastIndexByte(address, '@')
+	if at < 0 {
+		return false
+	}
+
+	host := strings.ToLower(strings.Trim(address[at+1:], "> "))
+	domain = strings.ToLower(strings.TrimPrefix(domain, "@"))
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+// reloadIfChanged 规则文件修改后重新加载，加载失败时保留原有规则
+func (e *RuleExtractor) reloadIfChanged() {
+	info, err := os.Stat(e.path)
+	if err != nil {
+		return
+	}
+
+	e.mu.RLock()
+	changed := !info.ModTime().Equal(e.modTime)
+	e.mu.RUnlock()
+	if !changed {
+		return
+	}
+
+	if err := e.load(); err != nil {
+		log.Printf("重新加载验证码规则失败，继续使用原有规则: %v", err)
+		// 记录失败文件的修改时间，文件再次修改之前不再重试，避免每封邮件都重新读取并输出错误
+		e.mu.Lock()
+		e.modTime = info.ModTime()
+		e.mu.Unlock()
+	}
+}
+
+// load 读取并编译规则文件
+func (e *RuleExtractor) load() error {
+	info, err := os.Stat(e.path)
+	if err != nil {
+		return fmt.Errorf("读取规则文件失败: %w", err)
+	}
+	data, err := os.ReadFile(e.path)
+	if err != nil {
+		return fmt.Errorf("读取规则文件失败: %w", err)
+	}
+
+	var file ruleFile
+	if strings.EqualFold(filepath.Ext(e.path), ".json") {
+		err = json.Unmarshal(data, &file)
+	} else {
+		err = yaml.UnmarshalStrict(data, &file)
+	}
+	if err != nil {
+		return fmt.Errorf("解析规则文件失败: %w", err)
+	}
+
+	rules := make([]*compiledRule, 0, len(file.Rules))
+	for i, rule := range file.Rules {
+		compiled, err := compileRule(rule)
+		if err != nil {
+			return fmt.Errorf("规则%d(%s)无效: %w", i+1, rule.Name, err)
+		}
+		rules = append(rules, compiled)
+	}
+
+	e.mu.Lock()
+	e.rules = rules
+	e.modTime = info.ModTime()
+	e.mu.Unlock()
+
+	log.Printf("已加载%d条验证码规则: %s", len(rules), e.path)
+	return nil
+}
+
+// compileRule 校验并编译规则
+func compileRule(rule ExtractionRule) (*compiledRule, error) {
+	if rule.Name == "" {
+		return nil, fmt.Errorf("缺少name")
+	}
+	if rule.Sender == "" && rule.Subject == "" && rule.Header == nil {
+		return nil, fmt.Errorf("至少需要sender、subject或header中的一个条件")
+	}
+	if rule.Pattern == "" && rule.Selector == "" {
+		return nil, fmt.Errorf("需要pattern或selector")
+	}
+
+	compiled := &compiledRule{ExtractionRule: rule}
+	var err error
+	if rule.Subject != "" {
+		if compiled.subject, err = regexp.Compile(rule.Subject); err != nil {
+			return nil, fmt.Errorf("subject: %w", err)
+		}
+	}
+	if rule.Header != nil {
+		if rule.Header.Name == "" {
+			return nil, fmt.Errorf("header缺少name")
+		}
+		if rule.Header.Pattern != "" {
+			if compiled.header, err = regexp.Compile(rule.Header.Pattern); err != nil {
+				return nil, fmt.Errorf("header.pattern: %w", err)
+			}
+		}
+	}
+	if rule.Pattern != "" {
+		if compiled.pattern, err = regexp.Compile(rule.Pattern); err != nil {
+			return nil, fmt.Errorf("pattern: %w", err)
+		}
+	}
+	if rule.Selector != "" {
+		if compiled.selector, err = cascadia.Parse(rule.Selector); err != nil {
+			return nil, fmt.Errorf("selector: %w", err)
+		}
+	}
+	return compiled, nil
+}
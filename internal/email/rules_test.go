@@ -0,0 +1,204 @@
+package email
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"mail-temp/internal/repository"
+)
+
+// testRules 测试用的规则文件
+const testRules = `rules:
+  - name: acme-sender
+    sender: acme.example
+    pattern: 'code is ([0-9]{6})'
+  - name: subject-only
+    subject: '^\[Beta\]'
+    pattern: '[A-Z]{3}-[0-9]{3}'
+  - name: header-selector
+    header:
+      name: X-Mailer
+      pattern: '^Widget'
+    selector: 'td.otp'
+    pattern: '([0-9 ]+)'
+  - name: header-present
+    header:
+      name: X-Campaign
+    selector: 'span.code'
+`
+
+// newTestRuleExtractor 将规则写入临时文件并加载
+func newTestRuleExtractor(t *testing.T, rules string) (*RuleExtractor, string) {
+	t.Helper()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	if err := os.WriteFile(path, []byte(rules), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	e, err := NewRuleExtractor(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e, path
+}
+
+// matchedRules 返回条件满足的规则名称
+func matchedRules(results []RuleResult) map[string]RuleResult {
+	matched := make(map[string]RuleResult)
+	for _, result := range results {
+		if result.Matched {
+			matched[result.Rule] = result
+		}
+	}
+	return matched
+}
+
+// TestRuleMatchSender 发件人规则匹配域名及其子域名，不匹配只是后缀相同的域名
+func TestRuleMatchSender(t *testing.T) {
+	e, _ := newTestRuleExtractor(t, testRules)
+	for from, want := range map[string]bool{
+		"ACME <no-reply@acme.example>": true,
+		"login@mail.ACME.example":      true,
+		"phish@evil-acme.example":      false,
+		"acme.example <x@other.test>":  false,
+		"not an address":               false,
+	} {
+		results := e.Test(&MessageContent{From: from, Text: "Your code is 123456"}, "acme-sender")
+		if len(results) != 1 {
+			t.Fatalf("期望1条结果，实际 %+v", results)
+		}
+		if results[0].Matched != want {
+			t.Errorf("%s: 期望Matched=%v，实际%v", from, want, results[0].Matched)
+		}
+	}
+}
+
+// TestRuleMatchSubjectAndHeader 主题按正则匹配，头部按名称（不区分大小写）和可选的正则匹配
+func TestRuleMatchSubjectAndHeader(t *testing.T) {
+	e, _ := newTestRuleExtractor(t, testRules)
+
+	matched := matchedRules(e.Test(&MessageContent{Subject: "[Beta] Invite", Text: "Use ABC-123"}, ""))
+	if _, ok := matched["subject-only"]; !ok || len(matched) != 1 {
+		t.Errorf("期望只匹配subject-only，实际 %v", matched)
+	}
+	if got := matchedRules(e.Test(&MessageContent{Subject: "Re: [Beta] Invite"}, "")); len(got) != 0 {
+		t.Errorf("期望不匹配，实际 %v", got)
+	}
+
+	headers := []repository.Header{{Name: "x-mailer", Value: "Widget 2.0"}, {Name: "X-Campaign", Value: ""}}
+	matched = matchedRules(e.Test(&MessageContent{Headers: headers}, ""))
+	if _, ok := matched["header-selector"]; !ok {
+		t.Errorf("期望匹配header-selector，实际 %v", matched)
+	}
+	if _, ok := matched["header-present"]; !ok {
+		t.Errorf("期望匹配header-present，实际 %v", matched)
+	}
+
+	headers = []repository.Header{{Name: "X-Mailer", Value: "Other Widget"}}
+	if got := matchedRules(e.Test(&MessageContent{Headers: headers}, "")); len(got) != 0 {
+		t.Errorf("头部值不匹配时期望不匹配，实际 %v", got)
+	}
+}
+
+// TestRuleExtract 正则规则依次在正文和主题中提取，选择器规则在HTML元素中提取并可再用正则截取
+func TestRuleExtract(t *testing.T) {
+	e, _ := newTestRuleExtractor(t, testRules)
+
+	tests := []struct {
+		name    string
+		rule    string
+		content *MessageContent
+		display string
+		source  string
+	}{
+		{"正文分组", "acme-sender", &MessageContent{From: "a@acme.example", Text: "Your code is 482913."}, "482913", SourceText},
+		{"主题", "acme-sender", &MessageContent{From: "a@acme.example", Subject: "Your code is 771100"}, "771100", SourceSubject},
+		{"整个匹配", "subject-only", &MessageContent{Subject: "[Beta] Invite", Text: "Invite XYZ-789 inside"}, "XYZ-789", SourceText},
+		{"选择器和正则", "header-selector", &MessageContent{
+			Headers: []repository.Header{{Name: "X-Mailer", Value: "Widget"}},
+			HTML:    `<table><tr><td class="otp">Code: 123 456</td><td>999999</td></tr></table>`,
+		}, "123 456", SourceHTML},
+		{"只有选择器", "header-present", &MessageContent{
+			Headers: []repository.Header{{Name: "X-Campaign", Value: "spring"}},
+			HTML:    `<p>Hello <span class="code">Q7-K2</span></p>`,
+		}, "Q7-K2", SourceHTML},
+		{"选择器没有命中", "header-present", &MessageContent{
+			Headers: []repository.Header{{Name: "X-Campaign", Value: "spring"}},
+			HTML:    `<p>no code</p>`,
+		}, "", ""},
+	}
+	for _, tt := range tests {
+		results := e.Test(tt.content, tt.rule)
+		if len(results) != 1 || !results[0].Matched {
+			t.Errorf("%s: 期望规则%s匹配，实际 %+v", tt.name, tt.rule, results)
+			continue
+		}
+		if results[0].Display != tt.display || results[0].Source != tt.source {
+			t.Errorf("%s: 期望%q(%s)，实际%q(%s)", tt.name, tt.display, tt.source, results[0].Display, results[0].Source)
+		}
+	}
+
+	candidates := e.Extract(context.Background(), &MessageContent{From: "a@acme.example", Text: "Your code is 482913"})
+	if len(candidates) != 1 || candidates[0].Code != "482913" || candidates[0].Rule != "acme-sender" || candidates[0].Score != ruleCodeScore {
+		t.Errorf("Extract结果不正确: %+v", candidates)
+	}
+}
+
+// TestCompileRuleErrors 缺少名称、条件或提取方式以及表达式无效时拒绝加载
+func TestCompileRuleErrors(t *testing.T) {
+	for name, rule := range map[string]ExtractionRule{
+		"缺少name":   {Sender: "a.example", Pattern: "x"},
+		"缺少条件":     {Name: "r", Pattern: "x"},
+		"缺少提取方式":   {Name: "r", Sender: "a.example"},
+		"主题正则无效":   {Name: "r", Subject: "(", Pattern: "x"},
+		"头部缺少name": {Name: "r", Header: &RuleHeader{Pattern: "x"}, Pattern: "x"},
+		"头部正则无效":   {Name: "r", Header: &RuleHeader{Name: "X", Pattern: "("}, Pattern: "x"},
+		"提取正则无效":   {Name: "r", Sender: "a.example", Pattern: "("},
+		"选择器无效":    {Name: "r", Sender: "a.example", Selector: "td[["},
+	} {
+		if _, err := compileRule(rule); err == nil {
+			t.Errorf("%s: 期望返回错误", name)
+		}
+	}
+}
+
+// TestRuleReload 文件修改后重新加载；加载失败时保留原有规则，并且在文件再次修改之前不重试
+func TestRuleReload(t *testing.T) {
+	e, path := newTestRuleExtractor(t, testRules)
+	modTime := time.Now().Add(time.Hour)
+
+	if err := os.WriteFile(path, []byte("rules:\n  - name: broken\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	if rules := e.Rules(); len(rules) != 4 {
+		t.Errorf("加载失败时期望保留4条规则，实际%d条", len(rules))
+	}
+	e.mu.RLock()
+	recorded := e.modTime
+	e.mu.RUnlock()
+	if !recorded.Equal(modTime) {
+		t.Errorf("期望记录失败文件的修改时间%v，实际%v", modTime, recorded)
+	}
+
+	valid := "rules:\n  - name: only\n    sender: acme.example\n    pattern: '[0-9]{6}'\n"
+	if err := os.WriteFile(path, []byte(valid), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	modTime = modTime.Add(time.Minute)
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	if rules := e.Rules(); len(rules) != 1 || rules[0].Name != "only" {
+		t.Errorf("期望重新加载为1条规则only，实际 %+v", rules)
+	}
+}
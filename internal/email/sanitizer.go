@@ -0,0 +1,377 @@
+package email
+
+import (
+	"bytes"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"mail-temp/internal/imageproxy"
+)
+
+// 需要连同子节点一起移除的危险元素
+var droppedElements = map[atom.Atom]bool{
+	atom.Script:   true,
+	atom.Noscript: true,
+	atom.Iframe:   true,
+	atom.Frame:    true,
+	atom.Frameset: true,
+	atom.Object:   true,
+	atom.Embed:    true,
+	atom.Applet:   true,
+	atom.Form:     true,
+	atom.Input:    true,
+	atom.Button:   true,
+	atom.Textarea: true,
+	atom.Select:   true,
+	atom.Option:   true,
+	atom.Base:     true,
+	atom.Link:     true,
+	atom.Meta:     true,
+	atom.Template: true,
+	atom.Svg:      true,
+	atom.Math:     true,
+}
+
+// 包含URL的属性，值为true表示该属性用于加载资源
+var urlAttributes = map[string]bool{
+	"href":       false,
+	"action":     false,
+	"cite":       false,
+	"longdesc":   false,
+	"usemap":     false,
+	"src":        true,
+	"background": true,
+	"poster":     true,
+	"lowsrc":     true,
+	"dynsrc":     true,
+}
+
+// 直接丢弃的属性（除on*事件处理器之外）
+var droppedAttributes = map[string]bool{
+	"formaction": true,
+	"srcdoc":     true,
+	"srcset":     true,
+	"ping":       true,
+	"xmlns":      true,
+}
+
+// CSS中可能执行脚本或加载外部资源的写法，在解码转义、去除注释之后匹配；
+// image-set()可以不通过url()直接加载远程图片，整段丢弃
+var (
+	cssDangerousPattern = regexp.MustCompile(`(?i)expression\s*\(|javascript:|vbscript:|-moz-binding|behavior\s*:|image-set\s*\(`)
+	cssImportPattern    = regexp.MustCompile(`(?i)@import[^;]*;?`)
+	cssURLPattern       = regexp.MustCompile(`(?i)url\(\s*(['"]?)([^'")]+)(['"]?)\s*\)`)
+	cssCommentPattern   = regexp.MustCompile(`/\*[\s\S]*?(?:\*/|$)`)
+)
+
+// urlRewriter 改写远程资源地址，返回空字符串表示移除该资源
+type urlRewriter func(remote string) string
+
+// htmlSanitizer 邮件HTML清理器
+type htmlSanitizer struct {
+	rewrite urlRewriter
+}
+
+// sanitizeHTML 清理邮件HTML，移除脚本、事件处理器、表单、危险URL和追踪像素，
+// rewrite不为空时将远程资源地址交给它改写（例如改写为图片代理地址）
+func sanitizeHTML(content string, rewrite urlRewriter) string {
+	if strings.TrimSpace(content) == "" {
+		return ""
+	}
+
+	doc, err := html.Parse(strings.NewReader(content))
+	if err != nil {
+		// 解析失败时宁可丢弃，也不返回未清理的内容
+		return html.EscapeString(content)
+	}
+
+	sanitizer := &htmlSanitizer{rewrite: rewrite}
+	sanitizer.sanitizeNode(doc)
+
+	var buf bytes.Buffer
+	if err := html.Render(&buf, doc); err != nil {
+		return html.EscapeString(content)
+	}
+	return buf.String()
+}
+
+// sanitizeNode 递归清理节点
+func (s *htmlSanitizer) sanitizeNode(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+
+		switch c.Type {
+		case html.CommentNode, html.DoctypeNode:
+			// 注释中可能藏有条件注释等，直接移除
+			n.RemoveChild(c)
+		case html.ElementNode:
+			if droppedElements[c.DataAtom] || c.Namespace != "" {
+				n.RemoveChild(c)
+				break
+			}
+			if c.DataAtom == atom.Img && isTrackingPixel(c) {
+				n.RemoveChild(c)
+				break
+			}
+			if c.DataAtom == atom.Style {
+				s.sanitizeStyleElement(c)
+				break
+			}
+			s.sanitizeAttributes(c)
+			s.sanitizeNode(c)
+		default:
+			s.sanitizeNode(c)
+		}
+
+		c = next
+	}
+}
+
+// sanitizeAttributes 清理元素属性
+func (s *htmlSanitizer) sanitizeAttributes(n *html.Node) {
+	attrs := n.Attr[:0]
+	for _, attr := range n.Attr {
+		key := strings.ToLower(attr.Key)
+		if attr.Namespace != "" || strings.HasPrefix(key, "on") || droppedAttributes[key] {
+			continue
+		}
+
+		if resource, isURL := urlAttributes[key]; isURL {
+			safe, ok := sanitizeURL(attr.Val, resource)
+			if !ok {
+				continue
+			}
+			if resource {
+				if safe = s.rewriteResource(safe); safe == "" {
+					continue
+				}
+			}
+			attr.Val = safe
+		}
+
+		if key == "style" {
+			css, ok := cleanCSS(attr.Val)
+			if !ok {
+				continue
+			}
+			attr.Val = s.rewriteCSS(css)
+		}
+
+		attr.Key = key
+		attrs = append(attrs, attr)
+	}
+	n.Attr = attrs
+
+	// 链接在新窗口打开，并且不携带来源信息
+	if n.DataAtom == atom.A && hasAttr(n, "href") {
+		setAttr(n, "target", "_blank")
+		setAttr(n, "rel", "noopener noreferrer nofollow")
+	}
+}
+
+// sanitizeStyleElement 清理<style>元素中的CSS
+func (s *htmlSanitizer) sanitizeStyleElement(n *html.Node) {
+	n.Attr = nil
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.TextNode {
+			continue
+		}
+		// <style>的内容按原样输出，解码后出现的"<"可能闭合元素，整段丢弃
+		css, ok := cleanCSS(c.Data)
+		if !ok || strings.Contains(css, "<") {
+			css = ""
+		}
+		c.Data = s.rewriteCSS(cssImportPattern.ReplaceAllString(css, ""))
+	}
+}
+
+// cleanCSS 解码CSS转义、去除注释，使后续的匹配与浏览器的解析一致，例如"u\72l("即"url("、
+// "url(/**/'…')"中的注释会被浏览器忽略；返回false表示应丢弃整段CSS
+func cleanCSS(css string) (string, bool) {
+	css = cssCommentPattern.ReplaceAllString(decodeCSSEscapes(cssCommentPattern.ReplaceAllString(css, "")), "")
+	// 解码后仍有反斜杠（例如"\\75rl("），浏览器会再次按转义解析
+	if strings.Contains(css, `\`) || cssDangerousPattern.MatchString(css) {
+		return "", false
+	}
+	return css, true
+}
+
+// decodeCSSEscapes 按CSS语法解码转义：反斜杠加1到6位十六进制数（后面可跟一个空白）表示对应字符，
+// 反斜杠加换行表示续行，反斜杠加其他字符表示该字符本身
+func decodeCSSEscapes(css string) string {
+	if !strings.Contains(css, `\`) {
+		return css
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(css); {
+		if css[i] != '\\' {
+			b.WriteByte(css[i])
+			i++
+			continue
+		}
+		i++
+		if i >= len(css) {
+			break
+		}
+
+		j := i
+		for j < len(css) && j-i < 6 && isHexByte(css[j]) {
+			j++
+		}
+		if j > i {
+			code, _ := strconv.ParseUint(css[i:j], 16, 32)
+			r := rune(code)
+			if r == 0 || r > unicode.MaxRune || (r >= 0xD800 && r <= 0xDFFF) {
+				r = unicode.ReplacementChar
+			}
+			b.WriteRune(r)
+			if strings.HasPrefix(css[j:], "\r\n") {
+				j += 2
+			} else if j < len(css) && strings.IndexByte(" \t\n\r\f", css[j]) >= 0 {
+				j++
+			}
+			i = j
+			continue
+		}
+
+		if strings.IndexByte("\n\r\f", css[i]) >= 0 {
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(css[i:])
+		b.WriteRune(r)
+		i += size
+	}
+	return b.String()
+}
+
+// isHexByte 检查字节是否为十六进制数字
+func isHexByte(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+// rewriteResource 改写远程资源地址
+func (s *htmlSanitizer) rewriteResource(value string) string {
+	if s.rewrite == nil || !isRemoteURL(value) {
+		return value
+	}
+	return s.rewrite(value)
+}
+
+// rewriteCSS 清理并改写CSS中url()引用的资源
+func (s *htmlSanitizer) rewriteCSS(css string) string {
+	return cssURLPattern.ReplaceAllStringFunc(css, func(match string) string {
+		groups := cssURLPattern.FindStringSubmatch(match)
+		safe, ok := sanitizeURL(groups[2], true)
+		if !ok {
+			return "none"
+		}
+		if safe = s.rewriteResource(safe); safe == "" {
+			return "none"
+		}
+		return `url("` + strings.ReplaceAll(safe, `"`, "%22") + `")`
+	})
+}
+
+// isRemoteURL 检查地址是否为http或https远程地址
+func isRemoteURL(value string) bool {
+	lower := strings.ToLower(strings.TrimSpace(value))
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")
+}
+
+// sanitizeURL 检查URL是否安全，resource为true时表示该URL用于加载资源
+func sanitizeURL(raw string, resource bool) (string, bool) {
+	value := strings.TrimSpace(raw)
+	if value == "" {
+		return "", false
+	}
+
+	// 去除用于绕过检查的控制字符和空白
+	cleaned := strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || r == ' ' {
+			return -1
+		}
+		return r
+	}, value)
+
+	lower := strings.ToLower(cleaned)
+	if strings.HasPrefix(lower, "#") {
+		return value, !resource
+	}
+
+	// 旧版本在接收时改写为图片代理地址并保存，还原为远程地址，展示时再用当前密钥重新签名
+	if resource {
+		if remote, ok := imageproxy.RemoteURL(cleaned); ok {
+			cleaned, value = remote, remote
+			lower = strings.ToLower(cleaned)
+		}
+	}
+
+	u, err := url.Parse(cleaned)
+	if err != nil {
+		return "", false
+	}
+
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		return value, true
+	case "mailto", "tel":
+		return value, !resource
+	case "cid":
+		return value, resource
+	case "data":
+		// 只允许内嵌的光栅图片
+		return value, resource && isSafeDataImage(lower)
+	default:
+		return "", false
+	}
+}
+
+// isSafeDataImage 检查data URI是否为安全的图片类型（不允许SVG）
+func isSafeDataImage(lower string) bool {
+	for _, prefix := range []string{"data:image/png", "data:image/jpeg", "data:image/jpg", "data:image/gif", "data:image/webp"} {
+		if strings.HasPrefix(lower, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasAttr 检查节点是否包含指定属性
+func hasAttr(n *html.Node, key string) bool {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// getAttr 获取节点属性值
+func getAttr(n *html.Node, key string) string {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+// setAttr 设置节点属性，已存在时覆盖
+func setAttr(n *html.Node, key, value string) {
+	for i, attr := range n.Attr {
+		if attr.Key == key {
+			n.Attr[i].Val = value
+			return
+		}
+	}
+	n.Attr = append(n.Attr, html.Attribute{Key: key, Val: value})
+}
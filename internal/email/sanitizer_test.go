@@ -0,0 +1,148 @@
+package email
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+// proxied 测试用的资源改写函数，把远程地址替换为固定的代理地址
+func proxied(remote string) string {
+	return "/proxy/image?url=PROXIED"
+}
+
+// TestSanitizeCSSEscapes CSS转义和注释不能绕过url()改写，远程地址只能以代理地址出现
+func TestSanitizeCSSEscapes(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		proxied bool // 是否应保留改写后的代理地址
+	}{
+		{"十六进制转义", `<div style="background:u\72l(http://t.example/p.gif)">x</div>`, true},
+		{"带空白的转义", `<div style="background:\75 \72 \6c (http://t.example/p.gif)">x</div>`, true},
+		{"字符转义", `<div style="background:\u\r\l(http://t.example/p.gif)">x</div>`, true},
+		{"注释", `<div style="background:url(/**/'http://t.example/p.gif')">x</div>`, true},
+		{"style元素", `<style>a{background:\75rl(http://t.example/p.gif)}</style>`, true},
+		{"双重转义", `<div style="background:\\75rl(http://t.example/p.gif)">x</div>`, false},
+		{"image-set", `<div style="background:-webkit-image-set('http://t.example/p.gif' 1x)">x</div>`, false},
+		{"转义的import", `<style>@\69mport 'http://t.example/a.css';</style>`, false},
+		{"转义的expression", `<div style="width:e\78pression(alert(1))">x</div>`, false},
+	}
+
+	for _, tt := range tests {
+		got := sanitizeHTML(tt.input, proxied)
+		if strings.Contains(got, "t.example") {
+			t.Errorf("%s: 远程地址没有被改写: %s", tt.name, got)
+		}
+		if strings.Contains(got, "expression") {
+			t.Errorf("%s: 没有移除expression: %s", tt.name, got)
+		}
+		if has := strings.Contains(got, "PROXIED"); has != tt.proxied {
+			t.Errorf("%s: 期望代理地址%v，实际: %s", tt.name, tt.proxied, got)
+		}
+	}
+}
+
+// TestSanitizeStyleElementBreakout 解码后的"</style>"不能闭合<style>元素
+func TestSanitizeStyleElementBreakout(t *testing.T) {
+	got := sanitizeHTML(`<style>p{content:"\3c/style\3e<img src=x onerror=alert(1)>"}</style>`, nil)
+	if strings.Contains(got, "<img") || strings.Contains(got, "onerror") {
+		t.Errorf("<style>中的内容闭合了元素: %s", got)
+	}
+}
+
+// TestSanitizeHTMLPayloads 常见的XSS和跳转载荷在清理后不能留下可执行或可跳转的内容
+func TestSanitizeHTMLPayloads(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		keep  string // 清理后应保留的内容，为空时不检查
+	}{
+		{"javascript链接", `<a href="javascript:alert(1)">x</a>`, ""},
+		{"大小写混合", `<a href="JaVaScRiPt:alert(1)">x</a>`, ""},
+		{"实体编码", `<a href="&#106;&#97;vascript&#58;alert(1)">x</a>`, ""},
+		{"十六进制实体", `<a href="&#x6A;avascript:alert(1)">x</a>`, ""},
+		{"实体编码的制表符", `<a href="java&#x09;script:alert(1)">x</a>`, ""},
+		{"换行", "<a href=\"java\nscript:alert(1)\">x</a>", ""},
+		{"前导空白和控制字符", `<a href=" &#x01; javascript:alert(1)">x</a>`, ""},
+		{"vbscript", `<a href="vbscript:msgbox(1)">x</a>`, ""},
+		{"data链接", `<a href="data:text/html,<script>alert(1)</script>">x</a>`, ""},
+		{"base", `<base href="https://evil.example/"><a href="/login">x</a>`, ""},
+		{"meta refresh", `<meta http-equiv="refresh" content="0;url=https://evil.example/">`, ""},
+		{"body中的meta", `<p>hi</p><meta http-equiv="refresh" content="0;url=https://evil.example/">`, "hi"},
+		{"svg中的style", `<svg><style><img src=x onerror=alert(1)></style></svg>`, ""},
+		{"svg中的script", `<svg><script>alert(1)</script><a xlink:href="javascript:alert(1)">x</a></svg>`, ""},
+		{"math mglyph", `<math><mtext><table><mglyph><style><img src=x onerror=alert(1)>`, ""},
+		{"math注释", `<math><mi><!--</mi><img src=x onerror=alert(1)>--></mi></math>`, ""},
+		{"noscript属性闭合", `<noscript><p title="</noscript><img src=x onerror=alert(1)>"></noscript>`, ""},
+		{"textarea闭合", `<textarea><img title="</textarea><img src=x onerror=alert(1)>"></textarea>`, ""},
+		{"template", `<template><img src=x onerror=alert(1)></template>`, ""},
+		{"svg data图片", `<img src="data:image/svg+xml;base64,PHN2ZyBvbmxvYWQ9YWxlcnQoMSk+">`, ""},
+		{"svg data背景", `<div style="background:url(data:image/svg+xml,<svg onload=alert(1)>)">x</div>`, "x"},
+		{"png data图片", `<img src="data:image/png;base64,iVBORw0KGgo=">`, "data:image/png"},
+		{"formaction", `<a formaction="javascript:alert(1)" href="https://example.com/">x</a>`, "https://example.com/"},
+		{"button formaction", `<form><button formaction="javascript:alert(1)">x</button></form>`, ""},
+		{"事件处理器", `<div onclick="alert(1)" onmouseover="alert(2)">x</div>`, "x"},
+		{"iframe srcdoc", `<iframe srcdoc="<script>alert(1)</script>"></iframe>`, ""},
+		{"object", `<object data="https://evil.example/x.swf"></object><embed src="https://evil.example/x.swf">`, ""},
+		{"link样式表", `<link rel="stylesheet" href="https://evil.example/x.css">`, ""},
+		{"正常链接", `<a href="https://example.com/verify?token=abc">验证</a>`, `rel="noopener noreferrer nofollow"`},
+	}
+
+	for _, tt := range tests {
+		got := sanitizeHTML(tt.input, nil)
+		if problem := unsafeHTML(got); problem != "" {
+			t.Errorf("%s: %s\n输入: %s\n输出: %s", tt.name, problem, tt.input, got)
+		}
+		if tt.keep != "" && !strings.Contains(got, tt.keep) {
+			t.Errorf("%s: 应保留%q，实际: %s", tt.name, tt.keep, got)
+		}
+
+		// 再次解析清理后的输出，结果必须仍然安全（防止解析差异导致的mXSS）
+		if again := sanitizeHTML(got, nil); unsafeHTML(again) != "" {
+			t.Errorf("%s: 二次清理后不安全: %s", tt.name, again)
+		}
+	}
+}
+
+// unsafeHTML 重新解析HTML，返回发现的危险内容，没有时返回空字符串
+func unsafeHTML(content string) string {
+	doc, err := html.Parse(strings.NewReader(content))
+	if err != nil {
+		return "无法解析: " + err.Error()
+	}
+
+	var problem string
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if problem != "" {
+			return
+		}
+		if n.Type == html.ElementNode {
+			if droppedElements[n.DataAtom] || n.Namespace != "" {
+				problem = "保留了危险元素<" + n.Data + ">"
+				return
+			}
+			for _, attr := range n.Attr {
+				key := strings.ToLower(attr.Key)
+				value := strings.ToLower(strings.Join(strings.Fields(attr.Val), ""))
+				switch {
+				case strings.HasPrefix(key, "on"), droppedAttributes[key]:
+					problem = "保留了属性" + key
+				case strings.Contains(value, "javascript:"), strings.Contains(value, "vbscript:"):
+					problem = "保留了脚本地址: " + attr.Val
+				case strings.Contains(value, "data:image/svg"), strings.Contains(value, "data:text"):
+					problem = "保留了不安全的data地址: " + attr.Val
+				case strings.Contains(value, "evil.example"):
+					problem = "保留了外部跳转或资源: " + attr.Val
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	return problem
+}
@@ -2,14 +2,11 @@ package email
 
 import (
 	"bytes"
-	"context"
 	"encoding/base64"
-	"encoding/json"
 	"fmt"
 	"io"
 	"log"
-	"net/http"
-	"os"
+	"net"
 	"regexp"
 	"strconv"
 	"strings"
@@ -28,9 +25,11 @@ type SMTPServer struct {
 }
 
 // NewSMTPServer 创建一个新的SMTP服务器
-func NewSMTPServer(domain string, port int, generator *EmailGenerator) *SMTPServer {
+func NewSMTPServer(domain string, port int, generator *EmailGenerator, pipeline *Pipeline) *SMTPServer {
 	backend := &SMTPBackend{
+		domain:       domain,
 		generator:    generator,
+		pipeline:     pipeline,
 		mailReceived: make(chan *Mail, 100),
 	}
 
@@ -82,7 +81,9 @@ func (s *SMTPServer) GetMailChannel() <-chan *Mail {
 
 // SMTPBackend SMTP服务器后端
 type SMTPBackend struct {
+	domain       string
 	generator    *EmailGenerator
+	pipeline     *Pipeline
 	mailReceived chan *Mail
 }
 
@@ -90,6 +91,7 @@ type SMTPBackend struct {
 func (bkd *SMTPBackend) NewSession(c smtp.ConnectionState) (smtp.Session, error) {
 	return &SMTPSession{
 		backend: bkd,
+		conn:    c,
 	}, nil
 }
 
@@ -97,6 +99,7 @@ func (bkd *SMTPBackend) NewSession(c smtp.ConnectionState) (smtp.Session, error)
 func (bkd *SMTPBackend) Login(state *smtp.ConnectionState, username, password string) (smtp.Session, error) {
 	return &SMTPSession{
 		backend: bkd,
+		conn:    *state,
 	}, nil
 }
 
@@ -104,12 +107,14 @@ func (bkd *SMTPBackend) Login(state *smtp.ConnectionState, username, password st
 func (bkd *SMTPBackend) AnonymousLogin(state *smtp.ConnectionState) (smtp.Session, error) {
 	return &SMTPSession{
 		backend: bkd,
+		conn:    *state,
 	}, nil
 }
 
 // SMTPSession SMTP会话
 type SMTPSession struct {
 	backend     *SMTPBackend
+	conn        smtp.ConnectionState
 	from        string
 	recipients  []string
 	currentMail *Mail
@@ -124,6 +129,7 @@ func (s *SMTPSession) AuthPlain(username, password string) error {
 func (s *SMTPSession) Mail(from string, opts smtp.MailOptions) error {
 	s.from = from
 	s.currentMail = &Mail{
+		ID:        newMessageID(),
 		From:      from,
 		Timestamp: time.Now(),
 	}
@@ -142,208 +148,6 @@ func (s *SMTPSession) Rcpt(to string) error {
 	return nil
 }
 
-// 定义Ollama API结构体
-type OllamaRequest struct {
-	Model  string `json:"model"`
-	Prompt string `json:"prompt"`
-}
-
-type OllamaResponse struct {
-	Response string `json:"response"`
-}
-
-// 最大重试次数
-const maxRetries = 2
-
-// 获取Ollama API地址，优先使用环境变量
-func getOllamaAPIURL() string {
-	// 从环境变量获取Ollama API地址
-	ollamaURL := os.Getenv("OLLAMA_API_URL")
-	if ollamaURL != "" {
-		return ollamaURL
-	}
-
-	// 从环境变量获取宿主机地址
-	host := os.Getenv("HOST_ADDRESS")
-	if host != "" {
-		return "http://" + host + ":11434/api/generate"
-	}
-
-	// 尝试Docker网络方式访问
-	return "http://172.17.0.1:11434/api/generate"
-}
-
-// 使用正则表达式简单提取验证码（作为备用方案）
-func extractVerificationCodeFallback(content string) string {
-	// 先尝试匹配"验证码"附近的数字
-	codeRegex := regexp.MustCompile(`(?i)(验证码|verification code|code)[^0-9]{0,15}[: ：]?\s*?(\d{4,8})`)
-	if matches := codeRegex.FindStringSubmatch(content); len(matches) > 2 {
-		log.Printf("正则表达式提取到验证码: %s", matches[2])
-		return matches[2]
-	}
-
-	// 尝试匹配任意4-8位数字，然后过滤年份（不使用前瞻断言）
-	codeRegex = regexp.MustCompile(`\b\d{4,8}\b`)
-	matches := codeRegex.FindAllString(content, -1)
-	for _, match := range matches {
-		// 如果是4位数字，检查是否是年份
-		if len(match) == 4 && match >= "2020" && match <= "2030" {
-			// 可能是年份，跳过
-			continue
-		}
-		log.Printf("正则表达式提取到可能的验证码: %s", match)
-		return match
-	}
-
-	return ""
-}
-
-// extractCodeWithAI 使用Ollama模型提取验证码
-func extractCodeWithAI(content string) string {
-	log.Printf("使用AI提取验证码，内容长度: %d", len(content))
-
-	// 作为备用方案，先尝试使用正则表达式提取
-	code := extractVerificationCodeFallback(content)
-	if code != "" {
-		log.Printf("使用备用方案提取到验证码: %s", code)
-		return code
-	}
-
-	// 限制内容长度，避免请求过大
-	if len(content) > 3000 {
-		content = content[:3000]
-	}
-
-	// 如果内容太短，可能没有验证码
-	if len(content) < 50 {
-		log.Println("内容太短，不太可能包含验证码")
-		return ""
-	}
-
-	// 设置请求
-	reqBody := OllamaRequest{
-		Model:  "gemma3:1b",
-		Prompt: "这是一封电子邮件内容，其中可能包含验证码。请只提取并回复邮件中的验证码数字（通常为4-8位数字），不要有任何其他解释，如果找不到验证码请回复'无法识别': \n\n" + content,
-	}
-
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		log.Printf("JSON编码错误: %v", err)
-		return ""
-	}
-
-	// 获取Ollama API地址
-	ollamaAPIURL := getOllamaAPIURL()
-	log.Printf("调用Ollama API: %s", ollamaAPIURL)
-
-	// 创建带超时的HTTP客户端
-	client := &http.Client{
-		Timeout: 5 * time.Second, // 5秒超时
-	}
-
-	// 重试逻辑
-	var resp *http.Response
-	var retryCount int
-
-	for retryCount < maxRetries {
-		// 创建请求
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		req, err := http.NewRequestWithContext(ctx, "POST", ollamaAPIURL, bytes.NewBuffer(jsonData))
-		if err != nil {
-			cancel()
-			log.Printf("创建请求失败: %v", err)
-			return ""
-		}
-		req.Header.Set("Content-Type", "application/json")
-
-		// 发送请求
-		resp, err = client.Do(req)
-		cancel()
-
-		if err != nil {
-			log.Printf("调用Ollama API失败(重试%d): %v", retryCount, err)
-			retryCount++
-			time.Sleep(500 * time.Millisecond) // 短暂延迟后重试
-			continue
-		}
-		break
-	}
-
-	// 如果所有重试都失败，返回空
-	if resp == nil {
-		log.Printf("调用Ollama API失败，超过最大重试次数")
-		return ""
-	}
-	defer resp.Body.Close()
-
-	// 读取响应
-	var result OllamaResponse
-	err = json.NewDecoder(resp.Body).Decode(&result)
-	if err != nil {
-		log.Printf("解析Ollama响应失败: %v", err)
-		return ""
-	}
-
-	// 记录AI响应
-	response := strings.TrimSpace(result.Response)
-	log.Printf("AI返回内容: %s", response)
-
-	// 过滤掉"无法识别"类的回复
-	if strings.Contains(response, "无法") || strings.Contains(response, "找不到") {
-		log.Println("AI未找到验证码")
-		return ""
-	}
-
-	// 提取响应中的数字
-	codeRegex := regexp.MustCompile(`\b\d{4,8}\b`)
-	if matches := codeRegex.FindStringSubmatch(response); len(matches) > 0 {
-		log.Printf("提取到验证码: %s", matches[0])
-		return matches[0]
-	}
-
-	// 如果响应中只有数字，直接返回
-	cleanedResponse := strings.TrimSpace(response)
-	if matched, _ := regexp.MatchString(`^\d{4,8}$`, cleanedResponse); matched {
-		log.Printf("直接使用AI返回的验证码: %s", cleanedResponse)
-		return cleanedResponse
-	}
-
-	log.Println("无法从AI响应中提取验证码")
-	return ""
-}
-
-// extractVerificationCode 使用正则表达式提取验证码
-func extractVerificationCode(content string) string {
-	// 先查找明确标记的验证码
-	codeRegex := regexp.MustCompile(`(?i)(验证码|校验码|确认码|code)[^0-9]{0,10}[: ：]?\s*?(\d{4,8})`)
-	if matches := codeRegex.FindStringSubmatch(content); len(matches) > 2 {
-		log.Printf("找到明确标记的验证码: %s", matches[2])
-		return matches[2]
-	}
-
-	// 尝试匹配HTML标签内的数字
-	codeRegex = regexp.MustCompile(`<[^>]*>(\d{4,8})<\/`)
-	if matches := codeRegex.FindStringSubmatch(content); len(matches) > 1 {
-		log.Printf("在HTML标签中找到验证码: %s", matches[1])
-		return matches[1]
-	}
-
-	// 最后尝试匹配任意4-8位数字，但排除可能是年份的数字
-	codeRegex = regexp.MustCompile(`\b\d{4,8}\b`)
-	matches := codeRegex.FindAllString(content, -1)
-	for _, match := range matches {
-		// 如果是4位数字，检查是否是年份
-		if len(match) == 4 && match >= "2020" && match <= "2030" {
-			// 可能是年份，跳过
-			continue
-		}
-		log.Printf("找到可能的验证码: %s", match)
-		return match
-	}
-
-	return ""
-}
-
 // 提取并解码邮件主题
 func decodeEmailSubject(subject string) string {
 	// 尝试解码Base64编码的UTF-8主题
@@ -500,6 +304,12 @@ func (s *SMTPSession) Data(r io.Reader) error {
 	to := s.recipients[0]
 	s.currentMail.To = to
 
+	// 不是我们管理的邮箱时直接丢弃，不解析正文、图片和PDF附件
+	if !s.backend.generator.IsValidEmail(to) {
+		_, err := io.Copy(io.Discard, r)
+		return err
+	}
+
 	// 读取邮件内容
 	buf := new(bytes.Buffer)
 	if _, err := buf.ReadFrom(r); err != nil {
@@ -510,14 +320,21 @@ func (s *SMTPSession) Data(r io.Reader) error {
 	// 保存原始邮件内容
 	s.currentMail.Body = data
 
-	// 提取并解码邮件主题
-	if rawSubject := extractHeaderField(data, "Subject"); rawSubject != "" {
-		// 使用主题解码函数
-		s.currentMail.Subject = decodeEmailSubject(rawSubject)
-		log.Printf("原始主题: %s, 解码后: %s", rawSubject, s.currentMail.Subject)
-	}
+	// 保存未经任何处理的原始字节，并在前面加上本服务的Received头
+	received := s.receivedHeader(to)
+	s.currentMail.Raw = make([]byte, 0, len(received)+buf.Len())
+	s.currentMail.Raw = append(s.currentMail.Raw, received...)
+	s.currentMail.Raw = append(s.currentMail.Raw, buf.Bytes()...)
 
-	// 提取邮件正文内容
+	// 解析邮件，提取正文、操作链接和验证码
+	s.backend.pipeline.Process(s.currentMail, data)
+
+	s.backend.mailReceived <- s.currentMail
+	return nil
+}
+
+// extractBodyFallback 通过正则表达式从原始邮件中提取纯文本和HTML正文
+func extractBodyFallback(data string) (string, string) {
 	var plainText, htmlContent string
 
 	// 检查Content-Type头部
@@ -560,6 +377,17 @@ func (s *SMTPSession) Data(r io.Reader) error {
 			// 清理和修复HTML内容
 			htmlContent = cleanHtmlContent(htmlContent)
 		}
+	} else if strings.Contains(contentType, "text/plain") {
+		// 处理单一纯文本邮件
+		parts := strings.Split(data, "\r\n\r\n")
+		if len(parts) > 1 {
+			plainText = strings.Join(parts[1:], "\r\n\r\n")
+			if strings.Contains(transferEncoding, "base64") {
+				plainText = decodeBase64Content(plainText)
+			} else if strings.Contains(transferEncoding, "quoted-printable") {
+				plainText = decodeQuotedPrintable(plainText)
+			}
+		}
 	} else {
 		// 尝试通过正则表达式找到HTML部分
 		contentTypeRegex := regexp.MustCompile(`Content-Type: text/html[\s\S]*?\r\n\r\n([\s\S]+?)(?:\r\n-+|$)`)
@@ -583,50 +411,32 @@ func (s *SMTPSession) Data(r io.Reader) error {
 		}
 	}
 
-	// 保存处理后的HTML内容
-	if htmlContent != "" {
-		s.currentMail.HtmlContent = htmlContent
-		log.Printf("成功设置HTML内容，长度: %d", len(htmlContent))
-	}
-
-	// 提取验证码
-	if plainText != "" || htmlContent != "" {
-		// 先从HTML内容中提取验证码
-		if htmlContent != "" {
-			s.currentMail.Code = extractCodeWithAI(htmlContent)
-		}
-
-		// 如果HTML中没有找到，尝试从纯文本内容提取
-		if s.currentMail.Code == "" && plainText != "" {
-			s.currentMail.Code = extractCodeWithAI(plainText)
-		}
+	return plainText, htmlContent
+}
 
-		// 如果都没找到，尝试从原始数据提取
-		if s.currentMail.Code == "" {
-			s.currentMail.Code = extractCodeWithAI(data)
-		}
+// receivedHeader 生成本服务添加的Received头
+func (s *SMTPSession) receivedHeader(to string) string {
+	helo := s.conn.Hostname
+	if helo == "" {
+		helo = "unknown"
+	}
 
-		if s.currentMail.Code != "" {
-			log.Printf("提取到验证码: %s", s.currentMail.Code)
-		} else {
-			log.Println("无法从邮件中提取验证码")
-		}
-	} else {
-		// 直接从原始数据提取验证码
-		s.currentMail.Code = extractCodeWithAI(data)
-		if s.currentMail.Code != "" {
-			log.Printf("从原始内容中提取到验证码: %s", s.currentMail.Code)
-		} else {
-			log.Println("无法从邮件中提取验证码")
+	remote := "unknown"
+	if s.conn.RemoteAddr != nil {
+		remote = s.conn.RemoteAddr.String()
+		if host, _, err := net.SplitHostPort(remote); err == nil {
+			remote = host
 		}
 	}
 
-	// 如果是我们管理的邮箱，则发送到通道
-	if s.backend.generator.IsValidEmail(to) {
-		s.backend.mailReceived <- s.currentMail
+	protocol := "SMTP"
+	if s.conn.TLS.HandshakeComplete {
+		protocol = "ESMTPS"
 	}
 
-	return nil
+	return fmt.Sprintf("Received: from %s ([%s])\r\n\tby %s (mail-temp) with %s id %s\r\n\tfor <%s>; %s\r\n",
+		helo, remote, s.backend.domain, protocol, s.currentMail.ID, to,
+		s.currentMail.Timestamp.Format(time.RFC1123Z))
 }
 
 // Reset 实现smtp.Session接口
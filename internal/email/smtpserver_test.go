@@ -0,0 +1,69 @@
+package email
+
+import (
+	"io"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-smtp"
+)
+
+// testMessage 测试用的原始邮件
+const testMessage = "From: sender@example.com\r\nSubject: Your code\r\nContent-Type: text/plain\r\n\r\nYour code is 482913\r\n"
+
+// deliver 通过SMTP会话投递一封邮件
+func deliver(t *testing.T, backend *SMTPBackend, to string) {
+	t.Helper()
+	session, err := backend.NewSession(smtp.ConnectionState{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Mail("sender@example.com", smtp.MailOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Rcpt(to); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Data(strings.NewReader(testMessage)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestDataUnmanagedRecipient 不是本服务管理的邮箱时直接丢弃邮件，不经过解析流程
+func TestDataUnmanagedRecipient(t *testing.T) {
+	generator, _ := newTestGenerator(t)
+	// pipeline为nil，如果邮件进入解析流程会panic
+	backend := &SMTPBackend{domain: "t.test", generator: generator, mailReceived: make(chan *Mail, 1)}
+
+	deliver(t, backend, "nobody@t.test")
+	if len(backend.mailReceived) != 0 {
+		t.Errorf("期望丢弃邮件，实际收到%d封", len(backend.mailReceived))
+	}
+}
+
+// TestDataManagedRecipient 本服务管理的邮箱（不区分大小写）收到的邮件经过解析后发送到通道
+func TestDataManagedRecipient(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	generator, _ := newTestGenerator(t)
+	if _, err := generator.CreateEmail(CreateEmailOptions{Username: "inbox"}); err != nil {
+		t.Fatal(err)
+	}
+	extractor, err := NewCodeExtractorChain([]string{"regex"}, ExtractorOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := &SMTPBackend{domain: "t.test", generator: generator, pipeline: NewPipeline(extractor), mailReceived: make(chan *Mail, 1)}
+
+	deliver(t, backend, "Inbox@t.test")
+	if len(backend.mailReceived) != 1 {
+		t.Fatalf("期望收到1封邮件，实际 %d", len(backend.mailReceived))
+	}
+	mail := <-backend.mailReceived
+	if mail.Subject != "Your code" {
+		t.Errorf("期望主题为Your code，实际 %q", mail.Subject)
+	}
+}
@@ -0,0 +1,50 @@
+package email
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// 访问令牌的随机字节数（256位）
+const accessTokenBytes = 32
+
+// ErrInvalidToken 缺少访问令牌，或令牌与邮箱不匹配
+var ErrInvalidToken = errors.New("无效的邮箱地址或访问令牌")
+
+// newAccessToken 生成不可猜测的访问令牌，返回令牌和保存到存储中的哈希
+func newAccessToken() (token, hash string, err error) {
+	b := make([]byte, accessTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", fmt.Errorf("%w: %v", ErrRandomUnavailable, err)
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, hashAccessToken(token), nil
+}
+
+// hashAccessToken 计算访问令牌的SHA-256哈希；令牌本身有256位随机数，不需要加盐或慢哈希
+func hashAccessToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// isTokenHash 检查保存的值是否是访问令牌的哈希；启用访问令牌之前创建的Redis邮箱保存的是"1"
+func isTokenHash(hash string) bool {
+	if len(hash) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(hash)
+	return err == nil
+}
+
+// tokenMatches 以固定时间比较令牌与保存的哈希
+func tokenMatches(token, hash string) bool {
+	if token == "" || hash == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(hashAccessToken(token)), []byte(hash)) == 1
+}
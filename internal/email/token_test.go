@@ -0,0 +1,110 @@
+package email
+
+import (
+	"errors"
+	"io"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"mail-temp/internal/repository"
+)
+
+// newTestGenerator 创建使用内存存储的邮箱生成器
+func newTestGenerator(t *testing.T) (*EmailGenerator, *repository.MemoryStorage) {
+	t.Helper()
+	storage := repository.NewMemoryStorage()
+	generator, err := NewEmailGenerator("t.test", storage, UsernameOptions{},
+		MailboxTTLOptions{Default: time.Hour, Min: time.Minute, Max: 24 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return generator, storage
+}
+
+// TestAuthorize 只有创建邮箱时返回的令牌能通过，其他邮箱的令牌、空令牌和不存在的邮箱都返回ErrInvalidToken
+func TestAuthorize(t *testing.T) {
+	generator, _ := newTestGenerator(t)
+	mailbox, err := generator.CreateEmail(CreateEmailOptions{Username: "owner"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := generator.CreateEmail(CreateEmailOptions{Username: "other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := generator.Authorize(mailbox.Address, mailbox.Token); err != nil {
+		t.Errorf("正确的令牌: %v", err)
+	}
+	for name, tc := range map[string]struct{ email, token string }{
+		"其他邮箱的令牌": {mailbox.Address, other.Token},
+		"空令牌":     {mailbox.Address, ""},
+		"令牌哈希":    {mailbox.Address, hashAccessToken(mailbox.Token)},
+		"不存在的邮箱":  {"nobody@t.test", mailbox.Token},
+	} {
+		if err := generator.Authorize(tc.email, tc.token); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: 期望ErrInvalidToken，实际 %v", name, err)
+		}
+	}
+}
+
+// TestIssueToken 重新签发的令牌替换旧令牌，启用令牌之前创建的邮箱签发后可以读取
+func TestIssueToken(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	generator, storage := newTestGenerator(t)
+	if _, err := storage.CreateActiveEmail("legacy", time.Hour, "1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := generator.Authorize("legacy@t.test", "1"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("没有令牌哈希的邮箱: 期望ErrInvalidToken，实际 %v", err)
+	}
+
+	mailbox, err := generator.IssueToken("legacy@t.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mailbox.Address != "legacy@t.test" || mailbox.Token == "" || mailbox.ExpiresAt.IsZero() {
+		t.Errorf("签发结果不正确: %+v", mailbox)
+	}
+	if err := generator.Authorize("legacy@t.test", mailbox.Token); err != nil {
+		t.Errorf("新令牌: %v", err)
+	}
+
+	again, err := generator.IssueToken("legacy@t.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := generator.Authorize("legacy@t.test", mailbox.Token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("旧令牌应当失效，实际 %v", err)
+	}
+	if err := generator.Authorize("legacy@t.test", again.Token); err != nil {
+		t.Errorf("再次签发的令牌: %v", err)
+	}
+
+	if _, err := generator.IssueToken("nobody@t.test"); !errors.Is(err, ErrMailboxNotFound) {
+		t.Errorf("不存在的邮箱: 期望ErrMailboxNotFound，实际 %v", err)
+	}
+}
+
+// TestIsTokenHash 只有64位十六进制字符串是令牌哈希
+func TestIsTokenHash(t *testing.T) {
+	_, hash, err := newAccessToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for value, want := range map[string]bool{
+		hash:            true,
+		"1":             false,
+		"":              false,
+		hash[:63] + "g": false,
+		hash + "00":     false,
+	} {
+		if got := isTokenHash(value); got != want {
+			t.Errorf("%q: 期望%v，实际%v", value, want, got)
+		}
+	}
+}
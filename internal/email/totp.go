@@ -0,0 +1,194 @@
+package email
+
+import (
+	"html"
+	"log"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+
+	"mail-temp/internal/repository"
+	"mail-temp/internal/totp"
+)
+
+// 两步验证密钥的来源
+const (
+	TOTPSourceURI   = "uri"   // 正文或HTML中的otpauth://链接
+	TOTPSourceImage = "image" // 图片中的otpauth://二维码
+	TOTPSourceText  = "text"  // 正文中"密钥: XXXX"形式的Base32密钥
+)
+
+const (
+	// 密钥关键词与密钥之间的最大字节数
+	totpKeywordDistance = 64
+	// 每封邮件最多保存的密钥数
+	maxTOTPKeys = 5
+)
+
+// totpKeywords 正文中Base32密钥前面常见的关键词
+var totpKeywords = []string{
+	"secret", "secret key", "setup key", "manual key", "manual entry key", "authenticator key",
+	"2fa key", "totp key", "otp key", "key",
+	"密钥", "秘钥", "密鑰", "金鑰", "秘密鍵", "シークレットキー", "セットアップキー", "비밀 키", "보안 키",
+	"Geheimschlüssel", "clave secreta", "clé secrète", "chiave segreta", "chave secreta", "секретный ключ",
+}
+
+var (
+	// otpauth://totp/链接，遇到空白、引号或尖括号结束
+	otpauthURIPattern = regexp.MustCompile(`(?i)otpauth://totp/[^\s"'<>]+`)
+	// 大写的Base32密钥，可以每4个字符用空格分组，例如"JBSW Y3DP EHPK 3PXP"
+	totpSecretPattern = regexp.MustCompile(`\b(?:[A-Z2-7]{16,}|[A-Z2-7]{4}(?: [A-Z2-7]{4}){3,}(?: [A-Z2-7]{1,3})?)\b`)
+	// 密钥关键词，全部语言合并
+	totpKeywordPattern = regexp.MustCompile(`(?i)(?:` + keywordAlternation(totpKeywords) + `)\s*[:：]?\s*$`)
+)
+
+// extractTOTPKeys 从otpauth://链接（正文、HTML、图片中的二维码）和正文中的Base32密钥提取两步验证密钥，
+// 按密钥去重；链接中没有发行方和账号时，使用发件人名称和收件地址
+func extractTOTPKeys(text, htmlContent string, images []repository.ImageCode, from, to string) []repository.TOTPKey {
+	var keys []repository.TOTPKey
+	seen := make(map[string]bool)
+	add := func(key *totp.Key, source string) {
+		if len(keys) >= maxTOTPKeys || seen[key.Secret] {
+			return
+		}
+		seen[key.Secret] = true
+		if key.Issuer == "" {
+			key.Issuer = senderName(from)
+		}
+		if key.Account == "" {
+			key.Account = to
+		}
+		log.Printf("提取到两步验证密钥: 发行方=%s, 账号=%s, 来源=%s", key.Issuer, key.Account, source)
+		keys = append(keys, repository.TOTPKey{
+			Issuer:    key.Issuer,
+			Account:   key.Account,
+			Secret:    key.Secret,
+			Algorithm: key.Algorithm,
+			Digits:    key.Digits,
+			Period:    key.Period,
+			Source:    source,
+		})
+	}
+
+	for _, image := range images {
+		if image.Kind != ImageCodeOTPAuth {
+			continue
+		}
+		if key, err := totp.ParseURI(image.Payload); err == nil {
+			add(key, TOTPSourceImage)
+		}
+	}
+	// HTML中的链接可能只出现在href属性里，并且&被转义为&amp;
+	for _, content := range []string{text, html.UnescapeString(htmlContent)} {
+		for _, uri := range otpauthURIPattern.FindAllString(content, -1) {
+			if key, err := totp.ParseURI(uri); err == nil {
+				add(key, TOTPSourceURI)
+			} else {
+				log.Printf("无法解析otpauth链接: %v", err)
+			}
+		}
+	}
+	for _, m := range totpSecretPattern.FindAllStringIndex(text, -1) {
+		secret := text[m[0]:m[1]]
+		// 全是字母的通常是大写的单词或标识，而不是密钥
+		if !strings.ContainsAny(secret, "234567") {
+			continue
+		}
+		if !totpKeywordPattern.MatchString(lineBefore(text, m[0], totpKeywordDistance)) {
+			continue
+		}
+		if key, err := totp.NewKey(secret); err == nil {
+			add(key, TOTPSourceText)
+		}
+	}
+	return keys
+}
+
+// withoutTOTPSecrets 去除属于两步验证密钥一部分的验证码候选，例如分组密钥"JBSW Y3DP"中的"Y3DP"
+func withoutTOTPSecrets(candidates []repository.CodeCandidate, keys []repository.TOTPKey) []repository.CodeCandidate {
+	if len(keys) == 0 {
+		return candidates
+	}
+	filtered := candidates[:0]
+	for _, candidate := range candidates {
+		secret := false
+		for _, key := range keys {
+			if strings.Contains(key.Secret, strings.ToUpper(candidate.Code)) {
+				secret = true
+				break
+			}
+		}
+		if !secret {
+			filtered = append(filtered, candidate)
+		}
+	}
+	return filtered
+}
+
+// senderName 返回发件人的显示名称，没有时返回域名
+func senderName(from string) string {
+	address, err := mail.ParseAddress(from)
+	if err != nil {
+		return ""
+	}
+	if address.Name != "" {
+		return address.Name
+	}
+	if i := strings.LastIndexByte(address.Address, '@'); i >= 0 {
+		return address.Address[i+1:]
+	}
+	return ""
+}
+
+// TOTPCode 根据邮件中的两步验证密钥计算出的当前验证码
+type TOTPCode struct {
+	Code      string    `json:"code"`
+	Issuer    string    `json:"issuer,omitempty"`
+	Account   string    `json:"account,omitempty"`
+	Algorithm string    `json:"algorithm"`
+	Digits    int       `json:"digits"`
+	Period    int       `json:"period"`
+	ExpiresAt time.Time `json:"expiresAt"` // 当前验证码失效的时间
+	ExpiresIn int       `json:"expiresIn"` // 当前验证码还剩多少秒失效
+	MessageID string    `json:"messageId"` // 密钥所在邮件的ID
+}
+
+// matchesTOTPKey 检查密钥的发行方和账号是否包含给定的值（不区分大小写），为空时不过滤
+func matchesTOTPKey(key repository.TOTPKey, issuer, account string) bool {
+	contains := func(value, filter string) bool {
+		return filter == "" || strings.Contains(strings.ToLower(value), strings.ToLower(filter))
+	}
+	return contains(key.Issuer, issuer) && contains(key.Account, account)
+}
+
+// newTOTPCode 计算密钥在时间now的验证码
+func newTOTPCode(stored repository.TOTPKey, messageID string, now time.Time) (*TOTPCode, error) {
+	key := &totp.Key{
+		Issuer:    stored.Issuer,
+		Account:   stored.Account,
+		Secret:    stored.Secret,
+		Algorithm: stored.Algorithm,
+		Digits:    stored.Digits,
+		Period:    stored.Period,
+	}
+	if err := key.Validate(); err != nil {
+		return nil, err
+	}
+	code, err := key.Code(now)
+	if err != nil {
+		return nil, err
+	}
+	remaining := key.Remaining(now)
+	return &TOTPCode{
+		Code:      code,
+		Issuer:    key.Issuer,
+		Account:   key.Account,
+		Algorithm: key.Algorithm,
+		Digits:    key.Digits,
+		Period:    key.Period,
+		ExpiresAt: now.Add(remaining).Truncate(time.Second),
+		ExpiresIn: int(remaining.Round(time.Second) / time.Second),
+		MessageID: messageID,
+	}, nil
+}
@@ -0,0 +1,59 @@
+package email
+
+import (
+	"io"
+	"log"
+	"os"
+	"reflect"
+	"testing"
+
+	"mail-temp/internal/repository"
+)
+
+// codesOf 返回候选验证码列表中的验证码
+func codesOf(candidates []repository.CodeCandidate) []string {
+	codes := make([]string, 0, len(candidates))
+	for _, candidate := range candidates {
+		codes = append(codes, candidate.Code)
+	}
+	return codes
+}
+
+// TestWithoutTOTPSecrets 去除密钥片段（不区分大小写），保留其他验证码；没有密钥时原样返回
+func TestWithoutTOTPSecrets(t *testing.T) {
+	candidates := func() []repository.CodeCandidate {
+		return []repository.CodeCandidate{{Code: "Y3DP"}, {Code: "482913"}, {Code: "ehpk"}, {Code: "JBSWY3DPEHPK3PXP"}, {Code: "AB12"}}
+	}
+	keys := []repository.TOTPKey{{Secret: "JBSWY3DPEHPK3PXP"}}
+
+	if got := codesOf(withoutTOTPSecrets(candidates(), keys)); !reflect.DeepEqual(got, []string{"482913", "AB12"}) {
+		t.Errorf("期望[482913 AB12]，实际 %v", got)
+	}
+	if got := codesOf(withoutTOTPSecrets(candidates(), nil)); len(got) != 5 {
+		t.Errorf("没有密钥时期望保留全部5个候选，实际 %v", got)
+	}
+	if got := withoutTOTPSecrets(nil, keys); len(got) != 0 {
+		t.Errorf("期望空列表，实际 %v", got)
+	}
+}
+
+// TestExtractTOTPKeys 从链接和关键词后的分组密钥中提取，按密钥去重，缺少的发行方和账号使用发件人和收件地址
+func TestExtractTOTPKeys(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	text := "Scan the QR code or open otpauth://totp/ACME:alice?secret=JBSWY3DPEHPK3PXP&digits=8\n" +
+		"Setup key: JBSW Y3DP EHPK 3PXP\n" +
+		"Manual key: GEZD GNBV GY3T QOJQ\n" +
+		"Order number: MFRGGZDFMZTWQ2LK\n"
+	keys := extractTOTPKeys(text, "", nil, "ACME Security <security@acme.example>", "alice@t.test")
+	if len(keys) != 2 {
+		t.Fatalf("期望2个密钥，实际 %+v", keys)
+	}
+	if keys[0].Source != TOTPSourceURI || keys[0].Issuer != "ACME" || keys[0].Account != "alice" || keys[0].Digits != 8 {
+		t.Errorf("链接中的密钥不正确: %+v", keys[0])
+	}
+	if keys[1].Secret != "GEZDGNBVGY3TQOJQ" || keys[1].Source != TOTPSourceText || keys[1].Issuer != "ACME Security" || keys[1].Account != "alice@t.test" {
+		t.Errorf("正文中的密钥不正确: %+v", keys[1])
+	}
+}
@@ -0,0 +1,93 @@
+package email
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// 已知邮件追踪服务的地址，匹配时直接移除图片
+var trackingURLPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)^https?://[^/?#]*list-manage\.com/track/open\.php`),                                                                                  // Mailchimp
+	regexp.MustCompile(`(?i)^https?://[^/?#]*mandrillapp\.com/track/open\.php`),                                                                                  // Mandrill
+	regexp.MustCompile(`(?i)^https?://[^/?#]+/wf/open\?upn=`),                                                                                                    // SendGrid
+	regexp.MustCompile(`(?i)^https?://[^/?#]*\.(mailgun|mgsend)\.[a-z]+/o/`),                                                                                     // Mailgun
+	regexp.MustCompile(`(?i)^https?://[^/?#]*(hubspot|hubspotemail|hubspotlinks)\.(com|net)/(e[0-9]?t/o|__ptq\.gif)`),                                            // HubSpot
+	regexp.MustCompile(`(?i)^https?://([a-z0-9-]+\.)*(emltrk\.com|mailtrack\.io|mixmax\.com|yesware\.com|bananatag\.com|getnotify\.com|streak\.com)(:[0-9]+)?/`), // 邮件追踪插件
+}
+
+// 追踪像素常用的通用地址特征，普通图片也可能使用，只有同时声明了不超过1像素的宽或高时才移除
+var pixelURLPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)/(track|tracking|trk)/(open|o)\b`),
+	regexp.MustCompile(`(?i)/(open|opened|beacon|pixel|openrate)(\.gif|\.png|\.jpg|\.php|\.aspx)?([?/]|$)`),
+	regexp.MustCompile(`(?i)/(spacer|blank|clear|t)\.gif([?#]|$)`),
+}
+
+// 匹配style中的宽高声明
+var (
+	styleWidthPattern  = regexp.MustCompile(`(?i)(?:^|;|\s)(?:max-)?width\s*:\s*([0-9.]+)px`)
+	styleHeightPattern = regexp.MustCompile(`(?i)(?:^|;|\s)(?:max-)?height\s*:\s*([0-9.]+)px`)
+	styleHiddenPattern = regexp.MustCompile(`(?i)display\s*:\s*none|visibility\s*:\s*hidden|opacity\s*:\s*0(?:\.0+)?\s*(?:;|$)`)
+)
+
+// isTrackingPixel 判断<img>是否为追踪像素
+func isTrackingPixel(n *html.Node) bool {
+	src := strings.TrimSpace(getAttr(n, "src"))
+	if src == "" {
+		return false
+	}
+
+	// 尺寸不超过1x1或被隐藏的图片
+	style := getAttr(n, "style")
+	if styleHiddenPattern.MatchString(style) {
+		return true
+	}
+
+	width, hasWidth := imageDimension(getAttr(n, "width"), styleWidthPattern, style)
+	height, hasHeight := imageDimension(getAttr(n, "height"), styleHeightPattern, style)
+	if hasWidth && hasHeight && width <= 1 && height <= 1 {
+		return true
+	}
+	if (hasWidth && width == 0) || (hasHeight && height == 0) {
+		return true
+	}
+
+	if !isRemoteURL(src) {
+		return false
+	}
+
+	// 已知的追踪服务地址
+	if matchesAny(trackingURLPatterns, src) {
+		return true
+	}
+
+	// 通用的追踪地址特征，只声明了一边尺寸的像素图片
+	tiny := (hasWidth && width <= 1) || (hasHeight && height <= 1)
+	return tiny && matchesAny(pixelURLPatterns, src)
+}
+
+// matchesAny 检查地址是否匹配任一模式
+func matchesAny(patterns []*regexp.Regexp, value string) bool {
+	for _, pattern := range patterns {
+		if pattern.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// imageDimension 从属性或style中解析图片尺寸
+func imageDimension(attr string, stylePattern *regexp.Regexp, style string) (float64, bool) {
+	attr = strings.TrimSuffix(strings.TrimSpace(attr), "px")
+	if value, err := strconv.ParseFloat(attr, 64); err == nil {
+		return value, true
+	}
+	if matches := stylePattern.FindStringSubmatch(style); len(matches) > 1 {
+		if value, err := strconv.ParseFloat(matches[1], 64); err == nil {
+			return value, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,67 @@
+package email
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+// TestIsTrackingPixel 已知追踪服务的图片直接移除，通用的追踪地址特征还需要像素尺寸，普通内容图片保留
+func TestIsTrackingPixel(t *testing.T) {
+	tests := []struct {
+		img  string
+		want bool
+	}{
+		{`<img src="https://example.us1.list-manage.com/track/open.php?u=1&id=2">`, true},
+		{`<img src="https://u123.ct.sendgrid.net/wf/open?upn=abc">`, true},
+		{`<img src="https://email.mailgun.net/o/abc">`, true},
+		{`<img src="https://t.hubspotemail.net/e1t/o/abc">`, true},
+		{`<img src="https://app.mailtrack.io/trace/mail/abc.png">`, true},
+		{`<img src="https://example.com/logo.png" width="1" height="1">`, true},
+		{`<img src="https://example.com/logo.png" style="display:none">`, true},
+		{`<img src="https://example.com/logo.png" height="0">`, true},
+		{`<img src="https://example.com/open/abc.gif" width="1">`, true},
+		{`<img src="https://example.com/t.gif" height="1px">`, true},
+
+		{`<img src="https://example.com/t.gif">`, false},
+		{`<img src="https://example.com/t.gif" width="600">`, false},
+		{`<img src="https://example.com/open/banner.png">`, false},
+		{`<img src="https://cdn.example.com/pixel/hero.jpg" width="600" height="300">`, false},
+		{`<img src="https://example.com/track/open">`, false},
+		{`<img src="https://example.com/images/winstreak.png">`, false},
+		{`<img src="https://example.com/logo.png" width="1">`, false},
+	}
+
+	for _, tt := range tests {
+		if got := isTrackingPixel(parseImg(t, tt.img)); got != tt.want {
+			t.Errorf("%s: 期望 %v，实际 %v", tt.img, tt.want, got)
+		}
+	}
+}
+
+// parseImg 解析HTML片段并返回其中的<img>节点
+func parseImg(t *testing.T, fragment string) *html.Node {
+	t.Helper()
+	doc, err := html.Parse(strings.NewReader(fragment))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var find func(*html.Node) *html.Node
+	find = func(n *html.Node) *html.Node {
+		if n.Type == html.ElementNode && n.Data == "img" {
+			return n
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if img := find(c); img != nil {
+				return img
+			}
+		}
+		return nil
+	}
+	img := find(doc)
+	if img == nil {
+		t.Fatalf("%s 中没有<img>", fragment)
+	}
+	return img
+}
@@ -0,0 +1,283 @@
+package email
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+// 内置的用户名生成策略
+const (
+	UsernameHex       = "hex"       // 随机十六进制，例如3fa9c2e71b
+	UsernameWords     = "words"     // 形容词-名词-数字，例如brave-otter-482913
+	UsernamePinyin    = "pinyin"    // 拼音音节，例如lanfeng-shuyu
+	UsernameSyllables = "syllables" // 易读的辅音+元音音节，例如bakoti-murela
+)
+
+const (
+	// 默认的十六进制用户名长度
+	defaultHexUsernameLength = 10
+	// 默认的最小熵（位），用于单词和音节策略
+	defaultUsernameEntropy = 32
+	// 单词策略中数字部分的位数范围，上限受int64限制
+	minUsernameNumberDigits = 2
+	maxUsernameNumberDigits = 18
+)
+
+// ErrUnknownUsernameStrategy 未知的用户名生成策略
+var ErrUnknownUsernameStrategy = errors.New("未知的用户名生成策略")
+
+// UsernameStrategy 随机用户名生成策略
+type UsernameStrategy interface {
+	Name() string
+	Generate() (string, error)
+}
+
+// UsernameOptions 用户名生成配置
+type UsernameOptions struct {
+	Strategy  string // 默认策略，为空时使用hex
+	HexLength int    // 十六进制用户名的长度
+	Entropy   int    // 单词和音节策略的最小熵（位）
+}
+
+// UsernameStrategies 返回支持的策略名称
+func UsernameStrategies() []string {
+	return []string{UsernameHex, UsernameWords, UsernamePinyin, UsernameSyllables}
+}
+
+// NewUsernameStrategy 按名称创建用户名生成策略，支持hex、words、pinyin和syllables
+func NewUsernameStrategy(name string, opts UsernameOptions) (UsernameStrategy, error) {
+	entropy := opts.Entropy
+	if entropy <= 0 {
+		entropy = defaultUsernameEntropy
+	}
+
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case UsernameHex, "":
+		length := opts.HexLength
+		if length <= 0 {
+			length = defaultHexUsernameLength
+		}
+		if length > maxUsernameLength {
+			length = maxUsernameLength
+		}
+		return &hexUsernameStrategy{length: length}, nil
+	case UsernameWords:
+		return newWordsUsernameStrategy(entropy), nil
+	case UsernamePinyin:
+		return newSyllableUsernameStrategy(UsernamePinyin, pinyinSyllables, 2, entropy), nil
+	case UsernameSyllables:
+		return newSyllableUsernameStrategy(UsernameSyllables, pronounceableSyllables, 3, entropy), nil
+	}
+	return nil, fmt.Errorf("%w: %s（支持%s）", ErrUnknownUsernameStrategy, name, strings.Join(UsernameStrategies(), "、"))
+}
+
+// hexUsernameStrategy 随机十六进制用户名
+type hexUsernameStrategy struct {
+	length int
+}
+
+// Name 实现UsernameStrategy接口
+func (s *hexUsernameStrategy) Name() string {
+	return UsernameHex
+}
+
+// Generate 实现UsernameStrategy接口
+func (s *hexUsernameStrategy) Generate() (string, error) {
+	return generateRandomString(s.length)
+}
+
+// wordsUsernameStrategy 形容词-名词-数字，数字位数按最小熵计算
+type wordsUsernameStrategy struct {
+	digits int
+}
+
+// newWordsUsernameStrategy 创建单词策略，形容词和名词不足的熵由数字补足
+func newWordsUsernameStrategy(entropy int) *wordsUsernameStrategy {
+	wordBits := math.Log2(float64(len(usernameAdjectives))) + math.Log2(float64(len(usernameNouns)))
+	digits := int(math.Ceil((float64(entropy) - wordBits) / math.Log2(10)))
+	if digits < minUsernameNumberDigits {
+		digits = minUsernameNumberDigits
+	}
+	if digits > maxUsernameNumberDigits {
+		digits = maxUsernameNumberDigits
+	}
+	return &wordsUsernameStrategy{digits: digits}
+}
+
+// Name 实现UsernameStrategy接口
+func (s *wordsUsernameStrategy) Name() string {
+	return UsernameWords
+}
+
+// Generate 实现UsernameStrategy接口
+func (s *wordsUsernameStrategy) Generate() (string, error) {
+	adjective, err := randomChoice(usernameAdjectives)
+	if err != nil {
+		return "", err
+	}
+	noun, err := randomChoice(usernameNouns)
+	if err != nil {
+		return "", err
+	}
+	number, err := randomInt(int64(math.Pow10(s.digits)))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s-%s-%0*d", adjective, noun, s.digits, number), nil
+}
+
+// syllableUsernameStrategy 由随机音节组成的用户名，每group个音节用连字符分隔
+type syllableUsernameStrategy struct {
+	name      string
+	syllables []string
+	group     int
+	count     int
+}
+
+// newSyllableUsernameStrategy 创建音节策略，音节数按最小熵计算
+func newSyllableUsernameStrategy(name string, syllables []string, group, entropy int) *syllableUsernameStrategy {
+	count := int(math.Ceil(float64(entropy) / math.Log2(float64(len(syllables)))))
+	if count < group {
+		count = group
+	}
+	// 保证总长度不超过本地部分的上限
+	per := maxWordLength(syllables) + 1
+	if max := (maxUsernameLength + 1) / per; count > max {
+		count = max
+	}
+	return &syllableUsernameStrategy{name: name, syllables: syllables, group: group, count: count}
+}
+
+// Name 实现UsernameStrategy接口
+func (s *syllableUsernameStrategy) Name() string {
+	return s.name
+}
+
+// Generate 实现UsernameStrategy接口
+func (s *syllableUsernameStrategy) Generate() (string, error) {
+	var sb strings.Builder
+	for i := 0; i < s.count; i++ {
+		if i > 0 && i%s.group == 0 {
+			sb.WriteByte('-')
+		}
+		syllable, err := randomChoice(s.syllables)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(syllable)
+	}
+	return sb.String(), nil
+}
+
+// randomChoice 使用crypto/rand从列表中均匀选择一项
+func randomChoice(items []string) (string, error) {
+	i, err := randomInt(int64(len(items)))
+	if err != nil {
+		return "", err
+	}
+	return items[i], nil
+}
+
+// randomInt 使用crypto/rand返回[0, n)中的随机数
+func randomInt(n int64) (int64, error) {
+	v, err := rand.Int(rand.Reader, big.NewInt(n))
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrRandomUnavailable, err)
+	}
+	return v.Int64(), nil
+}
+
+// maxWordLength 返回列表中最长一项的长度
+func maxWordLength(words []string) int {
+	n := 0
+	for _, word := range words {
+		if len(word) > n {
+			n = len(word)
+		}
+	}
+	return n
+}
+
+// uniqueWords 去重并排序，保证列表中的每一项被选中的概率相同
+func uniqueWords(words ...string) []string {
+	seen := make(map[string]bool, len(words))
+	result := make([]string, 0, len(words))
+	for _, word := range words {
+		if !seen[word] {
+			seen[word] = true
+			result = append(result, word)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// usernameAdjectives 单词策略使用的形容词，都是简短、易拼写的常见词
+var usernameAdjectives = uniqueWords(
+	"able", "acid", "agile", "airy", "alert", "amber", "ample", "aqua", "arctic", "azure",
+	"bold", "brave", "brief", "bright", "brisk", "broad", "busy", "calm", "candid", "cheery",
+	"chief", "civil", "clean", "clear", "clever", "cloudy", "cool", "cosmic", "cozy", "crisp",
+	"curly", "cute", "daily", "dapper", "deep", "dizzy", "dusty", "eager", "early", "easy",
+	"elder", "empty", "epic", "equal", "exact", "fair", "fancy", "fast", "fierce", "fine",
+	"firm", "fluffy", "fond", "free", "fresh", "frosty", "funny", "fuzzy", "gentle", "giant",
+	"glad", "golden", "grand", "green", "happy", "hardy", "hazy", "humble", "icy", "ideal",
+	"jolly", "jumpy", "keen", "kind", "large", "lazy", "light", "little", "lively", "lucky",
+	"lunar", "magic", "merry", "mighty", "mild", "misty", "modern", "noble", "odd", "olive",
+	"plain", "polite", "proud", "quick", "quiet", "rapid", "rare", "ready", "rosy", "royal",
+	"rustic", "safe", "salty", "sandy", "sharp", "shiny", "silent", "silver", "simple", "sleek",
+	"smart", "snowy", "solar", "solid", "spicy", "steady", "sunny", "super", "sweet", "swift",
+	"tidy", "tiny", "vivid", "warm", "wild", "windy", "wise", "witty",
+)
+
+// usernameNouns 单词策略使用的名词，以动物、植物和自然景物为主
+var usernameNouns = uniqueWords(
+	"acorn", "badger", "bamboo", "beacon", "bear", "beaver", "birch", "bison", "breeze", "brook",
+	"cactus", "camel", "canyon", "cedar", "cheetah", "cliff", "cloud", "clover", "comet", "coral",
+	"cougar", "crane", "creek", "daisy", "delta", "dolphin", "dove", "dune", "eagle", "ember",
+	"falcon", "fern", "finch", "fjord", "flame", "forest", "fox", "gecko", "glacier", "grove",
+	"harbor", "hawk", "hedgehog", "heron", "hill", "iris", "island", "ivy", "jaguar", "koala",
+	"lagoon", "lake", "lark", "leaf", "lemur", "lily", "lion", "lotus", "lynx", "maple",
+	"meadow", "meteor", "moose", "moss", "moth", "nebula", "newt", "oak", "ocean", "orca",
+	"orchid", "otter", "owl", "panda", "parrot", "peak", "pebble", "pelican", "penguin", "pine",
+	"planet", "plum", "pond", "poppy", "prairie", "puffin", "quail", "rabbit", "raven", "reef",
+	"ridge", "river", "robin", "rose", "salmon", "sparrow", "spruce", "squid", "star", "stone",
+	"stork", "summit", "swan", "thistle", "tiger", "toucan", "tulip", "tundra", "turtle", "valley",
+	"violet", "walrus", "whale", "willow", "wolf", "wren", "yak", "zebra",
+)
+
+// pinyinSyllables 拼音策略使用的不带声调的常见拼音音节
+var pinyinSyllables = uniqueWords(
+	"ba", "bai", "ban", "bang", "bao", "bei", "ben", "bi", "bian", "bin", "bo", "bu",
+	"cai", "can", "cao", "chang", "chao", "chen", "cheng", "chu", "chun", "ci", "cong", "cui",
+	"da", "dai", "dan", "dao", "de", "deng", "di", "dian", "ding", "dong", "du", "duan",
+	"fa", "fan", "fang", "fei", "fen", "feng", "fu", "gang", "gao", "ge", "gen", "gong",
+	"gu", "guan", "guang", "gui", "guo", "hai", "han", "hao", "he", "heng", "hong", "hou",
+	"hu", "hua", "huai", "huan", "huang", "hui", "huo", "ji", "jia", "jian", "jiang", "jiao",
+	"jie", "jin", "jing", "jiu", "ju", "juan", "jun", "kai", "kang", "ke", "kong", "kun",
+	"lai", "lan", "lang", "lao", "le", "lei", "li", "lian", "liang", "lin", "ling", "liu",
+	"long", "lu", "luo", "ma", "mai", "man", "mao", "mei", "meng", "mi", "miao", "min",
+	"ming", "mo", "mu", "na", "nan", "ni", "nian", "ning", "niu", "nuo", "pan", "pei",
+	"peng", "pin", "ping", "pu", "qi", "qian", "qiang", "qiao", "qin", "qing", "qiu", "quan",
+	"ran", "ren", "rong", "ru", "rui", "run", "sen", "shan", "shang", "shao", "shen", "sheng",
+	"shi", "shu", "shuang", "shui", "shun", "si", "song", "su", "sui", "sun", "tai", "tan",
+	"tang", "tao", "tian", "ting", "tong", "tu", "wan", "wang", "wei", "wen", "wu", "xi",
+	"xia", "xian", "xiang", "xiao", "xin", "xing", "xiong", "xiu", "xu", "xuan", "xue", "ya",
+	"yan", "yang", "yao", "ye", "yi", "yin", "ying", "yong", "you", "yu", "yuan", "yue",
+	"yun", "ze", "zhan", "zhang", "zhao", "zhen", "zheng", "zhi", "zhong", "zhou", "zhu", "zi",
+)
+
+// pronounceableSyllables 音节策略使用的辅音+元音音节，去掉了容易听错或写错的辅音（c、q、x、j等）
+var pronounceableSyllables = func() []string {
+	var syllables []string
+	for _, consonant := range "bdfghklmnprstvz" {
+		for _, vowel := range "aeiou" {
+			syllables = append(syllables, string(consonant)+string(vowel))
+		}
+	}
+	return syllables
+}()
@@ -1,51 +1,220 @@
 package handler
 
 import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"mail-temp/internal/email"
 )
 
+// 事件流的心跳间隔
+const eventHeartbeatInterval = 30 * time.Second
+
 // APIHandler API处理器
 type APIHandler struct {
 	emailGenerator *email.EmailGenerator
 	emailReceiver  *email.EmailReceiver
+	adminToken     string // 获取全部活跃邮箱时使用的管理令牌，为空时不允许
 }
 
 // NewAPIHandler 创建API处理器
-func NewAPIHandler(generator *email.EmailGenerator, receiver *email.EmailReceiver) *APIHandler {
+func NewAPIHandler(generator *email.EmailGenerator, receiver *email.EmailReceiver, adminToken string) *APIHandler {
 	return &APIHandler{
 		emailGenerator: generator,
 		emailReceiver:  receiver,
+		adminToken:     adminToken,
 	}
 }
 
 // SetupRoutes 设置路由
 func (h *APIHandler) SetupRoutes(router *gin.Engine) {
 	api := router.Group("/api")
+	auth := requireToken(h.emailGenerator)
 	{
 		// 创建新的临时邮箱
 		api.GET("/email/new", h.CreateEmail)
 
+		// 使用指定的用户名创建临时邮箱
+		api.POST("/email", h.CreateNamedEmail)
+
 		// 获取指定邮箱的所有邮件
-		api.GET("/email/:email/messages", h.GetMessages)
+		api.GET("/email/:email/messages", auth, h.GetMessages)
+
+		// 获取指定邮件的详情
+		api.GET("/email/:email/messages/:id", auth, h.GetMessage)
+
+		// 获取指定邮箱最新的、未过期的验证码
+		api.GET("/email/:email/code", auth, h.GetLatestCode)
+
+		// 使用指定邮箱收到的两步验证密钥计算当前的TOTP验证码
+		api.GET("/email/:email/totp", auth, h.GetTOTPCode)
+
+		// 下载指定邮件的原始内容(.eml)
+		api.GET("/email/:email/messages/:id/raw", auth, h.GetRawMessage)
+
+		// 订阅指定邮箱的新邮件和更新事件(Server-Sent Events)
+		api.GET("/email/:email/events", auth, h.StreamEvents)
 
 		// 获取活跃的临时邮箱列表
 		api.GET("/email/list", h.ListEmails)
 
+		// 延长临时邮箱的有效期
+		api.POST("/email/:email/extend", auth, h.ExtendEmail)
+
+		// 重新签发邮箱的访问令牌（需要管理令牌）
+		api.POST("/email/:email/token", h.IssueToken)
+
+		// 获取AI验证码提取的健康状态
+		api.GET("/ai/status", h.GetAIStatus)
+
 		// 删除指定的临时邮箱
-		api.DELETE("/email/:email", h.DeleteEmail)
+		api.DELETE("/email/:email", auth, h.DeleteEmail)
 	}
 }
 
-// CreateEmail 创建新的临时邮箱
+// CreateEmail 创建新的临时邮箱，可以用strategy参数选择用户名生成策略，用ttl参数指定有效期
 func (h *APIHandler) CreateEmail(c *gin.Context) {
-	email := h.emailGenerator.GenerateEmail()
+	ttl, err := parseTTL(c.Query("ttl"))
+	if err != nil {
+		h.createEmailError(c, err)
+		return
+	}
+	mailbox, err := h.emailGenerator.GenerateEmail(c.Query("strategy"), ttl)
+	if err != nil {
+		h.createEmailError(c, err)
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{
-		"status": "success",
-		"email":  email,
+		"status":    "success",
+		"email":     mailbox.Address,
+		"expiresAt": mailbox.ExpiresAt,
+		"token":     mailbox.Token,
+	})
+}
+
+// createEmailRequest 创建邮箱的请求参数
+type createEmailRequest struct {
+	Username   string   `json:"username"`   // 邮箱地址的本地部分，为空时随机生成
+	OnConflict string   `json:"onConflict"` // 用户名已被使用时的处理方式：reject（默认）或suffix
+	Strategy   string   `json:"strategy"`   // 没有指定用户名时的生成策略：hex/words/pinyin/syllables
+	TTL        ttlParam `json:"ttl"`        // 有效期，为空时使用默认有效期
+}
+
+// ttlParam 有效期参数，JSON中可以是秒数（3600）或时长字符串（"1h"）
+type ttlParam string
+
+// UnmarshalJSON 同时接受数字和字符串
+func (t *ttlParam) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*t = ttlParam(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("ttl必须是秒数或时长字符串")
+	}
+	*t = ttlParam(n)
+	return nil
+}
+
+// parseTTL 解析有效期参数：整数表示秒数，否则按时长解析（例如30m、2h）；为空时返回0
+func parseTTL(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+	var ttl time.Duration
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		ttl = time.Duration(seconds) * time.Second
+	} else if ttl, err = time.ParseDuration(value); err != nil {
+		return 0, fmt.Errorf("%w: %s", email.ErrInvalidTTL, value)
+	}
+	if ttl <= 0 {
+		return 0, fmt.Errorf("%w: %s", email.ErrInvalidTTL, value)
+	}
+	return ttl, nil
+}
+
+// CreateNamedEmail 使用请求中的用户名创建临时邮箱，请求体可以为空
+func (h *APIHandler) CreateNamedEmail(c *gin.Context) {
+	var req createEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "无效的请求: " + err.Error(),
+		})
+		return
+	}
+
+	var suffix bool
+	switch req.OnConflict {
+	case "", "reject":
+	case "suffix":
+		suffix = true
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "无效的onConflict: " + req.OnConflict,
+		})
+		return
+	}
+
+	ttl, err := parseTTL(string(req.TTL))
+	if err != nil {
+		h.createEmailError(c, err)
+		return
+	}
+
+	mailbox, err := h.emailGenerator.CreateEmail(email.CreateEmailOptions{
+		Username: strings.TrimSpace(req.Username),
+		Suffix:   suffix,
+		Strategy: req.Strategy,
+		TTL:      ttl,
+	})
+	if err != nil {
+		h.createEmailError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":    "success",
+		"email":     mailbox.Address,
+		"expiresAt": mailbox.ExpiresAt,
+		"token":     mailbox.Token,
+	})
+}
+
+// createEmailError 按错误类型返回创建或续期邮箱失败的状态码
+func (h *APIHandler) createEmailError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, email.ErrInvalidUsername), errors.Is(err, email.ErrReservedUsername),
+		errors.Is(err, email.ErrUnknownUsernameStrategy), errors.Is(err, email.ErrInvalidTTL):
+		status = http.StatusBadRequest
+	case errors.Is(err, email.ErrMailboxNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, email.ErrUsernameTaken):
+		status = http.StatusConflict
+	case errors.Is(err, email.ErrUsernameExhausted):
+		status = http.StatusServiceUnavailable
+	}
+	if status >= http.StatusInternalServerError {
+		log.Printf("创建或续期邮箱失败: %v", err)
+	}
+	c.JSON(status, gin.H{
+		"status":  "error",
+		"message": err.Error(),
 	})
 }
 
@@ -62,9 +231,42 @@ func (h *APIHandler) GetMessages(c *gin.Context) {
 		return
 	}
 
+	// 解析头部过滤条件，格式为 header=名称:值 或 header=名称，可重复
+	filters := make([][2]string, 0)
+	for _, filter := range c.QueryArray("header") {
+		name, value, _ := strings.Cut(filter, ":")
+		name = strings.TrimSpace(name)
+		if name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": "无效的头部过滤条件: " + filter,
+			})
+			return
+		}
+		filters = append(filters, [2]string{name, strings.TrimSpace(value)})
+	}
+
 	// 获取该邮箱的所有邮件
 	messages := h.emailReceiver.GetEmails(email)
 
+	// 只保留满足全部头部过滤条件的邮件
+	if len(filters) > 0 {
+		matched := messages[:0]
+		for _, message := range messages {
+			ok := true
+			for _, filter := range filters {
+				if !message.MatchHeader(filter[0], filter[1]) {
+					ok = false
+					break
+				}
+			}
+			if ok {
+				matched = append(matched, message)
+			}
+		}
+		messages = matched
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"status":   "success",
 		"email":    email,
@@ -73,20 +275,300 @@ func (h *APIHandler) GetMessages(c *gin.Context) {
 	})
 }
 
-// ListEmails 获取活跃的临时邮箱列表
+// GetMessage 获取指定邮件的详情，包含全部邮件头部
+func (h *APIHandler) GetMessage(c *gin.Context) {
+	email := c.Param("email")
+
+	// 验证邮箱是否是我们创建的
+	if !h.emailGenerator.IsValidEmail(email) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "无效的邮箱地址",
+		})
+		return
+	}
+
+	message := h.emailReceiver.GetEmail(email, c.Param("id"))
+	if message == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "邮件不存在",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"email":   email,
+		"message": message,
+	})
+}
+
+// GetLatestCode 获取最近一封邮件中的验证码，默认跳过已过期的验证码，includeExpired=true时包含
+func (h *APIHandler) GetLatestCode(c *gin.Context) {
+	email := c.Param("email")
+
+	// 验证邮箱是否是我们创建的
+	if !h.emailGenerator.IsValidEmail(email) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "无效的邮箱地址",
+		})
+		return
+	}
+
+	includeExpired, _ := strconv.ParseBool(c.Query("includeExpired"))
+	message := h.emailReceiver.LatestCode(email, includeExpired)
+	if message == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "没有可用的验证码",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":        "success",
+		"email":         email,
+		"code":          message.Code,
+		"codeDisplay":   message.CodeDisplay,
+		"codeExpiresAt": message.CodeExpiresAt,
+		"codeExpired":   message.CodeExpired,
+		"messageId":     message.ID,
+		"from":          message.From,
+		"subject":       message.Subject,
+		"timestamp":     message.Timestamp,
+	})
+}
+
+// GetTOTPCode 使用最近一封邮件中的两步验证密钥计算当前的TOTP验证码，可按issuer和account过滤
+func (h *APIHandler) GetTOTPCode(c *gin.Context) {
+	email := c.Param("email")
+
+	// 验证邮箱是否是我们创建的
+	if !h.emailGenerator.IsValidEmail(email) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "无效的邮箱地址",
+		})
+		return
+	}
+
+	code, err := h.emailReceiver.LatestTOTPCode(email, c.Query("issuer"), c.Query("account"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "计算TOTP验证码失败: " + err.Error(),
+		})
+		return
+	}
+	if code == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "没有可用的两步验证密钥",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":    "success",
+		"email":     email,
+		"code":      code.Code,
+		"issuer":    code.Issuer,
+		"account":   code.Account,
+		"algorithm": code.Algorithm,
+		"digits":    code.Digits,
+		"period":    code.Period,
+		"expiresAt": code.ExpiresAt,
+		"expiresIn": code.ExpiresIn,
+		"messageId": code.MessageID,
+	})
+}
+
+// GetRawMessage 返回邮件接收时的原始字节
+func (h *APIHandler) GetRawMessage(c *gin.Context) {
+	email := c.Param("email")
+
+	// 验证邮箱是否是我们创建的
+	if !h.emailGenerator.IsValidEmail(email) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "无效的邮箱地址",
+		})
+		return
+	}
+
+	id := c.Param("id")
+	raw, ok := h.emailReceiver.GetRawEmail(email, id)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "邮件不存在",
+		})
+		return
+	}
+
+	// inline=1时在浏览器中直接查看，否则作为附件下载
+	disposition := "attachment"
+	if inline, _ := strconv.ParseBool(c.Query("inline")); inline {
+		disposition = "inline"
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`%s; filename="%s.eml"`, disposition, id))
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Data(http.StatusOK, "message/rfc822", raw)
+}
+
+// StreamEvents 以Server-Sent Events推送新邮件（message）和邮件更新（update，例如后台AI提取完成）
+func (h *APIHandler) StreamEvents(c *gin.Context) {
+	email := c.Param("email")
+
+	// 验证邮箱是否是我们创建的
+	if !h.emailGenerator.IsValidEmail(email) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "无效的邮箱地址",
+		})
+		return
+	}
+
+	events, cancel := h.emailReceiver.Subscribe(email)
+	defer cancel()
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+
+	// 定期发送心跳，避免代理因连接空闲而断开
+	heartbeat := time.NewTicker(eventHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case event, ok := <-events:
+			if !ok {
+				return false
+			}
+			c.SSEvent(event.Type, event)
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+		}
+		return true
+	})
+}
+
+// GetAIStatus 获取AI模型服务的健康状态（熔断器）、回复缓存统计和后台队列长度
+func (h *APIHandler) GetAIStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"ai":     h.emailReceiver.AIStatus(),
+	})
+}
+
+// ListEmails 获取请求中的访问令牌对应的活跃邮箱，使用管理令牌时返回全部活跃邮箱；
+// mailboxes中包含每个邮箱的过期时间
 func (h *APIHandler) ListEmails(c *gin.Context) {
-	emails := h.emailGenerator.GetActiveEmails()
+	var tokens []string
+	for _, token := range strings.Split(c.GetHeader(mailboxTokenHeader), ",") {
+		if token = strings.TrimSpace(token); token != "" {
+			tokens = append(tokens, token)
+		}
+	}
+
+	var mailboxes []email.Mailbox
+	if h.isAdmin(c) {
+		mailboxes = h.emailGenerator.GetActiveEmails()
+	} else {
+		mailboxes = h.emailGenerator.GetEmailsByTokens(tokens)
+	}
 
 	// 限制只返回最新的15条邮箱
 	maxEmails := 15
-	if len(emails) > maxEmails {
-		emails = emails[:maxEmails]
+	if len(mailboxes) > maxEmails {
+		mailboxes = mailboxes[:maxEmails]
+	}
+
+	emails := make([]string, 0, len(mailboxes))
+	for _, mailbox := range mailboxes {
+		emails = append(emails, mailbox.Address)
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"status": "success",
-		"count":  len(emails),
-		"emails": emails,
+		"status":    "success",
+		"count":     len(emails),
+		"emails":    emails,
+		"mailboxes": mailboxes,
+	})
+}
+
+// isAdmin 检查Authorization: Bearer中是否是管理令牌
+func (h *APIHandler) isAdmin(c *gin.Context) bool {
+	token := bearerToken(c)
+	if h.adminToken == "" || token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(h.adminToken)) == 1
+}
+
+// extendEmailRequest 延长邮箱有效期的请求参数
+type extendEmailRequest struct {
+	TTL ttlParam `json:"ttl"` // 从现在起的有效期，为空时使用默认有效期
+}
+
+// ExtendEmail 将邮箱的过期时间重新设置为从现在起ttl之后，ttl可以放在请求体或查询参数中
+func (h *APIHandler) ExtendEmail(c *gin.Context) {
+	var req extendEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "无效的请求: " + err.Error(),
+		})
+		return
+	}
+	if req.TTL == "" {
+		req.TTL = ttlParam(c.Query("ttl"))
+	}
+
+	ttl, err := parseTTL(string(req.TTL))
+	if err != nil {
+		h.createEmailError(c, err)
+		return
+	}
+	mailbox, err := h.emailGenerator.ExtendEmail(c.Param("email"), ttl)
+	if err != nil {
+		h.createEmailError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":    "success",
+		"email":     mailbox.Address,
+		"expiresAt": mailbox.ExpiresAt,
+	})
+}
+
+// IssueToken 使用管理令牌为邮箱重新签发访问令牌，旧令牌立即失效；
+// 用于启用访问令牌之前创建的邮箱，以及丢失了令牌的邮箱
+func (h *APIHandler) IssueToken(c *gin.Context) {
+	if !h.isAdmin(c) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"status":  "error",
+			"message": "需要管理令牌",
+		})
+		return
+	}
+
+	mailbox, err := h.emailGenerator.IssueToken(c.Param("email"))
+	if err != nil {
+		h.createEmailError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":    "success",
+		"email":     mailbox.Address,
+		"expiresAt": mailbox.ExpiresAt,
+		"token":     mailbox.Token,
 	})
 }
 
@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"mail-temp/internal/email"
+)
+
+// 传递邮箱访问令牌的请求头，获取邮箱列表时可以用逗号分隔多个令牌
+const mailboxTokenHeader = "X-Mailbox-Token"
+
+// requestToken 读取请求中的邮箱访问令牌：X-Mailbox-Token请求头、Authorization: Bearer或token查询参数
+// （EventSource和下载链接无法设置请求头）
+func requestToken(c *gin.Context) string {
+	if token := strings.TrimSpace(c.GetHeader(mailboxTokenHeader)); token != "" {
+		return token
+	}
+	if token := bearerToken(c); token != "" {
+		return token
+	}
+	return c.Query("token")
+}
+
+// bearerToken 读取Authorization: Bearer请求头中的令牌
+func bearerToken(c *gin.Context) string {
+	auth := c.GetHeader("Authorization")
+	if len(auth) <= 7 || !strings.EqualFold(auth[:7], "Bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(auth[7:])
+}
+
+// requireToken 返回检查访问令牌的中间件：缺少令牌，或路径中的邮箱与令牌不匹配时都返回401，
+// 邮箱不存在、已过期与令牌错误的响应相同，不泄露邮箱是否存在
+func requireToken(generator *email.EmailGenerator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := requestToken(c)
+		if token == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"status":  "error",
+				"message": "缺少访问令牌",
+			})
+			return
+		}
+
+		if err := generator.Authorize(c.Param("email"), token); err != nil {
+			status := http.StatusUnauthorized
+			if !errors.Is(err, email.ErrInvalidToken) {
+				log.Printf("检查访问令牌失败: %v", err)
+				status = http.StatusInternalServerError
+			}
+			c.AbortWithStatusJSON(status, gin.H{
+				"status":  "error",
+				"message": err.Error(),
+			})
+			return
+		}
+		c.Next()
+	}
+}
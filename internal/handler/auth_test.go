@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"mail-temp/internal/repository"
+)
+
+// TestRequireToken 读取邮件需要该邮箱的访问令牌，支持请求头、Bearer和查询参数三种形式
+func TestRequireToken(t *testing.T) {
+	s := newTestServer(t)
+	address, token := s.createMailbox(t, "auth-owner")
+	_, otherToken := s.createMailbox(t, "auth-other")
+	messages := "/api/email/" + address + "/messages"
+
+	expectStatus(t, "缺少令牌", s.do(http.MethodGet, messages, nil), http.StatusUnauthorized)
+	expectStatus(t, "其他邮箱的令牌", s.do(http.MethodGet, messages, map[string]string{mailboxTokenHeader: otherToken}), http.StatusUnauthorized)
+	expectStatus(t, "错误的令牌", s.do(http.MethodGet, messages+"?token=wrong", nil), http.StatusUnauthorized)
+	expectStatus(t, "不存在的邮箱", s.do(http.MethodGet, "/api/email/nobody@t.test/messages?token="+token, nil), http.StatusUnauthorized)
+
+	expectStatus(t, "请求头", s.do(http.MethodGet, messages, map[string]string{mailboxTokenHeader: token}), http.StatusOK)
+	expectStatus(t, "Bearer", s.do(http.MethodGet, messages, map[string]string{"Authorization": "Bearer " + token}), http.StatusOK)
+	expectStatus(t, "查询参数", s.do(http.MethodGet, messages+"?token="+token, nil), http.StatusOK)
+
+	// 删除邮箱同样需要令牌
+	expectStatus(t, "无令牌删除", s.do(http.MethodDelete, "/api/email/"+address, nil), http.StatusUnauthorized)
+	expectStatus(t, "删除", s.do(http.MethodDelete, "/api/email/"+address, map[string]string{mailboxTokenHeader: token}), http.StatusOK)
+	expectStatus(t, "删除后读取", s.do(http.MethodGet, messages+"?token="+token, nil), http.StatusUnauthorized)
+}
+
+// TestEmailPathCaseInsensitive 路径中的邮箱地址不区分大小写，大写地址读取到同一个邮箱的邮件
+func TestEmailPathCaseInsensitive(t *testing.T) {
+	s := newTestServer(t)
+	_, token := s.createMailbox(t, "qa-signup-42")
+	s.saveMessage(t, "qa-signup-42", &repository.EmailMessage{ID: "m1", Subject: "hello"})
+
+	w := s.do(http.MethodGet, "/api/email/QA-Signup-42@t.test/messages?token="+token, nil)
+	expectStatus(t, "大写地址", w, http.StatusOK)
+	if !strings.Contains(w.Body.String(), `"m1"`) {
+		t.Errorf("期望读取到邮件m1，实际 %s", w.Body.String())
+	}
+	expectStatus(t, "大写地址读取单封邮件",
+		s.do(http.MethodGet, "/api/email/QA-SIGNUP-42@t.test/messages/m1?token="+token, nil), http.StatusOK)
+}
+
+// TestLegacyMailboxToken 启用访问令牌之前创建的邮箱没有令牌哈希，任何令牌都不能读取，管理员重新签发后恢复
+func TestLegacyMailboxToken(t *testing.T) {
+	s := newTestServer(t)
+	if _, err := s.storage.CreateActiveEmail("legacy", time.Hour, "1"); err != nil {
+		t.Fatal(err)
+	}
+	messages := "/api/email/legacy@t.test/messages"
+
+	expectStatus(t, "旧值作为令牌", s.do(http.MethodGet, messages+"?token=1", nil), http.StatusUnauthorized)
+
+	w := s.do(http.MethodPost, "/api/email/legacy@t.test/token", map[string]string{"Authorization": "Bearer " + testAdminToken})
+	expectStatus(t, "重新签发", w, http.StatusOK)
+	token := responseToken(t, w.Body.Bytes())
+	expectStatus(t, "新令牌", s.do(http.MethodGet, messages+"?token="+token, nil), http.StatusOK)
+}
+
+// TestIssueTokenRequiresAdmin 重新签发令牌只允许使用管理令牌，签发后旧令牌立即失效
+func TestIssueTokenRequiresAdmin(t *testing.T) {
+	s := newTestServer(t)
+	address, oldToken := s.createMailbox(t, "reissue")
+	issue := "/api/email/" + address + "/token"
+
+	expectStatus(t, "无认证", s.do(http.MethodPost, issue, nil), http.StatusForbidden)
+	expectStatus(t, "邮箱令牌", s.do(http.MethodPost, issue, map[string]string{"Authorization": "Bearer " + oldToken}), http.StatusForbidden)
+	expectStatus(t, "错误的管理令牌", s.do(http.MethodPost, issue, map[string]string{"Authorization": "Bearer wrong"}), http.StatusForbidden)
+	expectStatus(t, "不存在的邮箱", s.do(http.MethodPost, "/api/email/nobody@t.test/token",
+		map[string]string{"Authorization": "Bearer " + testAdminToken}), http.StatusNotFound)
+
+	w := s.do(http.MethodPost, issue, map[string]string{"Authorization": "Bearer " + testAdminToken})
+	expectStatus(t, "管理令牌", w, http.StatusOK)
+	newToken := responseToken(t, w.Body.Bytes())
+	if newToken == oldToken {
+		t.Fatal("重新签发的令牌与旧令牌相同")
+	}
+
+	messages := "/api/email/" + address + "/messages?token="
+	expectStatus(t, "旧令牌", s.do(http.MethodGet, messages+oldToken, nil), http.StatusUnauthorized)
+	expectStatus(t, "新令牌", s.do(http.MethodGet, messages+newToken, nil), http.StatusOK)
+}
+
+// responseToken 从响应中读取token字段
+func responseToken(t *testing.T, body []byte) string {
+	t.Helper()
+	var result struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil || result.Token == "" {
+		t.Fatalf("响应中没有token: %s", body)
+	}
+	return result.Token
+}
@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"mail-temp/config"
+	"mail-temp/internal/email"
+	"mail-temp/internal/imageproxy"
+	"mail-temp/internal/repository"
+)
+
+// testAdminToken 测试用的管理令牌
+const testAdminToken = "admin-secret"
+
+// testServer 使用内存存储的完整路由，供处理器测试使用
+type testServer struct {
+	router    *gin.Engine
+	storage   *repository.MemoryStorage
+	generator *email.EmailGenerator
+}
+
+// newTestServer 创建注册了API、渲染和图片代理路由的测试服务
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	storage := repository.NewMemoryStorage()
+	generator, err := email.NewEmailGenerator("t.test", storage, email.UsernameOptions{},
+		email.MailboxTTLOptions{Default: time.Hour, Min: time.Minute, Max: 24 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{MailDomain: "t.test", CodeMinLength: 4, CodeMaxLength: 8, CodeExtractors: []string{"regex", "html"}}
+	proxy := imageproxy.NewProxy(imageproxy.Options{Secret: "secret"})
+	receiver, err := email.NewEmailReceiver(cfg, generator, storage, proxy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	NewAPIHandler(generator, receiver, testAdminToken).SetupRoutes(router)
+	NewRenderHandler(generator, receiver).SetupRoutes(router)
+	NewImageProxyHandler(proxy).SetupRoutes(router)
+	return &testServer{router: router, storage: storage, generator: generator}
+}
+
+// createMailbox 创建邮箱并返回地址和访问令牌
+func (s *testServer) createMailbox(t *testing.T, username string) (string, string) {
+	t.Helper()
+	mailbox, err := s.generator.CreateEmail(email.CreateEmailOptions{Username: username})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mailbox.Address, mailbox.Token
+}
+
+// saveMessage 直接向存储中保存一封邮件
+func (s *testServer) saveMessage(t *testing.T, username string, message *repository.EmailMessage) {
+	t.Helper()
+	if message.Timestamp == "" {
+		message.Timestamp = time.Now().Format(time.RFC3339)
+	}
+	if err := s.storage.SaveEmail(username, message); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// do 发送请求并返回响应，header中的值会设置为请求头
+func (s *testServer) do(method, target string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	for key, value := range header {
+		req.Header.Set(key, value)
+	}
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	return w
+}
+
+// expectStatus 检查响应状态码
+func expectStatus(t *testing.T, name string, w *httptest.ResponseRecorder, want int) {
+	t.Helper()
+	if w.Code != want {
+		t.Errorf("%s: 期望%d %s，实际%d %s", name, want, http.StatusText(want), w.Code, w.Body.String())
+	}
+}
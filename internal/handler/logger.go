@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 访问日志中需要隐藏的查询参数：EventSource、iframe和下载链接通过token参数传递邮箱访问令牌
+var tokenQueryPattern = regexp.MustCompile(`([?&]token=)[^&]*`)
+
+// AccessLogger 返回访问日志中间件，格式与gin默认的日志相同，但隐藏查询参数中的访问令牌
+func AccessLogger() gin.HandlerFunc {
+	return gin.LoggerWithConfig(gin.LoggerConfig{
+		Formatter: func(param gin.LogFormatterParams) string {
+			var statusColor, methodColor, resetColor string
+			if param.IsOutputColor() {
+				statusColor = param.StatusCodeColor()
+				methodColor = param.MethodColor()
+				resetColor = param.ResetColor()
+			}
+
+			if param.Latency > time.Minute {
+				param.Latency = param.Latency.Truncate(time.Second)
+			}
+			return fmt.Sprintf("[GIN] %v |%s %3d %s| %13v | %15s |%s %-7s %s %#v\n%s",
+				param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+				statusColor, param.StatusCode, resetColor,
+				param.Latency,
+				param.ClientIP,
+				methodColor, param.Method, resetColor,
+				redactToken(param.Path),
+				param.ErrorMessage,
+			)
+		},
+	})
+}
+
+// redactToken 将路径中token查询参数的值替换为REDACTED
+func redactToken(path string) string {
+	return tokenQueryPattern.ReplaceAllString(path, "${1}REDACTED")
+}
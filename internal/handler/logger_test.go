@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestRedactToken 只替换token查询参数的值，其他参数保持不变
+func TestRedactToken(t *testing.T) {
+	tests := map[string]string{
+		"/api/email/a@t.test/events?token=abc": "/api/email/a@t.test/events?token=REDACTED",
+		"/x?images=1&token=abc&download=1":     "/x?images=1&token=REDACTED&download=1",
+		"/x?mytoken=abc":                       "/x?mytoken=abc",
+		"/x?token=":                            "/x?token=REDACTED",
+		"/api/email/a@t.test/messages":         "/api/email/a@t.test/messages",
+		"/x?token=a&token=b":                   "/x?token=REDACTED&token=REDACTED",
+	}
+	for path, want := range tests {
+		if got := redactToken(path); got != want {
+			t.Errorf("%s: 期望%s，实际%s", path, want, got)
+		}
+	}
+}
+
+// TestAccessLoggerRedactsToken 访问日志中不出现查询参数里的访问令牌
+func TestAccessLoggerRedactsToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var buf bytes.Buffer
+	defaultWriter := gin.DefaultWriter
+	gin.DefaultWriter = &buf
+	defer func() { gin.DefaultWriter = defaultWriter }()
+
+	router := gin.New()
+	router.Use(AccessLogger())
+	router.GET("/api/email/:email/events", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	secret := "s3cr3t-t0ken-value"
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/email/a@t.test/events?token="+secret, nil))
+
+	line := buf.String()
+	if strings.Contains(line, secret) {
+		t.Errorf("访问日志中出现了令牌: %s", line)
+	}
+	if !strings.Contains(line, "/api/email/a@t.test/events?token=REDACTED") || !strings.Contains(line, "200") {
+		t.Errorf("访问日志格式不正确: %s", line)
+	}
+}
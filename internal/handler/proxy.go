@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"mail-temp/internal/imageproxy"
+)
+
+// ImageProxyHandler 远程图片代理处理器
+type ImageProxyHandler struct {
+	proxy *imageproxy.Proxy
+}
+
+// NewImageProxyHandler 创建图片代理处理器
+func NewImageProxyHandler(proxy *imageproxy.Proxy) *ImageProxyHandler {
+	return &ImageProxyHandler{
+		proxy: proxy,
+	}
+}
+
+// SetupRoutes 设置路由
+func (h *ImageProxyHandler) SetupRoutes(router *gin.Engine) {
+	// 代理邮件中的远程图片，避免泄露用户IP
+	router.GET(imageproxy.Path, h.ProxyImage)
+}
+
+// ProxyImage 拉取并返回签名地址对应的远程图片
+func (h *ImageProxyHandler) ProxyImage(c *gin.Context) {
+	remote := c.Query("url")
+	if err := h.proxy.Verify(remote, c.Query("exp"), c.Query("sig")); err != nil {
+		c.Status(http.StatusForbidden)
+		return
+	}
+
+	image, err := h.proxy.Get(c.Request.Context(), remote)
+	if err != nil {
+		log.Printf("代理图片失败: %s, %v", remote, err)
+		status := http.StatusBadGateway
+		if errors.Is(err, imageproxy.ErrTooLarge) || errors.Is(err, imageproxy.ErrNotImage) {
+			status = http.StatusUnprocessableEntity
+		}
+		c.Status(status)
+		return
+	}
+
+	header := c.Writer.Header()
+	header.Set("Content-Security-Policy", "default-src 'none'; sandbox")
+	header.Set("X-Content-Type-Options", "nosniff")
+	header.Set("Cache-Control", "private, max-age=3600")
+	c.Data(http.StatusOK, image.ContentType, image.Data)
+}
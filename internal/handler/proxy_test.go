@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"mail-temp/internal/imageproxy"
+)
+
+// TestProxyImageRejectsBadSignatures 签名无效、过期或缺少参数时返回403，不会请求远程服务器
+func TestProxyImageRejectsBadSignatures(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "image/gif")
+		w.Write([]byte("GIF89a\x01\x00\x01\x00\x00\x00\x00;"))
+	}))
+	defer server.Close()
+
+	proxy := imageproxy.NewProxy(imageproxy.Options{Secret: "secret", AllowPrivateNetworks: true})
+	router := gin.New()
+	NewImageProxyHandler(proxy).SetupRoutes(router)
+
+	signed, err := url.Parse(proxy.ProxyURL(server.URL + "/a.gif"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid := signed.Query()
+
+	tampered := url.Values{"url": {server.URL + "/b.gif"}, "exp": valid["exp"], "sig": valid["sig"]}
+	badSig := url.Values{"url": valid["url"], "exp": valid["exp"], "sig": {"00"}}
+	missing := url.Values{"url": valid["url"]}
+
+	// 用另一个代理实例签发已经过期的地址：有效期为1纳秒，过期时间按秒取整后已经早于当前时间
+	expiredProxy := imageproxy.NewProxy(imageproxy.Options{Secret: "secret", URLTTL: time.Nanosecond})
+	expiredURL, err := url.Parse(expiredProxy.ProxyURL(server.URL + "/a.gif"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	for name, query := range map[string]url.Values{
+		"tampered": tampered,
+		"bad sig":  badSig,
+		"missing":  missing,
+		"expired":  expiredURL.Query(),
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, imageproxy.Path+"?"+query.Encode(), nil))
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s: 期望403，实际%d", name, w.Code)
+		}
+	}
+	if requests != 0 {
+		t.Errorf("签名无效时不应请求远程服务器，实际请求了%d次", requests)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, signed.String(), nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/gif" {
+		t.Errorf("有效的签名: 期望200 image/gif，实际%d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+}
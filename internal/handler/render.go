@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"mail-temp/internal/email"
+)
+
+// renderCSP 邮件渲染页面的内容安全策略，禁止脚本、表单和嵌套页面，
+// %s处为允许的图片来源；远程图片只能通过本站的图片代理加载
+const renderCSP = "default-src 'none'; img-src %s; style-src 'unsafe-inline'; " +
+	"base-uri 'none'; form-action 'none'; frame-ancestors 'self'; sandbox allow-popups allow-popups-to-escape-sandbox"
+
+// RenderHandler 邮件HTML渲染处理器
+type RenderHandler struct {
+	emailGenerator *email.EmailGenerator
+	emailReceiver  *email.EmailReceiver
+}
+
+// NewRenderHandler 创建邮件渲染处理器
+func NewRenderHandler(generator *email.EmailGenerator, receiver *email.EmailReceiver) *RenderHandler {
+	return &RenderHandler{
+		emailGenerator: generator,
+		emailReceiver:  receiver,
+	}
+}
+
+// SetupRoutes 设置路由
+func (h *RenderHandler) SetupRoutes(router *gin.Engine) {
+	// 在沙箱中渲染邮件HTML，供前端iframe嵌入；iframe无法设置请求头，令牌放在token查询参数中。
+	// 最初的GET /render/:id不检查邮箱归属和令牌，已由这个路径取代
+	router.GET("/api/email/:email/messages/:id/render", requireToken(h.emailGenerator), h.RenderMessage)
+}
+
+// RenderMessage 以严格的安全头返回清理后的邮件HTML
+func (h *RenderHandler) RenderMessage(c *gin.Context) {
+	// 默认不加载远程图片，images=1时允许通过图片代理加载
+	imgSrc := "data: cid:"
+	if loadImages, _ := strconv.ParseBool(c.Query("images")); loadImages {
+		imgSrc = "'self' data: cid:"
+	}
+
+	header := c.Writer.Header()
+	header.Set("Content-Security-Policy", fmt.Sprintf(renderCSP, imgSrc))
+	header.Set("X-Content-Type-Options", "nosniff")
+	header.Set("X-Frame-Options", "SAMEORIGIN")
+	header.Set("Referrer-Policy", "no-referrer")
+	header.Set("Cache-Control", "no-store")
+
+	content, ok := h.emailReceiver.RenderHTML(c.Param("email"), c.Param("id"))
+	if !ok {
+		c.Data(http.StatusNotFound, "text/plain; charset=utf-8", []byte("邮件不存在"))
+		return
+	}
+
+	// 清理后的内容已是完整文档，前置的元素会被浏览器归入<head>
+	page := `<!DOCTYPE html><meta charset="utf-8">` +
+		`<style>body{margin:0;padding:8px;font-family:sans-serif;word-wrap:break-word}img{max-width:100%;height:auto}</style>` +
+		content
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(page))
+}
@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"mail-temp/internal/repository"
+)
+
+// TestRenderMessageHeaders 渲染页面带有禁止脚本的CSP沙箱和其他安全头，默认不允许加载远程图片
+func TestRenderMessageHeaders(t *testing.T) {
+	s := newTestServer(t)
+	address, token := s.createMailbox(t, "render-test")
+	s.saveMessage(t, "render-test", &repository.EmailMessage{
+		ID:          "m1",
+		HtmlContent: `<p>hello</p><img src="https://images.example/logo.png"><script>alert(1)</script>`,
+	})
+
+	target := "/api/email/" + address + "/messages/m1/render?token=" + token
+	w := s.do(http.MethodGet, target, nil)
+	expectStatus(t, "渲染", w, http.StatusOK)
+
+	csp := w.Header().Get("Content-Security-Policy")
+	for _, directive := range []string{
+		"default-src 'none'",
+		"img-src data: cid:;",
+		"form-action 'none'",
+		"base-uri 'none'",
+		"frame-ancestors 'self'",
+		"sandbox allow-popups allow-popups-to-escape-sandbox",
+	} {
+		if !strings.Contains(csp, directive) {
+			t.Errorf("CSP缺少%q: %s", directive, csp)
+		}
+	}
+	if strings.Contains(csp, "script-src") || strings.Contains(csp, "allow-scripts") || strings.Contains(csp, "allow-same-origin") {
+		t.Errorf("CSP不应允许脚本或同源: %s", csp)
+	}
+	for header, want := range map[string]string{
+		"X-Content-Type-Options": "nosniff",
+		"X-Frame-Options":        "SAMEORIGIN",
+		"Referrer-Policy":        "no-referrer",
+		"Cache-Control":          "no-store",
+		"Content-Type":           "text/html; charset=utf-8",
+	} {
+		if got := w.Header().Get(header); got != want {
+			t.Errorf("%s: 期望%q，实际%q", header, want, got)
+		}
+	}
+
+	body := w.Body.String()
+	if strings.Contains(body, "<script") {
+		t.Errorf("渲染结果中有脚本: %s", body)
+	}
+	if strings.Contains(body, "images.example") && !strings.Contains(body, "/proxy/image?") {
+		t.Errorf("远程图片没有改写为代理地址: %s", body)
+	}
+
+	// images=1时允许从本站的图片代理加载
+	w = s.do(http.MethodGet, target+"&images=1", nil)
+	expectStatus(t, "加载图片", w, http.StatusOK)
+	if csp := w.Header().Get("Content-Security-Policy"); !strings.Contains(csp, "img-src 'self' data: cid:;") {
+		t.Errorf("images=1时应允许本站图片: %s", csp)
+	}
+}
+
+// TestRenderMessageOwnership 邮件必须属于路径中的邮箱，旧的/render/:id路径不再提供
+func TestRenderMessageOwnership(t *testing.T) {
+	s := newTestServer(t)
+	address, token := s.createMailbox(t, "render-owner")
+	s.createMailbox(t, "render-other")
+	s.saveMessage(t, "render-other", &repository.EmailMessage{ID: "theirs", HtmlContent: "<p>secret</p>"})
+
+	w := s.do(http.MethodGet, "/api/email/"+address+"/messages/theirs/render?token="+token, nil)
+	expectStatus(t, "其他邮箱的邮件", w, http.StatusNotFound)
+
+	w = s.do(http.MethodGet, "/render/theirs", nil)
+	expectStatus(t, "旧路径", w, http.StatusNotFound)
+}
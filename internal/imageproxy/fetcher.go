@@ -0,0 +1,201 @@
+package imageproxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// 默认单张图片最大字节数 (5MB)
+	defaultMaxBytes = 5 * 1024 * 1024
+	// 默认拉取超时时间
+	defaultTimeout = 10 * time.Second
+	// 最大重定向次数
+	maxRedirects = 3
+)
+
+var (
+	// ErrTooLarge 图片超过大小限制
+	ErrTooLarge = errors.New("图片超过大小限制")
+	// ErrNotImage 远程资源不是图片
+	ErrNotImage = errors.New("远程资源不是图片")
+	// ErrForbiddenAddress 远程地址指向内网
+	ErrForbiddenAddress = errors.New("不允许访问内网地址")
+)
+
+// Image 拉取到的图片
+type Image struct {
+	ContentType string
+	Data        []byte
+}
+
+// Fetcher 有大小和时间限制的远程图片拉取器
+type Fetcher struct {
+	client   *http.Client
+	maxBytes int64
+}
+
+// NewFetcher 创建图片拉取器
+func NewFetcher(maxBytes int64, timeout time.Duration, allowPrivate bool) *Fetcher {
+	if maxBytes <= 0 {
+		maxBytes = defaultMaxBytes
+	}
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		// 在建立连接时检查解析后的IP，防止通过DNS或重定向访问内网
+		dialer.Control = func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || isPrivateIP(ip) {
+				return ErrForbiddenAddress
+			}
+			return nil
+		}
+	}
+
+	transport := &http.Transport{
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   timeout,
+		ResponseHeaderTimeout: timeout,
+		MaxIdleConns:          20,
+		IdleConnTimeout:       90 * time.Second,
+	}
+
+	return &Fetcher{
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   timeout,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) >= maxRedirects {
+					return fmt.Errorf("重定向次数过多")
+				}
+				if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+					return fmt.Errorf("不支持的重定向协议: %s", req.URL.Scheme)
+				}
+				return nil
+			},
+		},
+		maxBytes: maxBytes,
+	}
+}
+
+// Fetch 拉取远程图片
+func (f *Fetcher) Fetch(ctx context.Context, remote string) (*Image, error) {
+	u, err := url.Parse(remote)
+	if err != nil {
+		return nil, fmt.Errorf("无效的图片地址: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("不支持的图片协议: %s", u.Scheme)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "image/*")
+	req.Header.Set("User-Agent", "mail-temp-image-proxy")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("远程服务器返回状态码: %d", resp.StatusCode)
+	}
+	if resp.ContentLength > f.maxBytes {
+		return nil, ErrTooLarge
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if !isAllowedImageType(contentType) {
+		return nil, ErrNotImage
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, f.maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > f.maxBytes {
+		return nil, ErrTooLarge
+	}
+
+	// 以实际内容为准，防止伪造Content-Type
+	detected := http.DetectContentType(data)
+	if !isAllowedImageType(detected) {
+		return nil, ErrNotImage
+	}
+
+	return &Image{
+		ContentType: detected,
+		Data:        data,
+	}, nil
+}
+
+// isAllowedImageType 检查是否为允许代理的图片类型（不允许SVG）
+func isAllowedImageType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(mediaType, "image/") && !strings.Contains(mediaType, "svg")
+}
+
+// net.IP的方法没有覆盖的保留地址段
+var reservedNetworks = []*net.IPNet{
+	mustParseCIDR("0.0.0.0/8"),      // 本网络
+	mustParseCIDR("100.64.0.0/10"),  // 运营商级NAT（CGNAT）
+	mustParseCIDR("192.0.0.0/24"),   // IETF协议分配
+	mustParseCIDR("198.18.0.0/15"),  // 网络设备测试
+	mustParseCIDR("240.0.0.0/4"),    // 保留地址和广播地址
+	mustParseCIDR("64:ff9b::/96"),   // NAT64，内嵌的IPv4地址可能指向内网
+	mustParseCIDR("64:ff9b:1::/48"), // 本地NAT64
+	mustParseCIDR("2002::/16"),      // 6to4，内嵌的IPv4地址可能指向内网
+	mustParseCIDR("100::/64"),       // 丢弃前缀
+	mustParseCIDR("2001:db8::/32"),  // 文档地址
+	mustParseCIDR("fec0::/10"),      // 已废弃的站点本地地址
+}
+
+// mustParseCIDR 解析地址段，格式错误时panic
+func mustParseCIDR(cidr string) *net.IPNet {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	return network
+}
+
+// isPrivateIP 检查IP是否为内网、回环或保留地址，IPv4映射的IPv6地址（::ffff:a.b.c.d）按IPv4检查
+func isPrivateIP(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() {
+		return true
+	}
+	for _, network := range reservedNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
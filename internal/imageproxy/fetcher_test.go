@@ -0,0 +1,166 @@
+package imageproxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// testPNG 返回以PNG文件头开始、总长度为size的图片数据
+func testPNG(size int) []byte {
+	header := []byte("\x89PNG\r\n\x1a\n")
+	return append(header, bytes.Repeat([]byte{0}, size-len(header))...)
+}
+
+// imageServer 启动返回data的测试图片服务器
+func imageServer(t *testing.T, data []byte) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// TestFetcherBlocksPrivateNetworks 默认不允许连接回环和内网地址
+func TestFetcherBlocksPrivateNetworks(t *testing.T) {
+	server := imageServer(t, testPNG(64))
+
+	_, err := NewFetcher(0, time.Second, false).Fetch(context.Background(), server.URL)
+	if !errors.Is(err, ErrForbiddenAddress) {
+		t.Fatalf("期望ErrForbiddenAddress，实际 %v", err)
+	}
+
+	image, err := NewFetcher(0, time.Second, true).Fetch(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("允许内网时拉取失败: %v", err)
+	}
+	if image.ContentType != "image/png" || len(image.Data) != 64 {
+		t.Errorf("图片不正确: %s, %d字节", image.ContentType, len(image.Data))
+	}
+}
+
+// TestFetcherSizeLimit 声明的长度或实际读取的长度超过限制时失败
+func TestFetcherSizeLimit(t *testing.T) {
+	data := testPNG(2048)
+	declared := imageServer(t, data)
+	chunked := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		// 分块发送，不带Content-Length
+		w.Write(data[:1024])
+		w.(http.Flusher).Flush()
+		w.Write(data[1024:])
+	}))
+	defer chunked.Close()
+
+	fetcher := NewFetcher(1024, time.Second, true)
+	for name, server := range map[string]*httptest.Server{"Content-Length": declared, "chunked": chunked} {
+		if _, err := fetcher.Fetch(context.Background(), server.URL); !errors.Is(err, ErrTooLarge) {
+			t.Errorf("%s: 期望ErrTooLarge，实际 %v", name, err)
+		}
+	}
+
+	if _, err := NewFetcher(2048, time.Second, true).Fetch(context.Background(), declared.URL); err != nil {
+		t.Errorf("不超过限制的图片拉取失败: %v", err)
+	}
+}
+
+// TestFetcherTimeout 远程服务器响应过慢时在超时时间后失败
+func TestFetcherTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	start := time.Now()
+	_, err := NewFetcher(0, 100*time.Millisecond, true).Fetch(context.Background(), server.URL)
+	if err == nil {
+		t.Fatal("期望超时错误")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("超时没有生效，耗时 %v", elapsed)
+	}
+}
+
+// TestFetcherRejectsNonImages 不是图片或是SVG的内容被拒绝
+func TestFetcherRejectsNonImages(t *testing.T) {
+	tests := map[string][]byte{
+		"text/html":     []byte("<html><body>hi</body></html>"),
+		"image/png":     []byte("<html><body>伪造的Content-Type</body></html>"),
+		"image/svg+xml": []byte(`<svg xmlns="http://www.w3.org/2000/svg"></svg>`),
+	}
+	for contentType, body := range tests {
+		contentType, body := contentType, body
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", contentType)
+			w.Write(body)
+		}))
+		_, err := NewFetcher(0, time.Second, true).Fetch(context.Background(), server.URL)
+		server.Close()
+		if !errors.Is(err, ErrNotImage) {
+			t.Errorf("%s: 期望ErrNotImage，实际 %v", contentType, err)
+		}
+	}
+}
+
+// TestIsPrivateIP 内网、保留地址段以及它们的IPv4映射形式都被拦截，公网地址放行
+func TestIsPrivateIP(t *testing.T) {
+	tests := map[string]bool{
+		"127.0.0.1":            true,
+		"10.1.2.3":             true,
+		"172.16.0.1":           true,
+		"192.168.1.1":          true,
+		"169.254.169.254":      true,
+		"0.0.0.0":              true,
+		"0.1.2.3":              true,
+		"100.64.0.1":           true,
+		"100.127.255.254":      true,
+		"192.0.0.8":            true,
+		"198.18.0.1":           true,
+		"198.19.255.255":       true,
+		"240.0.0.1":            true,
+		"255.255.255.255":      true,
+		"224.0.0.1":            true,
+		"::1":                  true,
+		"::":                   true,
+		"fc00::1":              true,
+		"fe80::1":              true,
+		"64:ff9b::7f00:1":      true,
+		"64:ff9b::a00:1":       true,
+		"64:ff9b:1::1":         true,
+		"2002:7f00:1::1":       true,
+		"::ffff:127.0.0.1":     true,
+		"::ffff:10.0.0.1":      true,
+		"::ffff:100.64.0.1":    true,
+		"::ffff:198.18.0.1":    true,
+		"::ffff:240.0.0.1":     true,
+		"::ffff:192.0.0.1":     true,
+		"8.8.8.8":              false,
+		"100.63.255.255":       false,
+		"100.128.0.1":          false,
+		"198.20.0.1":           false,
+		"192.0.1.1":            false,
+		"2606:4700::1111":      false,
+		"::ffff:93.184.216.34": false,
+	}
+	for address, want := range tests {
+		ip := net.ParseIP(address)
+		if ip == nil {
+			t.Fatalf("无效的测试地址: %s", address)
+		}
+		if got := isPrivateIP(ip); got != want {
+			t.Errorf("%s: 期望%v，实际%v", address, want, got)
+		}
+	}
+}
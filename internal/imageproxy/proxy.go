@@ -0,0 +1,155 @@
+package imageproxy
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"mail-temp/internal/lru"
+)
+
+// Path 图片代理的路由路径
+const Path = "/proxy/image"
+
+const (
+	// 默认缓存有效期
+	defaultCacheTTL = time.Hour
+	// 默认代理地址有效期
+	defaultURLTTL = 24 * time.Hour
+)
+
+var (
+	// ErrInvalidSignature 代理地址签名无效
+	ErrInvalidSignature = errors.New("图片代理签名无效")
+	// ErrExpiredSignature 代理地址已过期
+	ErrExpiredSignature = errors.New("图片代理地址已过期")
+)
+
+// Options 图片代理配置
+type Options struct {
+	// 签名密钥，为空时启动时随机生成；代理地址在展示邮件时才签名，
+	// 重启不影响，但多个实例共同提供服务时需要设置相同的密钥
+	Secret string
+	// 代理地址的有效期
+	URLTTL time.Duration
+	// 单张图片最大字节数
+	MaxBytes int64
+	// 拉取远程图片的超时时间
+	Timeout time.Duration
+	// 缓存的最大总字节数，0表示不缓存
+	CacheBytes int64
+	// 缓存有效期
+	CacheTTL time.Duration
+	// 是否允许访问内网地址（仅用于测试）
+	AllowPrivateNetworks bool
+}
+
+// Proxy 远程图片代理，负责签名代理地址并拉取、缓存远程图片
+type Proxy struct {
+	secret  []byte
+	urlTTL  time.Duration
+	now     func() time.Time
+	fetcher *Fetcher
+	cache   *lru.Cache[string, *Image] // 按图片字节数限制容量
+}
+
+// NewProxy 创建图片代理
+func NewProxy(opts Options) *Proxy {
+	secret := []byte(opts.Secret)
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			log.Printf("生成图片代理密钥失败: %v", err)
+		}
+		log.Println("未设置IMAGE_PROXY_SECRET，图片代理使用随机密钥；多个实例共同提供服务时需要设置相同的密钥")
+	}
+
+	urlTTL := opts.URLTTL
+	if urlTTL <= 0 {
+		urlTTL = defaultURLTTL
+	}
+	cacheTTL := opts.CacheTTL
+	if cacheTTL <= 0 {
+		cacheTTL = defaultCacheTTL
+	}
+
+	return &Proxy{
+		secret:  secret,
+		urlTTL:  urlTTL,
+		now:     time.Now,
+		fetcher: NewFetcher(opts.MaxBytes, opts.Timeout, opts.AllowPrivateNetworks),
+		cache: lru.New[string](opts.CacheBytes, cacheTTL, func(image *Image) int64 {
+			return int64(len(image.Data))
+		}),
+	}
+}
+
+// ProxyURL 将远程图片地址改写为签名后的代理地址，在URLTTL之后过期
+func (p *Proxy) ProxyURL(remote string) string {
+	expires := strconv.FormatInt(p.now().Add(p.urlTTL).Unix(), 10)
+	values := url.Values{}
+	values.Set("url", remote)
+	values.Set("exp", expires)
+	values.Set("sig", p.sign(remote, expires))
+	return Path + "?" + values.Encode()
+}
+
+// RemoteURL 从代理地址中取出远程图片地址，不是代理地址时返回false
+func RemoteURL(proxyURL string) (string, bool) {
+	if !strings.HasPrefix(proxyURL, Path+"?") {
+		return "", false
+	}
+	values, err := url.ParseQuery(strings.TrimPrefix(proxyURL, Path+"?"))
+	if err != nil || values.Get("url") == "" {
+		return "", false
+	}
+	return values.Get("url"), true
+}
+
+// Verify 校验代理地址的签名和有效期，expires为地址中的exp参数
+func (p *Proxy) Verify(remote, expires, signature string) error {
+	expected := p.sign(remote, expires)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return ErrInvalidSignature
+	}
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if p.now().After(time.Unix(unix, 0)) {
+		return ErrExpiredSignature
+	}
+	return nil
+}
+
+// Get 获取远程图片，优先使用缓存
+func (p *Proxy) Get(ctx context.Context, remote string) (*Image, error) {
+	if image, ok := p.cache.Get(remote); ok {
+		return image, nil
+	}
+
+	image, err := p.fetcher.Fetch(ctx, remote)
+	if err != nil {
+		return nil, err
+	}
+
+	p.cache.Set(remote, image)
+	return image, nil
+}
+
+// sign 计算远程地址和过期时间的HMAC签名
+func (p *Proxy) sign(remote, expires string) string {
+	mac := hmac.New(sha256.New, p.secret)
+	mac.Write([]byte(remote))
+	mac.Write([]byte{0})
+	mac.Write([]byte(expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,108 @@
+package imageproxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestProxyURLSignature 代理地址的签名只对原地址和有效期有效，过期后失效
+func TestProxyURLSignature(t *testing.T) {
+	now := time.Now()
+	proxy := NewProxy(Options{Secret: "secret", URLTTL: time.Hour})
+	proxy.now = func() time.Time { return now }
+
+	remote := "https://example.com/logo.png"
+	query := parseProxyURL(t, proxy.ProxyURL(remote))
+	if query.Get("url") != remote {
+		t.Fatalf("代理地址中的url不正确: %s", query.Get("url"))
+	}
+	exp, sig := query.Get("exp"), query.Get("sig")
+
+	if err := proxy.Verify(remote, exp, sig); err != nil {
+		t.Fatalf("有效的签名校验失败: %v", err)
+	}
+	if err := proxy.Verify("https://example.com/other.png", exp, sig); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("更换地址: 期望ErrInvalidSignature，实际 %v", err)
+	}
+	if err := proxy.Verify(remote, "99999999999", sig); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("修改有效期: 期望ErrInvalidSignature，实际 %v", err)
+	}
+	if err := NewProxy(Options{Secret: "other"}).Verify(remote, exp, sig); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("其他密钥: 期望ErrInvalidSignature，实际 %v", err)
+	}
+
+	now = now.Add(time.Hour + time.Second)
+	if err := proxy.Verify(remote, exp, sig); !errors.Is(err, ErrExpiredSignature) {
+		t.Errorf("过期: 期望ErrExpiredSignature，实际 %v", err)
+	}
+}
+
+// TestRemoteURL 从代理地址中还原远程地址
+func TestRemoteURL(t *testing.T) {
+	proxy := NewProxy(Options{Secret: "secret"})
+	remote := "https://example.com/a.png?size=2&v=1"
+	if got, ok := RemoteURL(proxy.ProxyURL(remote)); !ok || got != remote {
+		t.Errorf("期望 %s，实际 %s %v", remote, got, ok)
+	}
+	if _, ok := RemoteURL(remote); ok {
+		t.Error("普通地址不是代理地址")
+	}
+}
+
+// TestProxyCache 命中缓存时不再请求远程服务器，超出缓存容量时淘汰最久未使用的图片
+func TestProxyCache(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(testPNG(600))
+	}))
+	defer server.Close()
+
+	// 缓存只能容纳一张图片
+	proxy := NewProxy(Options{Secret: "secret", CacheBytes: 1000, AllowPrivateNetworks: true})
+	get := func(path string) {
+		t.Helper()
+		if _, err := proxy.Get(context.Background(), server.URL+path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expectRequests := func(want int32) {
+		t.Helper()
+		if got := atomic.LoadInt32(&requests); got != want {
+			t.Errorf("期望请求远程服务器%d次，实际%d次", want, got)
+		}
+	}
+
+	get("/a.png")
+	get("/a.png")
+	expectRequests(1)
+
+	get("/b.png")
+	expectRequests(2)
+	get("/b.png")
+	expectRequests(2)
+
+	// a已被b淘汰
+	get("/a.png")
+	expectRequests(3)
+}
+
+// parseProxyURL 解析代理地址的查询参数
+func parseProxyURL(t *testing.T, proxyURL string) url.Values {
+	t.Helper()
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Path != Path {
+		t.Fatalf("代理地址路径不正确: %s", u.Path)
+	}
+	return u.Query()
+}
@@ -0,0 +1,187 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// 熔断器状态
+const (
+	StateClosed   = "closed"    // 正常调用
+	StateOpen     = "open"      // 模型服务不可用，直接返回错误
+	StateHalfOpen = "half-open" // 冷却结束，允许一个探测请求
+)
+
+const (
+	// 默认连续失败多少次后打开熔断器
+	defaultBreakerThreshold = 5
+	// 默认打开后多久允许探测请求
+	defaultBreakerCooldown = 30 * time.Second
+)
+
+// ErrCircuitOpen 熔断器打开时返回的错误
+var ErrCircuitOpen = errors.New("模型服务不可用（熔断中）")
+
+// Health 模型服务的健康状态
+type Health struct {
+	Provider            string `json:"provider"`
+	State               string `json:"state"`
+	Healthy             bool   `json:"healthy"`
+	ConsecutiveFailures int    `json:"consecutiveFailures"`
+	LastError           string `json:"lastError,omitempty"`
+	LastSuccess         string `json:"lastSuccess,omitempty"`
+	LastFailure         string `json:"lastFailure,omitempty"`
+	RetryAt             string `json:"retryAt,omitempty"` // 熔断器打开时，下一次允许探测的时间
+}
+
+// Breaker 熔断器：连续失败达到阈值后打开，冷却时间过后放行一个探测请求，
+// 探测成功则恢复，失败则继续熔断
+type Breaker struct {
+	provider  Provider
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu          sync.Mutex
+	state       string
+	failures    int
+	probing     bool
+	openedAt    time.Time
+	lastError   string
+	lastSuccess time.Time
+	lastFailure time.Time
+}
+
+// NewBreaker 为模型服务添加熔断器，threshold和cooldown不大于0时使用默认值
+func NewBreaker(provider Provider, threshold int, cooldown time.Duration) *Breaker {
+	if threshold <= 0 {
+		threshold = defaultBreakerThreshold
+	}
+	if cooldown <= 0 {
+		cooldown = defaultBreakerCooldown
+	}
+	return &Breaker{
+		provider:  provider,
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+		state:     StateClosed,
+	}
+}
+
+// Name 实现Provider接口
+func (b *Breaker) Name() string {
+	return b.provider.Name()
+}
+
+// Complete 实现Provider接口，熔断时不调用模型服务，直接返回ErrCircuitOpen
+func (b *Breaker) Complete(ctx context.Context, req Request) (string, error) {
+	if !b.allow() {
+		return "", ErrCircuitOpen
+	}
+
+	response, err := b.provider.Complete(ctx, req)
+	if err != nil && ctx.Err() != nil {
+		// 调用方取消（例如服务关闭）不代表模型服务不可用
+		b.release()
+		return "", err
+	}
+	b.record(err)
+	return response, err
+}
+
+// Health 返回当前的健康状态
+func (b *Breaker) Health() Health {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	health := Health{
+		Provider:            b.provider.Name(),
+		State:               b.state,
+		Healthy:             b.state == StateClosed,
+		ConsecutiveFailures: b.failures,
+		LastError:           b.lastError,
+		LastSuccess:         formatTime(b.lastSuccess),
+		LastFailure:         formatTime(b.lastFailure),
+	}
+	if b.state == StateOpen {
+		health.RetryAt = formatTime(b.openedAt.Add(b.cooldown))
+	}
+	return health
+}
+
+// allow 检查是否允许调用，冷却结束时转为半开状态并只放行一个探测请求
+func (b *Breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case StateOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = StateHalfOpen
+		b.probing = true
+		log.Printf("模型服务%s熔断冷却结束，发送探测请求", b.provider.Name())
+		return true
+	case StateHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	}
+	return true
+}
+
+// release 放弃本次调用的结果，允许下一个探测请求
+func (b *Breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// record 记录调用结果并切换状态
+func (b *Breaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	now := b.now()
+
+	if err == nil {
+		if b.state != StateClosed {
+			log.Printf("模型服务%s已恢复", b.provider.Name())
+		}
+		b.state = StateClosed
+		b.failures = 0
+		b.lastSuccess = now
+		return
+	}
+
+	b.failures++
+	b.lastError = err.Error()
+	b.lastFailure = now
+
+	switch {
+	case b.state == StateHalfOpen:
+		b.state = StateOpen
+		b.openedAt = now
+		log.Printf("模型服务%s探测失败，继续熔断%s: %v", b.provider.Name(), b.cooldown, err)
+	case b.state == StateClosed && b.failures >= b.threshold:
+		b.state = StateOpen
+		b.openedAt = now
+		log.Printf("模型服务%s连续失败%d次，熔断%s: %v", b.provider.Name(), b.failures, b.cooldown, err)
+	}
+}
+
+// formatTime 格式化时间，零值返回空字符串
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
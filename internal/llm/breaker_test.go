@@ -0,0 +1,160 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"testing"
+	"time"
+)
+
+// fakeProvider 按设置返回结果的模型服务，block不为nil时等待它关闭后才返回
+type fakeProvider struct {
+	err   error
+	calls int
+	block chan struct{}
+}
+
+// Name 实现Provider接口
+func (p *fakeProvider) Name() string {
+	return "fake"
+}
+
+// Complete 实现Provider接口
+func (p *fakeProvider) Complete(ctx context.Context, req Request) (string, error) {
+	p.calls++
+	if p.block != nil {
+		select {
+		case <-p.block:
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+	if p.err != nil {
+		return "", p.err
+	}
+	return "ok", nil
+}
+
+// newTestBreaker 创建使用可控时钟的熔断器
+func newTestBreaker(provider Provider, threshold int, cooldown time.Duration) (*Breaker, *time.Time) {
+	now := time.Now()
+	breaker := NewBreaker(provider, threshold, cooldown)
+	breaker.now = func() time.Time { return now }
+	return breaker, &now
+}
+
+// expectState 检查熔断器状态
+func expectState(t *testing.T, breaker *Breaker, want string) {
+	t.Helper()
+	if state := breaker.Health().State; state != want {
+		t.Fatalf("期望状态%s，实际%s", want, state)
+	}
+}
+
+// TestBreakerTransitions 连续失败后打开，冷却后半开，探测失败重新打开，探测成功关闭
+func TestBreakerTransitions(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	provider := &fakeProvider{err: errors.New("connection refused")}
+	breaker, now := newTestBreaker(provider, 3, time.Minute)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		breaker.Complete(ctx, Request{})
+	}
+	expectState(t, breaker, StateClosed)
+
+	breaker.Complete(ctx, Request{})
+	expectState(t, breaker, StateOpen)
+	health := breaker.Health()
+	if health.Healthy || health.ConsecutiveFailures != 3 || health.RetryAt == "" || health.LastError == "" {
+		t.Errorf("打开后的健康状态不正确: %+v", health)
+	}
+
+	// 冷却期间不调用模型服务
+	if _, err := breaker.Complete(ctx, Request{}); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("期望ErrCircuitOpen，实际 %v", err)
+	}
+	if provider.calls != 3 {
+		t.Errorf("熔断时不应调用模型服务，实际调用%d次", provider.calls)
+	}
+
+	// 冷却结束后放行一个探测请求，探测失败时继续熔断
+	*now = now.Add(time.Minute)
+	if _, err := breaker.Complete(ctx, Request{}); errors.Is(err, ErrCircuitOpen) || provider.calls != 4 {
+		t.Fatalf("冷却结束后应当放行探测请求: %v", err)
+	}
+	expectState(t, breaker, StateOpen)
+	if _, err := breaker.Complete(ctx, Request{}); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("探测失败后应当重新熔断，实际 %v", err)
+	}
+
+	// 探测成功时关闭
+	*now = now.Add(time.Minute)
+	provider.err = nil
+	if response, err := breaker.Complete(ctx, Request{}); err != nil || response != "ok" {
+		t.Fatalf("探测请求失败: %q %v", response, err)
+	}
+	expectState(t, breaker, StateClosed)
+	if health := breaker.Health(); !health.Healthy || health.ConsecutiveFailures != 0 || health.LastSuccess == "" {
+		t.Errorf("恢复后的健康状态不正确: %+v", health)
+	}
+}
+
+// TestBreakerHalfOpenAllowsOneProbe 半开状态下探测请求返回之前，其他请求仍然被拒绝
+func TestBreakerHalfOpenAllowsOneProbe(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	provider := &fakeProvider{err: errors.New("connection refused")}
+	breaker, now := newTestBreaker(provider, 1, time.Minute)
+	breaker.Complete(context.Background(), Request{})
+	expectState(t, breaker, StateOpen)
+
+	*now = now.Add(time.Minute)
+	provider.err = nil
+	provider.block = make(chan struct{})
+	done := make(chan error)
+	go func() {
+		_, err := breaker.Complete(context.Background(), Request{})
+		done <- err
+	}()
+
+	// 等待探测请求进入半开状态
+	deadline := time.Now().Add(time.Second)
+	for breaker.Health().State != StateHalfOpen {
+		if time.Now().After(deadline) {
+			t.Fatal("没有进入半开状态")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := breaker.Complete(context.Background(), Request{}); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("探测期间其他请求应当被拒绝，实际 %v", err)
+	}
+
+	close(provider.block)
+	if err := <-done; err != nil {
+		t.Fatalf("探测请求失败: %v", err)
+	}
+	expectState(t, breaker, StateClosed)
+}
+
+// TestBreakerIgnoresCanceledCalls 调用方取消的请求不计为失败
+func TestBreakerIgnoresCanceledCalls(t *testing.T) {
+	provider := &fakeProvider{block: make(chan struct{})}
+	breaker, _ := newTestBreaker(provider, 1, time.Minute)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := breaker.Complete(ctx, Request{}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("期望context.Canceled，实际 %v", err)
+	}
+	expectState(t, breaker, StateClosed)
+	if failures := breaker.Health().ConsecutiveFailures; failures != 0 {
+		t.Errorf("取消的请求不应计为失败，实际%d次", failures)
+	}
+}
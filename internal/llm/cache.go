@@ -0,0 +1,85 @@
+package llm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"mail-temp/internal/lru"
+)
+
+// 默认缓存有效期
+const defaultCacheTTL = 24 * time.Hour
+
+// CacheStats 缓存统计
+type CacheStats struct {
+	Entries int    `json:"entries"`
+	MaxSize int    `json:"maxSize"`
+	Hits    uint64 `json:"hits"`
+	Misses  uint64 `json:"misses"`
+}
+
+// CachedProvider 按提示词和输出结构的哈希缓存模型回复，相同模板、相同内容的邮件不会重复调用模型；
+// 只缓存成功的回复
+type CachedProvider struct {
+	provider Provider
+	maxSize  int
+	cache    *lru.Cache[string, string]
+}
+
+// NewCachedProvider 为模型服务添加LRU缓存，maxSize为0时不缓存
+func NewCachedProvider(provider Provider, maxSize int, ttl time.Duration) *CachedProvider {
+	if ttl <= 0 {
+		ttl = defaultCacheTTL
+	}
+	return &CachedProvider{
+		provider: provider,
+		maxSize:  maxSize,
+		cache:    lru.New[string, string](int64(maxSize), ttl, nil),
+	}
+}
+
+// Name 实现Provider接口
+func (c *CachedProvider) Name() string {
+	return c.provider.Name()
+}
+
+// Complete 实现Provider接口
+func (c *CachedProvider) Complete(ctx context.Context, req Request) (string, error) {
+	if c.maxSize <= 0 {
+		return c.provider.Complete(ctx, req)
+	}
+
+	key := requestHash(req)
+	if response, ok := c.cache.Get(key); ok {
+		return response, nil
+	}
+
+	response, err := c.provider.Complete(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	c.cache.Set(key, response)
+	return response, nil
+}
+
+// Stats 返回缓存统计
+func (c *CachedProvider) Stats() CacheStats {
+	stats := c.cache.Stats()
+	return CacheStats{
+		Entries: stats.Entries,
+		MaxSize: c.maxSize,
+		Hits:    stats.Hits,
+		Misses:  stats.Misses,
+	}
+}
+
+// requestHash 计算提示词和输出结构的SHA-256哈希
+func requestHash(req Request) string {
+	h := sha256.New()
+	h.Write([]byte(req.Prompt))
+	h.Write([]byte{0})
+	h.Write(req.Schema)
+	return hex.EncodeToString(h.Sum(nil))
+}
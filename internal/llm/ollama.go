@@ -0,0 +1,57 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// ollamaRequest Ollama /api/generate请求
+type ollamaRequest struct {
+	Model   string                 `json:"model"`
+	Prompt  string                 `json:"prompt"`
+	Stream  bool                   `json:"stream"`
+	Format  json.RawMessage        `json:"format,omitempty"`
+	Options map[string]interface{} `json:"options,omitempty"`
+}
+
+// ollamaResponse Ollama /api/generate响应
+type ollamaResponse struct {
+	Response string `json:"response"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ollamaProvider 使用Ollama的/api/generate接口
+type ollamaProvider struct {
+	http  *httpClient
+	url   string
+	model string
+}
+
+// Name 实现Provider接口
+func (p *ollamaProvider) Name() string {
+	return ProviderOllama + "/" + p.model
+}
+
+// Complete 实现Provider接口
+func (p *ollamaProvider) Complete(ctx context.Context, req Request) (string, error) {
+	request := ollamaRequest{
+		Model:  p.model,
+		Prompt: req.Prompt,
+		Stream: false,
+	}
+	if len(req.Schema) > 0 {
+		// 结构化输出时使用确定性的采样
+		request.Format = req.Schema
+		request.Options = map[string]interface{}{"temperature": 0}
+	}
+
+	var result ollamaResponse
+	err := p.http.postJSON(ctx, p.url, request, &result)
+	if err != nil {
+		return "", err
+	}
+	if result.Error != "" {
+		return "", &responseError{message: result.Error}
+	}
+	return result.Response, nil
+}
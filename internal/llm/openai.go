@@ -0,0 +1,93 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+)
+
+// chatMessage OpenAI chat completions消息
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// chatRequest OpenAI chat completions请求
+type chatRequest struct {
+	Model          string          `json:"model"`
+	Messages       []chatMessage   `json:"messages"`
+	Temperature    float64         `json:"temperature"`
+	Stream         bool            `json:"stream"`
+	ResponseFormat *responseFormat `json:"response_format,omitempty"`
+}
+
+// responseFormat OpenAI结构化输出参数
+type responseFormat struct {
+	Type       string      `json:"type"`
+	JSONSchema *jsonSchema `json:"json_schema,omitempty"`
+}
+
+// jsonSchema response_format中的JSON Schema
+type jsonSchema struct {
+	Name   string          `json:"name"`
+	Schema json.RawMessage `json:"schema"`
+	Strict bool            `json:"strict"`
+}
+
+// chatResponse OpenAI chat completions响应
+type chatResponse struct {
+	Choices []struct {
+		Message chatMessage `json:"message"`
+	} `json:"choices"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// openAIProvider 使用兼容OpenAI的/chat/completions接口（llama.cpp server、vLLM、LocalAI等）
+type openAIProvider struct {
+	http  *httpClient
+	url   string
+	model string
+}
+
+// Name 实现Provider接口
+func (p *openAIProvider) Name() string {
+	return ProviderOpenAI + "/" + p.model
+}
+
+// Complete 实现Provider接口
+func (p *openAIProvider) Complete(ctx context.Context, req Request) (string, error) {
+	request := chatRequest{
+		Model:    p.model,
+		Messages: []chatMessage{{Role: "user", Content: req.Prompt}},
+	}
+	if len(req.Schema) > 0 {
+		request.ResponseFormat = &responseFormat{
+			Type:       "json_schema",
+			JSONSchema: &jsonSchema{Name: "response", Schema: req.Schema, Strict: true},
+		}
+	}
+
+	var result chatResponse
+	err := p.http.postJSON(ctx, p.url, request, &result)
+	if err != nil {
+		return "", err
+	}
+	if result.Error != nil {
+		return "", &responseError{message: result.Error.Message}
+	}
+	if len(result.Choices) == 0 {
+		return "", &responseError{message: "响应中没有choices"}
+	}
+	return result.Choices[0].Message.Content, nil
+}
+
+// chatCompletionsURL 补全接口路径，允许只配置基础地址（例如http://localhost:8000/v1）
+func chatCompletionsURL(base string) string {
+	base = strings.TrimRight(base, "/")
+	if strings.HasSuffix(base, "/chat/completions") {
+		return base
+	}
+	return base + "/chat/completions"
+}
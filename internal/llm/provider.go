@@ -0,0 +1,167 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// 支持的模型服务类型
+const (
+	ProviderOllama = "ollama"
+	ProviderOpenAI = "openai"
+)
+
+const (
+	// 默认单次请求超时时间
+	defaultTimeout = 5 * time.Second
+	// 重试前的等待时间
+	retryDelay = 500 * time.Millisecond
+	// 响应体最大字节数
+	maxResponseBytes = 1 << 20
+)
+
+// Provider 大语言模型服务
+type Provider interface {
+	// Name 返回服务类型和模型名称，用于日志
+	Name() string
+	// Complete 发送提示词并返回模型的回复
+	Complete(ctx context.Context, req Request) (string, error)
+}
+
+// Request 模型请求
+type Request struct {
+	Prompt string
+	// Schema 可选的JSON Schema，设置后要求模型按该结构输出JSON
+	// （Ollama的format参数，OpenAI兼容接口的response_format）
+	Schema json.RawMessage
+}
+
+// Options 模型服务配置
+type Options struct {
+	Provider string        // ollama或openai（兼容OpenAI chat completions接口的服务，例如llama.cpp server、vLLM、LocalAI）
+	URL      string        // 接口地址
+	APIKey   string        // OpenAI兼容接口的密钥，可为空
+	Model    string        // 模型名称
+	Timeout  time.Duration // 单次请求超时时间
+	Retries  int           // 失败后的重试次数
+}
+
+// NewProvider 按配置创建模型服务
+func NewProvider(opts Options) (Provider, error) {
+	if opts.URL == "" {
+		return nil, errors.New("未配置模型服务地址")
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultTimeout
+	}
+	if opts.Retries < 0 {
+		opts.Retries = 0
+	}
+
+	client := &httpClient{
+		client:  &http.Client{},
+		timeout: opts.Timeout,
+		retries: opts.Retries,
+		apiKey:  opts.APIKey,
+	}
+
+	switch strings.ToLower(opts.Provider) {
+	case "", ProviderOllama:
+		return &ollamaProvider{http: client, url: opts.URL, model: opts.Model}, nil
+	case ProviderOpenAI:
+		return &openAIProvider{http: client, url: chatCompletionsURL(opts.URL), model: opts.Model}, nil
+	default:
+		return nil, fmt.Errorf("不支持的模型服务: %s", opts.Provider)
+	}
+}
+
+// httpClient 带超时和重试的JSON请求客户端
+type httpClient struct {
+	client  *http.Client
+	timeout time.Duration
+	retries int
+	apiKey  string
+}
+
+// postJSON 发送JSON请求并解析JSON响应，网络错误和5xx响应会重试
+func (c *httpClient) postJSON(ctx context.Context, url string, request, response interface{}) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("JSON编码错误: %w", err)
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= c.retries; attempt++ {
+		if attempt > 0 {
+			log.Printf("调用模型服务失败(重试%d): %v", attempt, lastErr)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(retryDelay):
+			}
+		}
+
+		var retry bool
+		retry, lastErr = c.post(ctx, url, body, response)
+		if lastErr == nil || !retry {
+			return lastErr
+		}
+	}
+	if c.retries == 0 {
+		return lastErr
+	}
+	return fmt.Errorf("超过最大重试次数: %w", lastErr)
+}
+
+// post 发送一次请求，返回是否值得重试
+func (c *httpClient) post(ctx context.Context, url string, body []byte, response interface{}) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("创建请求失败: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	if err != nil {
+		return true, fmt.Errorf("读取响应失败: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests,
+			fmt.Errorf("模型服务返回%s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+
+	if err := json.Unmarshal(data, response); err != nil {
+		return false, fmt.Errorf("解析响应失败: %w", err)
+	}
+	return false, nil
+}
+
+// responseError 模型服务在响应中返回的错误
+type responseError struct {
+	message string
+}
+
+// Error 实现error接口
+func (e *responseError) Error() string {
+	return "模型服务返回错误: " + e.message
+}
@@ -0,0 +1,231 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testSchema 测试用的输出结构
+var testSchema = json.RawMessage(`{"type":"object","properties":{"code":{"type":"string"}}}`)
+
+// mockServer 启动模拟的模型服务，记录每次请求的路径、请求头和请求体
+func mockServer(t *testing.T, handler func(w http.ResponseWriter, r *http.Request, body map[string]interface{})) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("期望POST application/json，实际%s %s", r.Method, r.Header.Get("Content-Type"))
+		}
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("请求体不是JSON: %v", err)
+		}
+		handler(w, r, body)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// newTestProvider 创建指向模拟服务的模型服务
+func newTestProvider(t *testing.T, opts Options) Provider {
+	t.Helper()
+	provider, err := NewProvider(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return provider
+}
+
+// TestOllamaProvider 检查/api/generate的请求格式和响应解析
+func TestOllamaProvider(t *testing.T) {
+	server := mockServer(t, func(w http.ResponseWriter, r *http.Request, body map[string]interface{}) {
+		if r.URL.Path != "/api/generate" {
+			t.Errorf("请求路径不正确: %s", r.URL.Path)
+		}
+		if body["model"] != "gemma3:1b" || body["prompt"] != "find the code" || body["stream"] != false {
+			t.Errorf("请求体不正确: %v", body)
+		}
+		if _, ok := body["format"].(map[string]interface{}); !ok {
+			t.Errorf("结构化输出时应当带format: %v", body)
+		}
+		if options, _ := body["options"].(map[string]interface{}); options["temperature"] != float64(0) {
+			t.Errorf("结构化输出时temperature应为0: %v", body)
+		}
+		w.Write([]byte(`{"model":"gemma3:1b","response":"{\"code\":\"482913\"}","done":true}`))
+	})
+
+	provider := newTestProvider(t, Options{Provider: ProviderOllama, URL: server.URL + "/api/generate", Model: "gemma3:1b"})
+	if name := provider.Name(); name != "ollama/gemma3:1b" {
+		t.Errorf("名称不正确: %s", name)
+	}
+	response, err := provider.Complete(context.Background(), Request{Prompt: "find the code", Schema: testSchema})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response != `{"code":"482913"}` {
+		t.Errorf("回复不正确: %s", response)
+	}
+}
+
+// TestOllamaProviderWithoutSchema 不要求结构化输出时不发送format和options
+func TestOllamaProviderWithoutSchema(t *testing.T) {
+	server := mockServer(t, func(w http.ResponseWriter, r *http.Request, body map[string]interface{}) {
+		if _, ok := body["format"]; ok {
+			t.Errorf("不应带format: %v", body)
+		}
+		if _, ok := body["options"]; ok {
+			t.Errorf("不应带options: %v", body)
+		}
+		w.Write([]byte(`{"response":"482913"}`))
+	})
+
+	provider := newTestProvider(t, Options{URL: server.URL, Model: "gemma3:1b"})
+	if response, err := provider.Complete(context.Background(), Request{Prompt: "code?"}); err != nil || response != "482913" {
+		t.Errorf("期望482913，实际%q %v", response, err)
+	}
+}
+
+// TestOllamaProviderError 响应中的error字段作为错误返回
+func TestOllamaProviderError(t *testing.T) {
+	server := mockServer(t, func(w http.ResponseWriter, r *http.Request, body map[string]interface{}) {
+		w.Write([]byte(`{"error":"model 'gemma3:1b' not found"}`))
+	})
+
+	provider := newTestProvider(t, Options{URL: server.URL, Model: "gemma3:1b"})
+	_, err := provider.Complete(context.Background(), Request{Prompt: "code?"})
+	var responseErr *responseError
+	if !errors.As(err, &responseErr) || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("期望模型服务返回的错误，实际 %v", err)
+	}
+}
+
+// TestOpenAIProvider 检查/chat/completions的请求格式、密钥和响应解析
+func TestOpenAIProvider(t *testing.T) {
+	server := mockServer(t, func(w http.ResponseWriter, r *http.Request, body map[string]interface{}) {
+		if r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("请求路径不正确: %s", r.URL.Path)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "Bearer sk-test" {
+			t.Errorf("Authorization不正确: %s", auth)
+		}
+		messages, _ := body["messages"].([]interface{})
+		if len(messages) != 1 {
+			t.Fatalf("messages不正确: %v", body)
+		}
+		if message := messages[0].(map[string]interface{}); message["role"] != "user" || message["content"] != "find the code" {
+			t.Errorf("消息不正确: %v", message)
+		}
+		if body["model"] != "qwen2.5" || body["temperature"] != float64(0) || body["stream"] != false {
+			t.Errorf("请求体不正确: %v", body)
+		}
+		format, _ := body["response_format"].(map[string]interface{})
+		schema, _ := format["json_schema"].(map[string]interface{})
+		if format["type"] != "json_schema" || schema["strict"] != true || schema["schema"] == nil {
+			t.Errorf("response_format不正确: %v", body["response_format"])
+		}
+		w.Write([]byte(`{"choices":[{"index":0,"message":{"role":"assistant","content":"{\"code\":\"482913\"}"}}]}`))
+	})
+
+	provider := newTestProvider(t, Options{Provider: ProviderOpenAI, URL: server.URL + "/v1/", APIKey: "sk-test", Model: "qwen2.5"})
+	if name := provider.Name(); name != "openai/qwen2.5" {
+		t.Errorf("名称不正确: %s", name)
+	}
+	response, err := provider.Complete(context.Background(), Request{Prompt: "find the code", Schema: testSchema})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response != `{"code":"482913"}` {
+		t.Errorf("回复不正确: %s", response)
+	}
+}
+
+// TestOpenAIProviderErrors 响应中的error对象和空的choices作为错误返回
+func TestOpenAIProviderErrors(t *testing.T) {
+	tests := map[string]string{
+		`{"error":{"message":"invalid model"}}`: "invalid model",
+		`{"choices":[]}`:                        "没有choices",
+	}
+	for reply, want := range tests {
+		reply := reply
+		server := mockServer(t, func(w http.ResponseWriter, r *http.Request, body map[string]interface{}) {
+			w.Write([]byte(reply))
+		})
+
+		provider := newTestProvider(t, Options{Provider: ProviderOpenAI, URL: server.URL, Model: "qwen2.5"})
+		_, err := provider.Complete(context.Background(), Request{Prompt: "code?"})
+		var responseErr *responseError
+		if !errors.As(err, &responseErr) || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: 期望包含%q的错误，实际 %v", reply, want, err)
+		}
+	}
+}
+
+// TestProviderRetries 5xx响应会重试，4xx响应直接返回错误
+func TestProviderRetries(t *testing.T) {
+	var requests int32
+	server := mockServer(t, func(w http.ResponseWriter, r *http.Request, body map[string]interface{}) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			http.Error(w, "model is loading", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"response":"482913"}`))
+	})
+
+	provider := newTestProvider(t, Options{URL: server.URL, Model: "gemma3:1b", Retries: 1})
+	if response, err := provider.Complete(context.Background(), Request{Prompt: "code?"}); err != nil || response != "482913" {
+		t.Errorf("重试后期望482913，实际%q %v", response, err)
+	}
+	if got := atomic.LoadInt32(&requests); got != 2 {
+		t.Errorf("期望请求2次，实际%d次", got)
+	}
+
+	atomic.StoreInt32(&requests, 0)
+	badRequest := mockServer(t, func(w http.ResponseWriter, r *http.Request, body map[string]interface{}) {
+		atomic.AddInt32(&requests, 1)
+		http.Error(w, "bad request", http.StatusBadRequest)
+	})
+	provider = newTestProvider(t, Options{URL: badRequest.URL, Model: "gemma3:1b", Retries: 2})
+	if _, err := provider.Complete(context.Background(), Request{Prompt: "code?"}); err == nil || !strings.Contains(err.Error(), "400") {
+		t.Errorf("期望400错误，实际 %v", err)
+	}
+	if got := atomic.LoadInt32(&requests); got != 1 {
+		t.Errorf("4xx不应重试，实际请求%d次", got)
+	}
+}
+
+// TestProviderTimeout 模型服务响应过慢时在超时时间后失败
+func TestProviderTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := mockServer(t, func(w http.ResponseWriter, r *http.Request, body map[string]interface{}) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	})
+	defer close(release)
+
+	provider := newTestProvider(t, Options{URL: server.URL, Model: "gemma3:1b", Timeout: 50 * time.Millisecond})
+	start := time.Now()
+	if _, err := provider.Complete(context.Background(), Request{Prompt: "code?"}); err == nil {
+		t.Fatal("期望超时错误")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("超时没有生效，耗时 %v", elapsed)
+	}
+}
+
+// TestNewProviderErrors 缺少地址或服务类型不支持时返回错误
+func TestNewProviderErrors(t *testing.T) {
+	if _, err := NewProvider(Options{Model: "gemma3:1b"}); err == nil {
+		t.Error("缺少地址时应当返回错误")
+	}
+	if _, err := NewProvider(Options{Provider: "unknown", URL: "http://localhost"}); err == nil {
+		t.Error("不支持的服务类型应当返回错误")
+	}
+}
@@ -0,0 +1,129 @@
+package lru
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// entry 缓存项
+type entry[K comparable, V any] struct {
+	key     K
+	value   V
+	size    int64
+	expires time.Time
+}
+
+// Stats 缓存统计
+type Stats struct {
+	Entries int
+	Size    int64
+	Hits    uint64
+	Misses  uint64
+}
+
+// Cache 带有效期的LRU缓存，按各项大小之和限制容量，可并发使用
+type Cache[K comparable, V any] struct {
+	maxSize int64
+	ttl     time.Duration
+	sizeOf  func(V) int64
+	now     func() time.Time
+
+	mu      sync.Mutex
+	size    int64
+	order   *list.List
+	entries map[K]*list.Element
+	hits    uint64
+	misses  uint64
+}
+
+// New 创建缓存：maxSize为各项大小之和的上限，为0时不缓存；ttl不大于0时缓存项不过期；
+// sizeOf计算每一项的大小，为nil时每一项计为1，即按项数限制容量
+func New[K comparable, V any](maxSize int64, ttl time.Duration, sizeOf func(V) int64) *Cache[K, V] {
+	if sizeOf == nil {
+		sizeOf = func(V) int64 { return 1 }
+	}
+	return &Cache[K, V]{
+		maxSize: maxSize,
+		ttl:     ttl,
+		sizeOf:  sizeOf,
+		now:     time.Now,
+		order:   list.New(),
+		entries: make(map[K]*list.Element),
+	}
+}
+
+// Get 获取缓存项，过期的项会被移除
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var zero V
+	elem, ok := c.entries[key]
+	if !ok {
+		c.misses++
+		return zero, false
+	}
+
+	e := elem.Value.(*entry[K, V])
+	if c.ttl > 0 && c.now().After(e.expires) {
+		c.remove(elem)
+		c.misses++
+		return zero, false
+	}
+
+	c.order.MoveToFront(elem)
+	c.hits++
+	return e.value, true
+}
+
+// Set 添加或替换缓存项，超出容量时淘汰最久未使用的项；单项超过容量时不缓存
+func (c *Cache[K, V]) Set(key K, value V) {
+	size := c.sizeOf(value)
+	if size > c.maxSize {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+
+	c.entries[key] = c.order.PushFront(&entry[K, V]{
+		key:     key,
+		value:   value,
+		size:    size,
+		expires: c.now().Add(c.ttl),
+	})
+	c.size += size
+
+	for c.size > c.maxSize {
+		oldest := c.order.Back()
+		if oldest == nil {
+			break
+		}
+		c.remove(oldest)
+	}
+}
+
+// Stats 返回缓存统计
+func (c *Cache[K, V]) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return Stats{
+		Entries: c.order.Len(),
+		Size:    c.size,
+		Hits:    c.hits,
+		Misses:  c.misses,
+	}
+}
+
+// remove 移除缓存项，调用方需持有锁
+func (c *Cache[K, V]) remove(elem *list.Element) {
+	e := c.order.Remove(elem).(*entry[K, V])
+	delete(c.entries, e.key)
+	c.size -= e.size
+}
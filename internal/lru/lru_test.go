@@ -0,0 +1,88 @@
+package lru
+
+import (
+	"testing"
+	"time"
+)
+
+// TestCacheEvictsLeastRecentlyUsed 超出容量时淘汰最久未使用的项，Get会刷新使用顺序
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := New[string, int](2, 0, nil)
+	c.Set("a", 1)
+	c.Set("b", 2)
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("a应当命中")
+	}
+	c.Set("c", 3)
+
+	if _, ok := c.Get("b"); ok {
+		t.Error("b应当被淘汰")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := c.Get(key); !ok {
+			t.Errorf("%s应当命中", key)
+		}
+	}
+
+	stats := c.Stats()
+	if stats.Entries != 2 || stats.Hits != 3 || stats.Misses != 1 {
+		t.Errorf("统计不正确: %+v", stats)
+	}
+}
+
+// TestCacheSize 按sizeOf计算容量，替换已有项时释放旧项的大小，超过容量的单项不缓存
+func TestCacheSize(t *testing.T) {
+	c := New[string, []byte](10, 0, func(v []byte) int64 { return int64(len(v)) })
+	c.Set("a", make([]byte, 4))
+	c.Set("b", make([]byte, 4))
+	c.Set("a", make([]byte, 2))
+	if size := c.Stats().Size; size != 6 {
+		t.Errorf("期望大小6，实际%d", size)
+	}
+
+	c.Set("c", make([]byte, 6))
+	if _, ok := c.Get("b"); ok {
+		t.Error("b应当被淘汰")
+	}
+	if size := c.Stats().Size; size != 8 {
+		t.Errorf("期望大小8，实际%d", size)
+	}
+
+	c.Set("big", make([]byte, 11))
+	if _, ok := c.Get("big"); ok {
+		t.Error("超过容量的项不应缓存")
+	}
+	if _, ok := c.Get("c"); !ok {
+		t.Error("缓存超大项不应淘汰已有的项")
+	}
+}
+
+// TestCacheExpires 过期的项在读取时被移除
+func TestCacheExpires(t *testing.T) {
+	now := time.Now()
+	c := New[string, int](10, time.Minute, nil)
+	c.now = func() time.Time { return now }
+
+	c.Set("a", 1)
+	now = now.Add(59 * time.Second)
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("未过期的项应当命中")
+	}
+
+	now = now.Add(2 * time.Second)
+	if _, ok := c.Get("a"); ok {
+		t.Error("过期的项不应命中")
+	}
+	if entries := c.Stats().Entries; entries != 0 {
+		t.Errorf("过期的项应当被移除，实际还有%d项", entries)
+	}
+}
+
+// TestCacheDisabled 容量为0时不缓存
+func TestCacheDisabled(t *testing.T) {
+	c := New[string, int](0, 0, nil)
+	c.Set("a", 1)
+	if _, ok := c.Get("a"); ok {
+		t.Error("容量为0时不应缓存")
+	}
+}
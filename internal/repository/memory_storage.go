@@ -1,23 +1,77 @@
 package repository
 
 import (
+	"log"
 	"sync"
+	"time"
 )
 
 // MemoryStorage 内存存储实现
 type MemoryStorage struct {
 	emails       map[string][]*EmailMessage
-	activeEmails map[string]bool
+	activeEmails map[string]ActiveEmail
 	mu           sync.RWMutex
+
+	stop     chan struct{}
+	stopOnce sync.Once
 }
 
 // NewMemoryStorage 创建新的内存存储
 func NewMemoryStorage() *MemoryStorage {
 	return &MemoryStorage{
 		emails:       make(map[string][]*EmailMessage),
-		activeEmails: make(map[string]bool),
+		activeEmails: make(map[string]ActiveEmail),
 		mu:           sync.RWMutex{},
+		stop:         make(chan struct{}),
+	}
+}
+
+// StartJanitor 启动后台清理，每隔interval删除已过期的邮箱及其邮件
+func (s *MemoryStorage) StartJanitor(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if n := s.removeExpired(time.Now()); n > 0 {
+					log.Printf("已清理%d个过期邮箱", n)
+				}
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Close 停止后台清理
+func (s *MemoryStorage) Close() {
+	s.stopOnce.Do(func() { close(s.stop) })
+}
+
+// removeExpired 删除在now之前过期的邮箱及其邮件，返回删除的邮箱数
+func (s *MemoryStorage) removeExpired(now time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed := 0
+	for username, active := range s.activeEmails {
+		if !now.Before(active.ExpiresAt) {
+			delete(s.activeEmails, username)
+			delete(s.emails, username)
+			removed++
+		}
 	}
+	return removed
+}
+
+// isActive 检查邮箱是否存在且未过期，调用方需持有锁
+func (s *MemoryStorage) isActive(username string, now time.Time) bool {
+	active, ok := s.activeEmails[username]
+	return ok && now.Before(active.ExpiresAt)
 }
 
 // SaveEmail 保存邮件
@@ -25,6 +79,9 @@ func (s *MemoryStorage) SaveEmail(email string, message *EmailMessage) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	if !s.isActive(email, time.Now()) {
+		return ErrEmailNotActive
+	}
 	if _, ok := s.emails[email]; !ok {
 		s.emails[email] = []*EmailMessage{}
 	}
@@ -48,6 +105,37 @@ func (s *MemoryStorage) GetEmails(email string) ([]*EmailMessage, error) {
 	return []*EmailMessage{}, nil
 }
 
+// GetEmailByID 根据邮件ID获取邮件
+func (s *MemoryStorage) GetEmailByID(id string) (*EmailMessage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, messages := range s.emails {
+		for _, message := range messages {
+			if message.ID == id {
+				return message, nil
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// UpdateEmail 按邮件ID替换已保存的邮件
+func (s *MemoryStorage) UpdateEmail(email string, message *EmailMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, existing := range s.emails[email] {
+		if existing.ID == message.ID {
+			// 替换指针而不是修改原对象，已返回给调用方的邮件不受影响
+			s.emails[email][i] = message
+			return nil
+		}
+	}
+	return ErrMessageNotFound
+}
+
 // ClearEmails 清除指定邮箱的所有邮件
 func (s *MemoryStorage) ClearEmails(email string) error {
 	s.mu.Lock()
@@ -57,13 +145,19 @@ func (s *MemoryStorage) ClearEmails(email string) error {
 	return nil
 }
 
-// AddActiveEmail 添加活跃邮箱
-func (s *MemoryStorage) AddActiveEmail(username string) error {
+// CreateActiveEmail 邮箱不存在或已过期时添加活跃邮箱，检查和添加在同一把锁内完成
+func (s *MemoryStorage) CreateActiveEmail(username string, ttl time.Duration, tokenHash string) (bool, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	s.activeEmails[username] = true
-	return nil
+	now := time.Now()
+	if s.isActive(username, now) {
+		return false, nil
+	}
+	// 后台清理还没有删除的过期邮箱，它的邮件不能留给新邮箱
+	delete(s.emails, username)
+	s.activeEmails[username] = ActiveEmail{Username: username, ExpiresAt: now.Add(ttl), TokenHash: tokenHash}
+	return true, nil
 }
 
 // IsActiveEmail 检查邮箱是否活跃
@@ -71,22 +165,66 @@ func (s *MemoryStorage) IsActiveEmail(username string) (bool, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	return s.activeEmails[username], nil
+	return s.isActive(username, time.Now()), nil
+}
+
+// GetActiveEmail 获取活跃邮箱及其过期时间
+func (s *MemoryStorage) GetActiveEmail(username string) (*ActiveEmail, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if !s.isActive(username, time.Now()) {
+		return nil, nil
+	}
+	active := s.activeEmails[username]
+	return &active, nil
 }
 
 // GetActiveEmails 获取所有活跃邮箱
-func (s *MemoryStorage) GetActiveEmails() ([]string, error) {
+func (s *MemoryStorage) GetActiveEmails() ([]ActiveEmail, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	emails := make([]string, 0, len(s.activeEmails))
-	for username := range s.activeEmails {
-		emails = append(emails, username)
+	now := time.Now()
+	emails := make([]ActiveEmail, 0, len(s.activeEmails))
+	for _, active := range s.activeEmails {
+		if now.Before(active.ExpiresAt) {
+			emails = append(emails, active)
+		}
 	}
 
 	return emails, nil
 }
 
+// SetActiveEmailToken 替换活跃邮箱的访问令牌哈希
+func (s *MemoryStorage) SetActiveEmailToken(username, tokenHash string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.isActive(username, time.Now()) {
+		return false, nil
+	}
+	active := s.activeEmails[username]
+	active.TokenHash = tokenHash
+	s.activeEmails[username] = active
+	return true, nil
+}
+
+// ExtendActiveEmail 将活跃邮箱的过期时间重新设置为ttl之后
+func (s *MemoryStorage) ExtendActiveEmail(username string, ttl time.Duration) (*ActiveEmail, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if !s.isActive(username, now) {
+		return nil, nil
+	}
+	active := s.activeEmails[username]
+	active.ExpiresAt = now.Add(ttl)
+	s.activeEmails[username] = active
+	return &active, nil
+}
+
 // DeleteActiveEmail 删除活跃邮箱
 func (s *MemoryStorage) DeleteActiveEmail(username string) error {
 	s.mu.Lock()
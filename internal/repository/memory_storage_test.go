@@ -0,0 +1,170 @@
+package repository
+
+import (
+	"io"
+	"log"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestMemoryCreateActiveEmailConcurrent 并发创建同一个邮箱时只有一个成功，成功者的令牌哈希被保存
+func TestMemoryCreateActiveEmailConcurrent(t *testing.T) {
+	s := NewMemoryStorage()
+
+	const workers = 50
+	var wg sync.WaitGroup
+	results := make([]bool, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			created, err := s.CreateActiveEmail("race", time.Hour, string(rune('a'+i%26)))
+			if err != nil {
+				t.Error(err)
+			}
+			results[i] = created
+		}(i)
+	}
+	wg.Wait()
+
+	winner := -1
+	for i, created := range results {
+		if created {
+			if winner >= 0 {
+				t.Fatalf("期望只有一个成功，实际%d和%d都成功", winner, i)
+			}
+			winner = i
+		}
+	}
+	if winner < 0 {
+		t.Fatal("期望有一个成功，实际都失败")
+	}
+	active, err := s.GetActiveEmail("race")
+	if err != nil || active == nil {
+		t.Fatalf("获取活跃邮箱失败: %v", err)
+	}
+	if want := string(rune('a' + winner%26)); active.TokenHash != want {
+		t.Errorf("期望令牌哈希为成功者的%s，实际%s", want, active.TokenHash)
+	}
+}
+
+// TestMemoryActiveEmailExpiry 过期的邮箱不再活跃，不能保存邮件，可以重新创建且不保留旧邮件
+func TestMemoryActiveEmailExpiry(t *testing.T) {
+	s := NewMemoryStorage()
+	if _, err := s.CreateActiveEmail("short", 20*time.Millisecond, "old"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveEmail("short", &EmailMessage{ID: "m1"}); err != nil {
+		t.Fatal(err)
+	}
+	if created, _ := s.CreateActiveEmail("short", time.Hour, "new"); created {
+		t.Fatal("期望未过期的邮箱不能重新创建")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if active, _ := s.IsActiveEmail("short"); active {
+		t.Error("期望邮箱已过期")
+	}
+	if active, _ := s.GetActiveEmail("short"); active != nil {
+		t.Errorf("期望GetActiveEmail返回nil，实际 %+v", active)
+	}
+	if emails, _ := s.GetActiveEmails(); len(emails) != 0 {
+		t.Errorf("期望活跃邮箱列表为空，实际 %+v", emails)
+	}
+	if err := s.SaveEmail("short", &EmailMessage{ID: "m2"}); err != ErrEmailNotActive {
+		t.Errorf("期望ErrEmailNotActive，实际 %v", err)
+	}
+	if active, _ := s.ExtendActiveEmail("short", time.Hour); active != nil {
+		t.Errorf("期望过期的邮箱不能延长，实际 %+v", active)
+	}
+	if ok, _ := s.SetActiveEmailToken("short", "new"); ok {
+		t.Error("期望过期的邮箱不能替换令牌")
+	}
+
+	created, err := s.CreateActiveEmail("short", time.Hour, "new")
+	if err != nil || !created {
+		t.Fatalf("期望可以重新创建过期的邮箱: %v", err)
+	}
+	if messages, _ := s.GetEmails("short"); len(messages) != 0 {
+		t.Errorf("期望重新创建的邮箱没有旧邮件，实际%d封", len(messages))
+	}
+}
+
+// TestMemoryExtendActiveEmail 延长后保留令牌哈希，过期时间从现在开始计算
+func TestMemoryExtendActiveEmail(t *testing.T) {
+	s := NewMemoryStorage()
+	if _, err := s.CreateActiveEmail("extend", time.Minute, "hash"); err != nil {
+		t.Fatal(err)
+	}
+	active, err := s.ExtendActiveEmail("extend", time.Hour)
+	if err != nil || active == nil {
+		t.Fatalf("延长失败: %v", err)
+	}
+	if active.TokenHash != "hash" {
+		t.Errorf("期望保留令牌哈希，实际%q", active.TokenHash)
+	}
+	if remaining := time.Until(active.ExpiresAt); remaining < 59*time.Minute {
+		t.Errorf("期望剩余约1小时，实际%v", remaining)
+	}
+}
+
+// TestMemoryRemoveExpired 清理时删除过期的邮箱及其邮件，保留未过期的邮箱
+func TestMemoryRemoveExpired(t *testing.T) {
+	s := NewMemoryStorage()
+	if _, err := s.CreateActiveEmail("old", time.Minute, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreateActiveEmail("new", time.Hour, "b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveEmail("old", &EmailMessage{ID: "m1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := s.removeExpired(time.Now()); n != 0 {
+		t.Errorf("期望没有过期的邮箱，实际删除%d个", n)
+	}
+	if n := s.removeExpired(time.Now().Add(2 * time.Minute)); n != 1 {
+		t.Errorf("期望删除1个邮箱，实际%d个", n)
+	}
+	if _, ok := s.activeEmails["old"]; ok {
+		t.Error("期望过期的邮箱被删除")
+	}
+	if _, ok := s.emails["old"]; ok {
+		t.Error("期望过期邮箱的邮件被删除")
+	}
+	if _, ok := s.activeEmails["new"]; !ok {
+		t.Error("期望未过期的邮箱被保留")
+	}
+}
+
+// TestMemoryJanitor 后台清理定期删除过期的邮箱，Close后停止
+func TestMemoryJanitor(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	s := NewMemoryStorage()
+	defer s.Close()
+	if _, err := s.CreateActiveEmail("sweep", time.Millisecond, "a"); err != nil {
+		t.Fatal(err)
+	}
+	s.StartJanitor(5 * time.Millisecond)
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		s.mu.RLock()
+		_, ok := s.activeEmails["sweep"]
+		s.mu.RUnlock()
+		if !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("期望后台清理删除过期的邮箱")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	// 重复关闭不会panic
+	s.Close()
+}
@@ -11,10 +11,11 @@ import (
 
 const (
 	// 键前缀
-	emailKeyPrefix  = "email:"
-	activeKeyPrefix = "active:"
-	// 默认过期时间 (24小时)
-	defaultExpiration = 24 * time.Hour
+	emailKeyPrefix   = "email:"
+	activeKeyPrefix  = "active:"
+	messageKeyPrefix = "message:"
+	// 邮件列表被并发修改时的最大重试次数
+	maxTxRetries = 50
 )
 
 // RedisStorage Redis存储实现
@@ -45,34 +46,86 @@ func NewRedisStorage(redisURL string) (*RedisStorage, error) {
 	}, nil
 }
 
-// SaveEmail 保存邮件
+// SaveEmail 保存邮件，过期时间与活跃邮箱剩余的有效期相同
 func (s *RedisStorage) SaveEmail(email string, message *EmailMessage) error {
-	key := emailKeyPrefix + email
-
-	// 先获取现有邮件列表
-	var messages []*EmailMessage
-	data, err := s.client.Get(s.ctx, key).Bytes()
-	if err != nil && err != redis.Nil {
+	expiration, err := s.client.PTTL(s.ctx, activeKeyPrefix+email).Result()
+	if err != nil {
 		return err
 	}
+	// 键不存在时PTTL返回负数
+	if expiration <= 0 {
+		return ErrEmailNotActive
+	}
+
+	return s.updateMessages(email, expiration, func(messages []*EmailMessage) ([]*EmailMessage, error) {
+		return append(messages, message), nil
+	}, func(pipe redis.Pipeliner) {
+		// 同时记录邮件ID到邮箱的索引
+		if message.ID != "" {
+			pipe.Set(s.ctx, messageKeyPrefix+message.ID, email, expiration)
+		}
+	})
+}
+
+// UpdateEmail 按邮件ID替换已保存的邮件，保留原有的过期时间
+func (s *RedisStorage) UpdateEmail(email string, message *EmailMessage) error {
+	return s.updateMessages(email, redis.KeepTTL, func(messages []*EmailMessage) ([]*EmailMessage, error) {
+		for i, existing := range messages {
+			if existing.ID == message.ID {
+				messages[i] = message
+				return messages, nil
+			}
+		}
+		return nil, ErrMessageNotFound
+	}, nil)
+}
+
+// updateMessages 在WATCH事务中读取、修改并写回邮件列表，
+// 并发的保存和更新（例如后台AI提取）不会互相覆盖
+func (s *RedisStorage) updateMessages(email string, expiration time.Duration, update func([]*EmailMessage) ([]*EmailMessage, error), extra func(redis.Pipeliner)) error {
+	key := emailKeyPrefix + email
 
-	if err != redis.Nil {
-		if err := json.Unmarshal(data, &messages); err != nil {
+	txf := func(tx *redis.Tx) error {
+		// 先获取现有邮件列表
+		var messages []*EmailMessage
+		data, err := tx.Get(s.ctx, key).Bytes()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		if err != redis.Nil {
+			if err := json.Unmarshal(data, &messages); err != nil {
+				return err
+			}
+		}
+
+		messages, err = update(messages)
+		if err != nil {
 			return err
 		}
-	}
 
-	// 添加新邮件
-	messages = append(messages, message)
+		// 序列化并保存
+		jsonData, err := json.Marshal(messages)
+		if err != nil {
+			return err
+		}
 
-	// 序列化并保存
-	jsonData, err := json.Marshal(messages)
-	if err != nil {
+		_, err = tx.TxPipelined(s.ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(s.ctx, key, jsonData, expiration)
+			if extra != nil {
+				extra(pipe)
+			}
+			return nil
+		})
 		return err
 	}
 
-	// 保存到Redis
-	return s.client.Set(s.ctx, key, jsonData, defaultExpiration).Err()
+	for i := 0; i < maxTxRetries; i++ {
+		err := s.client.Watch(s.ctx, txf, key)
+		if err != redis.TxFailedErr {
+			return err
+		}
+	}
+	return fmt.Errorf("更新邮件列表失败: 超过最大重试次数")
 }
 
 // GetEmails 获取指定邮箱的所有邮件
@@ -95,16 +148,62 @@ func (s *RedisStorage) GetEmails(email string) ([]*EmailMessage, error) {
 	return messages, nil
 }
 
+// GetEmailByID 根据邮件ID获取邮件
+func (s *RedisStorage) GetEmailByID(id string) (*EmailMessage, error) {
+	email, err := s.client.Get(s.ctx, messageKeyPrefix+id).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	messages, err := s.GetEmails(email)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, message := range messages {
+		if message.ID == id {
+			return message, nil
+		}
+	}
+
+	return nil, nil
+}
+
 // ClearEmails 清除指定邮箱的所有邮件
 func (s *RedisStorage) ClearEmails(email string) error {
 	key := emailKeyPrefix + email
-	return s.client.Del(s.ctx, key).Err()
+
+	// 一并删除邮件ID索引
+	messages, err := s.GetEmails(email)
+	if err != nil {
+		return err
+	}
+
+	keys := []string{key}
+	for _, message := range messages {
+		if message.ID != "" {
+			keys = append(keys, messageKeyPrefix+message.ID)
+		}
+	}
+	return s.client.Del(s.ctx, keys...).Err()
 }
 
-// AddActiveEmail 添加活跃邮箱
-func (s *RedisStorage) AddActiveEmail(username string) error {
+// CreateActiveEmail 使用SETNX添加活跃邮箱，值为访问令牌的哈希，多个实例同时创建同名邮箱时只有一个成功
+func (s *RedisStorage) CreateActiveEmail(username string, ttl time.Duration, tokenHash string) (bool, error) {
 	key := activeKeyPrefix + username
-	return s.client.Set(s.ctx, key, "1", defaultExpiration).Err()
+	created, err := s.client.SetNX(s.ctx, key, tokenHash, ttl).Result()
+	if err != nil || !created {
+		return false, err
+	}
+	// 同名的过期邮箱可能还有没过期的邮件，不能留给新邮箱
+	if err := s.ClearEmails(username); err != nil {
+		s.client.Del(s.ctx, key)
+		return false, err
+	}
+	return true, nil
 }
 
 // IsActiveEmail 检查邮箱是否活跃
@@ -117,23 +216,126 @@ func (s *RedisStorage) IsActiveEmail(username string) (bool, error) {
 	return val > 0, nil
 }
 
+// GetActiveEmail 获取活跃邮箱及其过期时间
+func (s *RedisStorage) GetActiveEmail(username string) (*ActiveEmail, error) {
+	emails, err := s.activeEmails([]string{activeKeyPrefix + username})
+	if err != nil || len(emails) == 0 {
+		return nil, err
+	}
+	return &emails[0], nil
+}
+
+// activeEmails 批量读取活跃邮箱的令牌哈希和剩余的有效期，忽略已经过期的键
+func (s *RedisStorage) activeEmails(keys []string) ([]ActiveEmail, error) {
+	getCmds := make([]*redis.StringCmd, len(keys))
+	ttlCmds := make([]*redis.DurationCmd, len(keys))
+	_, err := s.client.Pipelined(s.ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			getCmds[i] = pipe.Get(s.ctx, key)
+			ttlCmds[i] = pipe.PTTL(s.ctx, key)
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	emails := make([]ActiveEmail, 0, len(keys))
+	for i, key := range keys {
+		// 扫描之后才过期的键会返回redis.Nil和负数的有效期
+		tokenHash, err := getCmds[i].Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if ttl := ttlCmds[i].Val(); ttl > 0 {
+			emails = append(emails, ActiveEmail{
+				Username:  key[len(activeKeyPrefix):],
+				ExpiresAt: now.Add(ttl),
+				TokenHash: tokenHash,
+			})
+		}
+	}
+	return emails, nil
+}
+
 // GetActiveEmails 获取所有活跃邮箱
-func (s *RedisStorage) GetActiveEmails() ([]string, error) {
+func (s *RedisStorage) GetActiveEmails() ([]ActiveEmail, error) {
 	pattern := activeKeyPrefix + "*"
 	iter := s.client.Scan(s.ctx, 0, pattern, 0).Iterator()
 
-	var usernames []string
+	var keys []string
 	for iter.Next(s.ctx) {
-		key := iter.Val()
-		username := key[len(activeKeyPrefix):]
-		usernames = append(usernames, username)
+		keys = append(keys, iter.Val())
 	}
 
 	if err := iter.Err(); err != nil {
 		return nil, err
 	}
 
-	return usernames, nil
+	return s.activeEmails(keys)
+}
+
+// SetActiveEmailToken 使用SET XX KEEPTTL替换活跃邮箱的访问令牌哈希，键不存在时不创建
+func (s *RedisStorage) SetActiveEmailToken(username, tokenHash string) (bool, error) {
+	err := s.client.SetArgs(s.ctx, activeKeyPrefix+username, tokenHash, redis.SetArgs{Mode: "XX", KeepTTL: true}).Err()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ExtendActiveEmail 将活跃邮箱、邮件列表和邮件ID索引的过期时间重新设置为ttl之后
+func (s *RedisStorage) ExtendActiveEmail(username string, ttl time.Duration) (*ActiveEmail, error) {
+	// EXPIRE和GET放在同一个MULTI中执行，避免键在两者之间过期或被删除，
+	// 导致邮箱被延长但读不到访问令牌哈希
+	key := activeKeyPrefix + username
+	var expireCmd *redis.BoolCmd
+	var getCmd *redis.StringCmd
+	_, err := s.client.TxPipelined(s.ctx, func(pipe redis.Pipeliner) error {
+		expireCmd = pipe.Expire(s.ctx, key, ttl)
+		getCmd = pipe.Get(s.ctx, key)
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+	if !expireCmd.Val() {
+		return nil, nil
+	}
+	expiresAt := time.Now().Add(ttl)
+	tokenHash, err := getCmd.Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	messages, err := s.GetEmails(username)
+	if err != nil {
+		return nil, err
+	}
+	_, err = s.client.Pipelined(s.ctx, func(pipe redis.Pipeliner) error {
+		pipe.Expire(s.ctx, emailKeyPrefix+username, ttl)
+		for _, message := range messages {
+			if message.ID != "" {
+				pipe.Expire(s.ctx, messageKeyPrefix+message.ID, ttl)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &ActiveEmail{Username: username, ExpiresAt: expiresAt, TokenHash: tokenHash}, nil
 }
 
 // DeleteActiveEmail 删除活跃邮箱
@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// newTestRedisStorage 创建连接到内存Redis服务器的存储
+func newTestRedisStorage(t *testing.T) (*RedisStorage, *miniredis.Miniredis) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	s, err := NewRedisStorage("redis://" + server.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s, server
+}
+
+// TestRedisCreateActiveEmailConcurrent 并发创建同一个邮箱时只有一个成功
+func TestRedisCreateActiveEmailConcurrent(t *testing.T) {
+	s, _ := newTestRedisStorage(t)
+
+	const workers = 20
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	winners := 0
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			created, err := s.CreateActiveEmail("race", time.Hour, "hash")
+			if err != nil {
+				t.Error(err)
+			}
+			if created {
+				mu.Lock()
+				winners++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if winners != 1 {
+		t.Errorf("期望只有一个成功，实际%d个", winners)
+	}
+}
+
+// TestRedisActiveEmailExpiry 过期的邮箱不再活跃，不能保存邮件，重新创建时不保留旧邮件
+func TestRedisActiveEmailExpiry(t *testing.T) {
+	s, server := newTestRedisStorage(t)
+	if _, err := s.CreateActiveEmail("short", time.Minute, "old"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveEmail("short", &EmailMessage{ID: "m1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	server.FastForward(2 * time.Minute)
+	if active, _ := s.IsActiveEmail("short"); active {
+		t.Error("期望邮箱已过期")
+	}
+	if err := s.SaveEmail("short", &EmailMessage{ID: "m2"}); err != ErrEmailNotActive {
+		t.Errorf("期望ErrEmailNotActive，实际 %v", err)
+	}
+	if active, err := s.ExtendActiveEmail("short", time.Hour); err != nil || active != nil {
+		t.Errorf("期望过期的邮箱不能延长，实际 %+v, %v", active, err)
+	}
+	if server.Exists(activeKeyPrefix + "short") {
+		t.Error("期望延长失败时不创建活跃邮箱的键")
+	}
+
+	created, err := s.CreateActiveEmail("short", time.Hour, "new")
+	if err != nil || !created {
+		t.Fatalf("期望可以重新创建过期的邮箱: %v", err)
+	}
+	if messages, _ := s.GetEmails("short"); len(messages) != 0 {
+		t.Errorf("期望重新创建的邮箱没有旧邮件，实际%d封", len(messages))
+	}
+}
+
+// TestRedisExtendActiveEmail 延长活跃邮箱、邮件列表和邮件ID索引的有效期，并返回令牌哈希
+func TestRedisExtendActiveEmail(t *testing.T) {
+	s, server := newTestRedisStorage(t)
+	if _, err := s.CreateActiveEmail("extend", time.Minute, "hash"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveEmail("extend", &EmailMessage{ID: "m1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	active, err := s.ExtendActiveEmail("extend", time.Hour)
+	if err != nil || active == nil {
+		t.Fatalf("延长失败: %+v, %v", active, err)
+	}
+	if active.TokenHash != "hash" {
+		t.Errorf("期望令牌哈希为hash，实际%q", active.TokenHash)
+	}
+	for _, key := range []string{activeKeyPrefix + "extend", emailKeyPrefix + "extend", messageKeyPrefix + "m1"} {
+		if ttl := server.TTL(key); ttl != time.Hour {
+			t.Errorf("%s: 期望有效期为1小时，实际%v", key, ttl)
+		}
+	}
+
+	if active, err := s.ExtendActiveEmail("missing", time.Hour); err != nil || active != nil {
+		t.Errorf("期望不存在的邮箱返回nil，实际 %+v, %v", active, err)
+	}
+}
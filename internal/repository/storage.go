@@ -1,36 +1,159 @@
 package repository
 
+import (
+	"errors"
+	"time"
+)
+
+var (
+	// ErrMessageNotFound 要更新的邮件不存在（例如邮箱已被删除）
+	ErrMessageNotFound = errors.New("邮件不存在")
+	// ErrEmailNotActive 保存邮件时邮箱不存在或已过期
+	ErrEmailNotActive = errors.New("邮箱不存在或已过期")
+)
+
 // EmailStorage 定义邮件存储接口
 type EmailStorage interface {
-	// SaveEmail 保存邮件
+	// SaveEmail 保存邮件，邮件与邮箱同时过期；邮箱不存在或已过期时返回ErrEmailNotActive
 	SaveEmail(email string, message *EmailMessage) error
 
 	// GetEmails 获取指定邮箱的所有邮件
 	GetEmails(email string) ([]*EmailMessage, error)
 
+	// GetEmailByID 根据邮件ID获取邮件，不存在时返回nil
+	GetEmailByID(id string) (*EmailMessage, error)
+
+	// UpdateEmail 按邮件ID替换已保存的邮件，不存在时返回ErrMessageNotFound
+	UpdateEmail(email string, message *EmailMessage) error
+
 	// ClearEmails 清除指定邮箱的所有邮件
 	ClearEmails(email string) error
 
-	// AddActiveEmail 添加活跃邮箱
-	AddActiveEmail(username string) error
+	// CreateActiveEmail 原子地添加活跃邮箱，ttl后过期，tokenHash为访问令牌的哈希：
+	// 邮箱不存在（或已过期）时添加并返回true，已存在时不做修改并返回false；过期邮箱遗留的邮件会被清除
+	CreateActiveEmail(username string, ttl time.Duration, tokenHash string) (bool, error)
 
-	// IsActiveEmail 检查邮箱是否活跃
+	// IsActiveEmail 检查邮箱是否活跃（存在且未过期）
 	IsActiveEmail(username string) (bool, error)
 
+	// GetActiveEmail 获取活跃邮箱及其过期时间，不存在或已过期时返回nil
+	GetActiveEmail(username string) (*ActiveEmail, error)
+
 	// GetActiveEmails 获取所有活跃邮箱
-	GetActiveEmails() ([]string, error)
+	GetActiveEmails() ([]ActiveEmail, error)
+
+	// SetActiveEmailToken 替换活跃邮箱的访问令牌哈希，不改变过期时间；邮箱不存在或已过期时返回false
+	SetActiveEmailToken(username, tokenHash string) (bool, error)
+
+	// ExtendActiveEmail 将活跃邮箱及其邮件的过期时间重新设置为ttl之后，邮箱不存在或已过期时返回nil
+	ExtendActiveEmail(username string, ttl time.Duration) (*ActiveEmail, error)
 
 	// DeleteActiveEmail 删除活跃邮箱
 	DeleteActiveEmail(username string) error
 }
 
+// ActiveEmail 活跃邮箱
+type ActiveEmail struct {
+	Username  string
+	ExpiresAt time.Time
+	TokenHash string // 访问令牌的哈希，不保存令牌本身；启用访问令牌之前创建的Redis邮箱为"1"
+}
+
 // EmailMessage 邮件消息结构
 type EmailMessage struct {
-	From        string `json:"from"`
-	To          string `json:"to"`
-	Subject     string `json:"subject"`
-	Body        string `json:"body"`
-	HtmlContent string `json:"htmlContent,omitempty"` // 处理后的HTML内容
-	Timestamp   string `json:"timestamp"`
-	Code        string `json:"code,omitempty"` // 提取的验证码
+	ID               string          `json:"id"`
+	From             string          `json:"from"`
+	To               string          `json:"to"`
+	Subject          string          `json:"subject"`
+	Body             string          `json:"body"`
+	TextContent      string          `json:"textContent,omitempty"` // 纯文本正文
+	HtmlContent      string          `json:"htmlContent,omitempty"` // 处理后的HTML内容
+	Timestamp        string          `json:"timestamp"`
+	Code             string          `json:"code,omitempty"`             // 提取的验证码（去除分隔符）
+	CodeDisplay      string          `json:"codeDisplay,omitempty"`      // 验证码在邮件中的原始写法
+	CodeCandidates   []CodeCandidate `json:"codeCandidates,omitempty"`   // 所有验证码候选，按得分排序
+	CodeExpiresAt    string          `json:"codeExpiresAt,omitempty"`    // 验证码的过期时间（RFC3339），邮件中没有有效期时为空
+	ExtractionStatus string          `json:"extractionStatus,omitempty"` // 验证码提取状态：pending/done/failed/skipped
+	RawMessage       []byte          `json:"rawMessage,omitempty"`       // gzip压缩的原始邮件字节
+	Headers          []Header        `json:"headers,omitempty"`          // 按原始顺序保存的邮件头部
+
+	EmbeddedMessages []EmbeddedMessage `json:"embeddedMessages,omitempty"` // 嵌入的邮件
+	Links            []Link            `json:"links,omitempty"`            // 可操作链接，按得分排序
+	PrimaryLink      string            `json:"primaryLink,omitempty"`      // 最可能的操作链接
+	ImageCodes       []ImageCode       `json:"imageCodes,omitempty"`       // 图片中解码出的二维码、条形码
+	TOTPKeys         []TOTPKey         `json:"totpKeys,omitempty"`         // 两步验证（TOTP）密钥
+	PDFTexts         []PDFText         `json:"pdfTexts,omitempty"`         // PDF附件中提取的文本片段
+}
+
+// EmbeddedMessage 以附件形式嵌入的邮件（message/rfc822，例如转发的邮件）
+type EmbeddedMessage struct {
+	From             string            `json:"from"`
+	To               string            `json:"to"`
+	Subject          string            `json:"subject"`
+	Date             string            `json:"date,omitempty"`
+	TextContent      string            `json:"textContent,omitempty"`
+	HtmlContent      string            `json:"htmlContent,omitempty"`
+	Code             string            `json:"code,omitempty"`
+	CodeDisplay      string            `json:"codeDisplay,omitempty"`
+	CodeCandidates   []CodeCandidate   `json:"codeCandidates,omitempty"`
+	CodeExpiresAt    string            `json:"codeExpiresAt,omitempty"`
+	Links            []Link            `json:"links,omitempty"`
+	PrimaryLink      string            `json:"primaryLink,omitempty"`
+	ImageCodes       []ImageCode       `json:"imageCodes,omitempty"`
+	PDFTexts         []PDFText         `json:"pdfTexts,omitempty"`
+	Headers          []Header          `json:"headers,omitempty"`
+	EmbeddedMessages []EmbeddedMessage `json:"embeddedMessages,omitempty"` // 继续嵌套的邮件
+}
+
+// CodeCandidate 验证码候选
+type CodeCandidate struct {
+	Code      string  `json:"code"`               // 去除分隔符后的验证码
+	Display   string  `json:"display,omitempty"`  // 邮件中的原始写法
+	Source    string  `json:"source"`             // 来源：subject/text/html/attachment
+	Extractor string  `json:"extractor"`          // 提取器名称
+	Rule      string  `json:"rule,omitempty"`     // 命中的提取规则名称
+	Evidence  string  `json:"evidence,omitempty"` // AI给出的、包含验证码的邮件原句
+	Score     float64 `json:"score"`              // 可信度，0到1
+}
+
+// Link 邮件中的可操作链接（验证、激活、登录等）
+type Link struct {
+	URL    string `json:"url"`
+	Text   string `json:"text,omitempty"`   // 锚文本
+	Kind   string `json:"kind,omitempty"`   // verify/confirm/activate/reset/login/invite
+	Source string `json:"source,omitempty"` // 来源：image表示来自图片中的二维码，attachment表示附件，为空表示正文
+	Score  int    `json:"score"`            // 启发式得分，越高越可能是操作链接
+}
+
+// ImageCode 图片附件、内嵌图片或data URI图片中解码出的二维码、条形码
+type ImageCode struct {
+	Source  string `json:"source,omitempty"` // 图片的文件名、cid或data-uri
+	Format  string `json:"format"`           // QR_CODE、DATA_MATRIX、CODE_128等
+	Kind    string `json:"kind"`             // url/otpauth/text
+	Payload string `json:"payload"`          // 解码出的内容
+}
+
+// PDFText PDF附件中提取的文本片段，用于查看验证码的出处
+type PDFText struct {
+	Filename     string `json:"filename,omitempty"`
+	Pages        int    `json:"pages"`                  // 解析的页数
+	Snippet      string `json:"snippet"`                // 验证码附近的文本，PDF中没有验证码时为开头的文本
+	ContainsCode bool   `json:"containsCode,omitempty"` // 片段中是否包含邮件的验证码
+}
+
+// TOTPKey 邮件中的两步验证（TOTP）密钥，例如注册两步验证时发送的otpauth://链接
+type TOTPKey struct {
+	Issuer    string `json:"issuer,omitempty"`
+	Account   string `json:"account,omitempty"`
+	Secret    string `json:"secret"`    // Base32编码的密钥
+	Algorithm string `json:"algorithm"` // SHA1/SHA256/SHA512
+	Digits    int    `json:"digits"`
+	Period    int    `json:"period"` // 时间步长（秒）
+	Source    string `json:"source"` // 来源：uri/image/text
+}
+
+// Header 邮件头部字段，同名头部可出现多次
+type Header struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
 }
@@ -21,5 +21,6 @@ func NewStorage(cfg *config.Config) (EmailStorage, func(), error) {
 	// 默认或Redis连接失败时使用内存存储
 	log.Println("使用内存存储")
 	memoryStorage := NewMemoryStorage()
-	return memoryStorage, func() {}, nil
+	memoryStorage.StartJanitor(cfg.MailboxJanitorInterval)
+	return memoryStorage, memoryStorage.Close, nil
 }
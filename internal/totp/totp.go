@@ -0,0 +1,194 @@
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 默认参数（Google Authenticator等应用的约定）
+const (
+	DefaultAlgorithm = "SHA1"
+	DefaultDigits    = 6
+	DefaultPeriod    = 30
+)
+
+const (
+	// 密钥解码后的最小字节数（80位），更短的字符串通常不是密钥
+	minSecretBytes = 10
+	// 允许的验证码位数和时间步长范围
+	minDigits = 6
+	maxDigits = 10
+	maxPeriod = 300
+)
+
+// ErrInvalidSecret 密钥不是有效的Base32字符串
+var ErrInvalidSecret = errors.New("无效的TOTP密钥")
+
+// Key 一个TOTP密钥及其参数
+type Key struct {
+	Issuer    string `json:"issuer,omitempty"`
+	Account   string `json:"account,omitempty"`
+	Secret    string `json:"secret"`    // Base32编码的密钥，已去除空格和填充并转为大写
+	Algorithm string `json:"algorithm"` // SHA1/SHA256/SHA512
+	Digits    int    `json:"digits"`
+	Period    int    `json:"period"` // 时间步长（秒）
+}
+
+// NewKey 使用默认参数创建密钥，secret可以带空格、连字符或小写字母
+func NewKey(secret string) (*Key, error) {
+	key := &Key{
+		Secret:    NormalizeSecret(secret),
+		Algorithm: DefaultAlgorithm,
+		Digits:    DefaultDigits,
+		Period:    DefaultPeriod,
+	}
+	if err := key.Validate(); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// ParseURI 解析otpauth://totp/标签?secret=...&issuer=...&algorithm=...&digits=...&period=...，
+// 不支持基于计数器的hotp
+func ParseURI(uri string) (*Key, error) {
+	u, err := url.Parse(strings.TrimSpace(uri))
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(u.Scheme, "otpauth") {
+		return nil, fmt.Errorf("不是otpauth链接: %s", u.Scheme)
+	}
+	if !strings.EqualFold(u.Host, "totp") {
+		return nil, fmt.Errorf("不支持的OTP类型: %s", u.Host)
+	}
+
+	query := u.Query()
+	key := &Key{
+		Secret:    NormalizeSecret(query.Get("secret")),
+		Issuer:    strings.TrimSpace(query.Get("issuer")),
+		Algorithm: strings.ToUpper(strings.TrimSpace(query.Get("algorithm"))),
+		Digits:    DefaultDigits,
+		Period:    DefaultPeriod,
+	}
+	if key.Algorithm == "" {
+		key.Algorithm = DefaultAlgorithm
+	}
+	if digits := query.Get("digits"); digits != "" {
+		if key.Digits, err = strconv.Atoi(digits); err != nil {
+			return nil, fmt.Errorf("无效的位数: %s", digits)
+		}
+	}
+	if period := query.Get("period"); period != "" {
+		if key.Period, err = strconv.Atoi(period); err != nil {
+			return nil, fmt.Errorf("无效的时间步长: %s", period)
+		}
+	}
+
+	// 标签格式为"发行方:账号"或"账号"
+	label := strings.TrimPrefix(u.Path, "/")
+	if issuer, account, ok := strings.Cut(label, ":"); ok {
+		key.Account = strings.TrimSpace(account)
+		if key.Issuer == "" {
+			key.Issuer = strings.TrimSpace(issuer)
+		}
+	} else {
+		key.Account = strings.TrimSpace(label)
+	}
+
+	if err := key.Validate(); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// NormalizeSecret 去除密钥中的空格、连字符和填充并转为大写
+func NormalizeSecret(secret string) string {
+	secret = strings.Map(func(r rune) rune {
+		if r == ' ' || r == '-' || r == '\t' || r == '=' {
+			return -1
+		}
+		return r
+	}, secret)
+	return strings.ToUpper(secret)
+}
+
+// Validate 检查密钥和参数
+func (k *Key) Validate() error {
+	secret, err := k.secretBytes()
+	if err != nil || len(secret) < minSecretBytes {
+		return ErrInvalidSecret
+	}
+	if _, err := newHash(k.Algorithm); err != nil {
+		return err
+	}
+	if k.Digits < minDigits || k.Digits > maxDigits {
+		return fmt.Errorf("不支持的位数: %d", k.Digits)
+	}
+	if k.Period <= 0 || k.Period > maxPeriod {
+		return fmt.Errorf("不支持的时间步长: %d", k.Period)
+	}
+	return nil
+}
+
+// Code 按RFC 6238计算时间t的验证码
+func (k *Key) Code(t time.Time) (string, error) {
+	secret, err := k.secretBytes()
+	if err != nil {
+		return "", ErrInvalidSecret
+	}
+	newHashFunc, err := newHash(k.Algorithm)
+	if err != nil {
+		return "", err
+	}
+
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(t.Unix())/uint64(k.Period))
+	mac := hmac.New(newHashFunc, secret)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	// RFC 4226的动态截断
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	modulo := uint64(1)
+	for i := 0; i < k.Digits; i++ {
+		modulo *= 10
+	}
+	return fmt.Sprintf("%0*d", k.Digits, uint64(value)%modulo), nil
+}
+
+// Remaining 返回时间t的验证码还剩多久失效
+func (k *Key) Remaining(t time.Time) time.Duration {
+	period := int64(k.Period)
+	next := (t.Unix()/period + 1) * period
+	return time.Unix(next, 0).Sub(t)
+}
+
+// secretBytes 解码Base32密钥
+func (k *Key) secretBytes() ([]byte, error) {
+	return base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(k.Secret)
+}
+
+// newHash 返回算法对应的哈希函数
+func newHash(algorithm string) (func() hash.Hash, error) {
+	switch strings.ToUpper(algorithm) {
+	case "SHA1":
+		return sha1.New, nil
+	case "SHA256":
+		return sha256.New, nil
+	case "SHA512":
+		return sha512.New, nil
+	}
+	return nil, fmt.Errorf("不支持的算法: %s", algorithm)
+}
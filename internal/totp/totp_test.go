@@ -0,0 +1,142 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret 返回RFC 6238附录B中各算法使用的种子（Base32编码）
+func rfcSecret(algorithm string) string {
+	seed := map[string]string{
+		"SHA1":   "12345678901234567890",
+		"SHA256": "12345678901234567890123456789012",
+		"SHA512": "1234567890123456789012345678901234567890123456789012345678901234",
+	}[algorithm]
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte(seed))
+}
+
+// TestCodeRFC6238 使用RFC 6238附录B的测试向量（8位，30秒）
+func TestCodeRFC6238(t *testing.T) {
+	tests := []struct {
+		unix int64
+		want map[string]string
+	}{
+		{59, map[string]string{"SHA1": "94287082", "SHA256": "46119246", "SHA512": "90693936"}},
+		{1111111109, map[string]string{"SHA1": "07081804", "SHA256": "68084774", "SHA512": "25091201"}},
+		{1111111111, map[string]string{"SHA1": "14050471", "SHA256": "67062674", "SHA512": "99943326"}},
+		{1234567890, map[string]string{"SHA1": "89005924", "SHA256": "91819424", "SHA512": "93441116"}},
+		{2000000000, map[string]string{"SHA1": "69279037", "SHA256": "90698825", "SHA512": "38618901"}},
+		{20000000000, map[string]string{"SHA1": "65353130", "SHA256": "77737706", "SHA512": "47863826"}},
+	}
+	for _, tt := range tests {
+		for algorithm, want := range tt.want {
+			key := &Key{Secret: rfcSecret(algorithm), Algorithm: algorithm, Digits: 8, Period: 30}
+			if err := key.Validate(); err != nil {
+				t.Fatalf("%s: %v", algorithm, err)
+			}
+			got, err := key.Code(time.Unix(tt.unix, 0))
+			if err != nil {
+				t.Fatalf("%s T=%d: %v", algorithm, tt.unix, err)
+			}
+			if got != want {
+				t.Errorf("%s T=%d: 期望%s，实际%s", algorithm, tt.unix, want, got)
+			}
+		}
+	}
+}
+
+// TestCodeDefaultDigits 默认6位验证码是8位验证码的后6位，不足时补0
+func TestCodeDefaultDigits(t *testing.T) {
+	key, err := NewKey(strings.ToLower(rfcSecret("SHA1")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := key.Code(time.Unix(1111111109, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "081804" {
+		t.Errorf("期望081804，实际%s", got)
+	}
+}
+
+// TestRemaining 返回到下一个时间步长开始的剩余时间
+func TestRemaining(t *testing.T) {
+	key := &Key{Period: 30}
+	for unix, want := range map[int64]time.Duration{0: 30 * time.Second, 59: time.Second, 60: 30 * time.Second, 75: 15 * time.Second} {
+		if got := key.Remaining(time.Unix(unix, 0)); got != want {
+			t.Errorf("T=%d: 期望%v，实际%v", unix, want, got)
+		}
+	}
+}
+
+// TestNormalizeSecret 去除空格、连字符、制表符和填充并转为大写
+func TestNormalizeSecret(t *testing.T) {
+	if got := NormalizeSecret("jbsw y3dp-ehpk\t3pxp=="); got != "JBSWY3DPEHPK3PXP" {
+		t.Errorf("期望JBSWY3DPEHPK3PXP，实际%s", got)
+	}
+}
+
+// TestParseURI 解析链接中的标签、发行方和参数，没有参数时使用默认值
+func TestParseURI(t *testing.T) {
+	tests := []struct {
+		name string
+		uri  string
+		want Key
+	}{
+		{
+			name: "默认参数",
+			uri:  "otpauth://totp/alice@example.com?secret=JBSWY3DPEHPK3PXP",
+			want: Key{Account: "alice@example.com", Secret: "JBSWY3DPEHPK3PXP", Algorithm: "SHA1", Digits: 6, Period: 30},
+		},
+		{
+			name: "标签中的发行方",
+			uri:  "otpauth://totp/Example:alice@example.com?secret=jbsw%20y3dp%20ehpk%203pxp",
+			want: Key{Issuer: "Example", Account: "alice@example.com", Secret: "JBSWY3DPEHPK3PXP", Algorithm: "SHA1", Digits: 6, Period: 30},
+		},
+		{
+			name: "issuer参数优先",
+			uri:  "otpauth://totp/Label:bob?secret=JBSWY3DPEHPK3PXP&issuer=ACME%20Co",
+			want: Key{Issuer: "ACME Co", Account: "bob", Secret: "JBSWY3DPEHPK3PXP", Algorithm: "SHA1", Digits: 6, Period: 30},
+		},
+		{
+			name: "全部参数",
+			uri:  "OTPAUTH://TOTP/ACME:carol?secret=JBSWY3DPEHPK3PXP&algorithm=sha512&digits=8&period=60",
+			want: Key{Issuer: "ACME", Account: "carol", Secret: "JBSWY3DPEHPK3PXP", Algorithm: "SHA512", Digits: 8, Period: 60},
+		},
+	}
+	for _, tt := range tests {
+		key, err := ParseURI(tt.uri)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if *key != tt.want {
+			t.Errorf("%s: 期望%+v，实际%+v", tt.name, tt.want, *key)
+		}
+	}
+}
+
+// TestParseURIInvalid 密钥、类型和参数无效时返回错误
+func TestParseURIInvalid(t *testing.T) {
+	for name, uri := range map[string]string{
+		"不是otpauth": "https://example.com/?secret=JBSWY3DPEHPK3PXP",
+		"hotp":      "otpauth://hotp/alice?secret=JBSWY3DPEHPK3PXP&counter=1",
+		"缺少密钥":      "otpauth://totp/alice",
+		"非Base32字符": "otpauth://totp/alice?secret=JBSWY3DPEHPK3PX1",
+		"密钥过短":      "otpauth://totp/alice?secret=JBSWY3DP",
+		"位数不是数字":    "otpauth://totp/alice?secret=JBSWY3DPEHPK3PXP&digits=six",
+		"位数过少":      "otpauth://totp/alice?secret=JBSWY3DPEHPK3PXP&digits=4",
+		"位数过多":      "otpauth://totp/alice?secret=JBSWY3DPEHPK3PXP&digits=11",
+		"时间步长为0":    "otpauth://totp/alice?secret=JBSWY3DPEHPK3PXP&period=0",
+		"时间步长过长":    "otpauth://totp/alice?secret=JBSWY3DPEHPK3PXP&period=301",
+		"时间步长不是数字":  "otpauth://totp/alice?secret=JBSWY3DPEHPK3PXP&period=30s",
+		"不支持的算法":    "otpauth://totp/alice?secret=JBSWY3DPEHPK3PXP&algorithm=MD5",
+	} {
+		if key, err := ParseURI(uri); err == nil {
+			t.Errorf("%s: 期望返回错误，实际 %+v", name, key)
+		}
+	}
+}
@@ -3,13 +3,16 @@ package main
 import (
 	"fmt"
 	"log"
+	"os"
 	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"mail-temp/config"
+	"mail-temp/internal/cli"
 	"mail-temp/internal/email"
 	"mail-temp/internal/handler"
+	"mail-temp/internal/imageproxy"
 	"mail-temp/internal/repository"
 )
 
@@ -20,6 +23,11 @@ func main() {
 	//TIP <p>Press <shortcut actionId="ShowIntentionActions"/> when your caret is at the underlined text
 	// to see how GoLand suggests fixing the warning.</p><p>Alternatively, if available, click the lightbulb to view possible fixes.</p>
 
+	// 带参数时执行命令行子命令，例如 mail-temp test-rule
+	if len(os.Args) > 1 {
+		os.Exit(cli.Run(os.Args[1:]))
+	}
+
 	// 加载配置
 	cfg, err := config.LoadConfig()
 	if err != nil {
@@ -41,10 +49,31 @@ func main() {
 	defer closeStorage()
 
 	// 创建邮箱生成器
-	emailGenerator := email.NewEmailGenerator(cfg.MailDomain, storage)
+	emailGenerator, err := email.NewEmailGenerator(cfg.MailDomain, storage, email.UsernameOptions{
+		Strategy:  cfg.UsernameStrategy,
+		HexLength: cfg.UsernameLength,
+		Entropy:   cfg.UsernameEntropy,
+	}, email.MailboxTTLOptions{
+		Default: cfg.MailboxTTL,
+		Min:     cfg.MailboxMinTTL,
+		Max:     cfg.MailboxMaxTTL,
+	})
+	if err != nil {
+		log.Fatalf("创建邮箱生成器失败: %v", err)
+	}
+
+	// 创建图片代理
+	imageProxy := imageproxy.NewProxy(imageproxy.Options{
+		Secret:               cfg.ImageProxySecret,
+		URLTTL:               cfg.ImageProxyURLTTL,
+		MaxBytes:             cfg.ImageProxyMaxBytes,
+		Timeout:              cfg.ImageProxyTimeout,
+		CacheBytes:           cfg.ImageProxyCacheBytes,
+		AllowPrivateNetworks: cfg.ImageProxyAllowPrivate,
+	})
 
 	// 创建邮件接收器
-	emailReceiver, err := email.NewEmailReceiver(cfg, emailGenerator, storage)
+	emailReceiver, err := email.NewEmailReceiver(cfg, emailGenerator, storage, imageProxy)
 	if err != nil {
 		log.Fatalf("创建邮件接收器失败: %v", err)
 	}
@@ -65,13 +94,22 @@ func main() {
 	emailReceiver.StartListening(time.Second * 10)
 	log.Println("邮件监听已启动，每10秒检查一次新邮件")
 
-	// 创建Gin路由
-	router := gin.Default()
+	// 创建Gin路由，访问日志中隐藏查询参数里的邮箱访问令牌
+	router := gin.New()
+	router.Use(handler.AccessLogger(), gin.Recovery())
 
 	// 创建API处理器
-	apiHandler := handler.NewAPIHandler(emailGenerator, emailReceiver)
+	apiHandler := handler.NewAPIHandler(emailGenerator, emailReceiver, cfg.AdminToken)
 	apiHandler.SetupRoutes(router)
 
+	// 创建邮件渲染处理器
+	renderHandler := handler.NewRenderHandler(emailGenerator, emailReceiver)
+	renderHandler.SetupRoutes(router)
+
+	// 创建图片代理处理器
+	imageProxyHandler := handler.NewImageProxyHandler(imageProxy)
+	imageProxyHandler.SetupRoutes(router)
+
 	// 创建Web处理器
 	webHandler := handler.NewWebHandler("web/templates", "web/static")
 	webHandler.SetupRoutes(router)
@@ -5,12 +5,23 @@ const app = Vue.createApp({
             currentEmail: '',
             messages: [],
             refreshInterval: null,
+            eventSource: null,
             toast: {
                 show: false,
                 message: ''
             },
             showEmailList: false,
             activeEmails: [],
+            imageMessages: {},
+            source: {
+                show: false,
+                content: '',
+                downloadUrl: ''
+            },
+            usernameStrategy: localStorage.getItem('usernameStrategy') || '',
+            mailboxTTL: localStorage.getItem('mailboxTTL') || '',
+            emailExpiry: JSON.parse(localStorage.getItem('emailExpiry') || '{}'),
+            emailTokens: JSON.parse(localStorage.getItem('emailTokens') || '{}'),
             isLoading: false
         };
     },
@@ -22,9 +33,17 @@ const app = Vue.createApp({
                 this.messages = [];
                 this.isLoading = true;
                 
-                const response = await axios.get('/api/email/new');
+                // 记住选择的用户名生成方式和有效期
+                localStorage.setItem('usernameStrategy', this.usernameStrategy);
+                localStorage.setItem('mailboxTTL', this.mailboxTTL);
+                const params = {};
+                if (this.usernameStrategy) params.strategy = this.usernameStrategy;
+                if (this.mailboxTTL) params.ttl = this.mailboxTTL;
+                const response = await axios.get('/api/email/new', { params });
                 if (response.data.status === 'success') {
+                    this.setEmailToken(response.data.email, response.data.token);
                     this.currentEmail = response.data.email;
+                    this.setEmailExpiry(response.data.email, response.data.expiresAt);
                     this.startAutoRefresh();
                     this.showToast('已生成新的临时邮箱');
                 }
@@ -57,7 +76,10 @@ const app = Vue.createApp({
                 console.error('获取邮件失败', error);
                 // 只在手动刷新时显示错误提示
                 if (showLoading) {
-                    this.showToast('获取邮件失败，请重试');
+                    const status = error.response && error.response.status;
+                    this.showToast(status === 401 || status === 403
+                        ? '无法访问该邮箱：本浏览器没有它的访问令牌，或邮箱已过期'
+                        : '获取邮件失败，请重试');
                 }
             } finally {
                 if (showLoading) {
@@ -78,6 +100,50 @@ const app = Vue.createApp({
                 });
         },
         
+        // 续期当前邮箱
+        async extendEmail() {
+            if (!this.currentEmail) return;
+            try {
+                localStorage.setItem('mailboxTTL', this.mailboxTTL);
+                const response = await axios.post(`/api/email/${encodeURIComponent(this.currentEmail)}/extend`,
+                    this.mailboxTTL ? { ttl: this.mailboxTTL } : {});
+                if (response.data.status === 'success') {
+                    this.setEmailExpiry(response.data.email, response.data.expiresAt);
+                    this.showToast(`邮箱已续期，${this.mailboxExpiryText(response.data.email)}`);
+                }
+            } catch (error) {
+                console.error('续期邮箱失败', error);
+                const message = error.response && error.response.data && error.response.data.message;
+                this.showToast(message ? `续期失败: ${message}` : '续期失败，请重试');
+            }
+        },
+        
+        // 记录邮箱的访问令牌，令牌只在创建时返回一次
+        setEmailToken(email, token) {
+            if (token) {
+                this.emailTokens[email] = token;
+            } else {
+                delete this.emailTokens[email];
+            }
+            localStorage.setItem('emailTokens', JSON.stringify(this.emailTokens));
+        },
+        
+        // 记录邮箱的过期时间
+        setEmailExpiry(email, expiresAt) {
+            if (expiresAt) {
+                this.emailExpiry[email] = expiresAt;
+            } else {
+                delete this.emailExpiry[email];
+            }
+            localStorage.setItem('emailExpiry', JSON.stringify(this.emailExpiry));
+        },
+        
+        // 邮箱有效期说明
+        mailboxExpiryText(email) {
+            const expiresAt = new Date(this.emailExpiry[email]);
+            return expiresAt <= new Date() ? '已过期' : `有效期至 ${this.formatTime(expiresAt)}`;
+        },
+        
         // 复制验证码
         copyCode(code) {
             navigator.clipboard.writeText(code)
@@ -90,6 +156,87 @@ const app = Vue.createApp({
                 });
         },
         
+        // 验证码是否已过期：优先使用服务端读取时的结果，页面长时间未刷新时按本地时间判断
+        isCodeExpired(message) {
+            if (message.codeExpired) return true;
+            return !!message.codeExpiresAt && new Date(message.codeExpiresAt) <= new Date();
+        },
+        
+        // 验证码有效期说明
+        codeExpiryText(message) {
+            const expiresAt = new Date(message.codeExpiresAt);
+            const time = expiresAt.toLocaleTimeString('zh-CN', { hour: '2-digit', minute: '2-digit' });
+            return this.isCodeExpired(message) ? `已于 ${time} 过期` : `有效期至 ${time}`;
+        },
+        
+        // 图片中解码出的内容的说明
+        imageCodeLabel(imageCode) {
+            const labels = {
+                url: '二维码链接',
+                otpauth: '两步验证密钥',
+                text: '二维码内容'
+            };
+            if (imageCode.kind === 'text' && imageCode.format !== 'QR_CODE') {
+                return '条形码内容';
+            }
+            return labels[imageCode.kind] || '二维码内容';
+        },
+        
+        // 复制图片中解码出的内容
+        copyImageCode(imageCode) {
+            if (imageCode.kind === 'url') {
+                this.copyLink(imageCode.payload);
+            } else {
+                navigator.clipboard.writeText(imageCode.payload)
+                    .then(() => {
+                        this.showToast('已复制到剪贴板');
+                    })
+                    .catch(err => {
+                        console.error('复制失败', err);
+                        this.showToast('复制失败，请手动选择并复制');
+                    });
+            }
+        },
+        
+        // 按邮件中的两步验证密钥获取并复制当前的TOTP验证码
+        async copyTOTPCode(totpKey) {
+            try {
+                const response = await axios.get(`/api/email/${encodeURIComponent(this.currentEmail)}/totp`, {
+                    params: { issuer: totpKey.issuer, account: totpKey.account }
+                });
+                await navigator.clipboard.writeText(response.data.code);
+                this.showToast(`验证码 ${response.data.code} 已复制，${response.data.expiresIn} 秒后失效`);
+            } catch (error) {
+                console.error('获取两步验证码失败', error);
+                this.showToast('获取两步验证码失败');
+            }
+        },
+        
+        // 验证码候选的来源说明
+        candidateTitle(candidate) {
+            const sources = {
+                subject: '主题',
+                text: '正文',
+                html: 'HTML',
+                attachment: '附件',
+                image: '图片'
+            };
+            const title = `来源: ${sources[candidate.source] || candidate.source}，可信度: ${Math.round(candidate.score * 100)}%`;
+            return candidate.evidence ? `${title}\n依据: ${candidate.evidence}` : title;
+        },
+        
+        // 复制操作链接
+        copyLink(link) {
+            navigator.clipboard.writeText(link)
+                .then(() => {
+                    this.showToast('链接已复制到剪贴板');
+                })
+                .catch(err => {
+                    console.error('复制失败', err);
+                    this.showToast('复制失败，请手动选择并复制');
+                });
+        },
+        
         // 显示提示信息
         showToast(message) {
             this.toast.message = message;
@@ -169,6 +316,29 @@ const app = Vue.createApp({
             this.refreshInterval = setInterval(() => {
                 this.refreshMessages(false);
             }, 10000);
+            
+            this.subscribeEvents();
+        },
+        
+        // 订阅当前邮箱的新邮件和更新事件（例如后台AI识别出验证码），收到后立即刷新
+        subscribeEvents() {
+            this.closeEvents();
+            if (!this.currentEmail || !window.EventSource) return;
+            
+            // EventSource无法设置请求头，令牌放在查询参数中
+            const token = encodeURIComponent(this.emailTokens[this.currentEmail] || '');
+            this.eventSource = new EventSource(`/api/email/${encodeURIComponent(this.currentEmail)}/events?token=${token}`);
+            const refresh = () => this.refreshMessages(false);
+            this.eventSource.addEventListener('message', refresh);
+            this.eventSource.addEventListener('update', refresh);
+        },
+        
+        // 关闭事件订阅
+        closeEvents() {
+            if (this.eventSource) {
+                this.eventSource.close();
+                this.eventSource = null;
+            }
         },
         
         // 显示活跃邮箱列表
@@ -187,12 +357,23 @@ const app = Vue.createApp({
             this.showEmailList = false;
         },
         
-        // 获取活跃邮箱列表
+        // 获取本浏览器保存了访问令牌的活跃邮箱，并清理已过期邮箱的令牌
         async fetchActiveEmails() {
             try {
-                const response = await axios.get('/api/email/list');
+                const response = await axios.get('/api/email/list', {
+                    headers: { 'X-Mailbox-Token': Object.values(this.emailTokens).join(',') }
+                });
                 if (response.data.status === 'success') {
                     this.activeEmails = response.data.emails;
+                    (response.data.mailboxes || []).forEach(mailbox => {
+                        this.setEmailExpiry(mailbox.email, mailbox.expiresAt);
+                    });
+                    Object.keys(this.emailTokens).forEach(email => {
+                        if (!this.activeEmails.includes(email)) {
+                            this.setEmailToken(email, null);
+                            this.setEmailExpiry(email, null);
+                        }
+                    });
                 }
             } catch (error) {
                 console.error('获取活跃邮箱列表失败', error);
@@ -226,6 +407,8 @@ const app = Vue.createApp({
                 if (response.data.status === 'success') {
                     // 从列表中移除
                     this.activeEmails = this.activeEmails.filter(e => e !== email);
+                    this.setEmailExpiry(email, null);
+                    this.setEmailToken(email, null);
                     
                     // 如果删除的是当前邮箱，清空当前邮箱
                     if (this.currentEmail === email) {
@@ -235,6 +418,7 @@ const app = Vue.createApp({
                             clearInterval(this.refreshInterval);
                             this.refreshInterval = null;
                         }
+                        this.closeEvents();
                     }
                     
                     this.showToast('邮箱已删除');
@@ -250,33 +434,42 @@ const app = Vue.createApp({
             }
         },
         
-        // 处理HTML内容，修复常见的编码问题
-        processHtmlContent(html) {
-            if (!html) return '';
-            
-            // 替换常见的编码问题
-            html = html.replace(/=3D/g, '=');
-            html = html.replace(/=\\r\\n/g, '');
-            html = html.replace(/=\r\n/g, '');
-            
-            // 修复HTML中常见的引号和属性问题
-            html = html.replace(/=22/g, '"');
-            html = html.replace(/=27/g, "'");
-            html = html.replace(/=20/g, ' ');
-            
-            // 移除邮件客户端特有的标记
-            html = html.replace(/\(MISSING\)/g, '');
-            
-            // 处理邮件中的图片链接，确保使用https
-            html = html.replace(/src="http:\/\//g, 'src="https://');
-            
-            // 为外部链接添加安全属性
-            html = html.replace(/<a\s+(?!target)/g, '<a target="_blank" rel="noopener nofollow" ');
-            
-            // 对于没有指定样式的图片，设置最大宽度为100%
-            html = html.replace(/<img(?!\s+style)/g, '<img style="max-width:100%;height:auto" ');
-            
-            return html;
+        // 获取邮件HTML的沙箱渲染地址，iframe无法设置请求头，令牌放在查询参数中
+        renderUrl(message) {
+            const token = encodeURIComponent(this.emailTokens[this.currentEmail] || '');
+            const url = `/api/email/${encodeURIComponent(this.currentEmail)}/messages/${encodeURIComponent(message.id)}/render?token=${token}`;
+            return this.imageMessages[message.id] ? `${url}&images=1` : url;
+        },
+        
+        // 切换邮件是否加载远程图片（通过内置图片代理）
+        toggleImages(message) {
+            this.imageMessages[message.id] = !this.imageMessages[message.id];
+        },
+        
+        // 获取邮件原始内容的地址
+        rawUrl(message) {
+            return `/api/email/${encodeURIComponent(this.currentEmail)}/messages/${encodeURIComponent(message.id)}/raw`;
+        },
+        
+        // 查看邮件源码
+        async viewSource(message) {
+            try {
+                const response = await axios.get(this.rawUrl(message), { params: { inline: 1 }, responseType: 'text' });
+                this.source.content = response.data;
+                // 下载链接无法设置请求头，令牌放在查询参数中
+                const token = encodeURIComponent(this.emailTokens[this.currentEmail] || '');
+                this.source.downloadUrl = `${this.rawUrl(message)}?token=${token}`;
+                this.source.show = true;
+            } catch (error) {
+                console.error('获取邮件源码失败', error);
+                this.showToast('获取邮件源码失败，请重试');
+            }
+        },
+        
+        // 关闭邮件源码弹窗
+        closeSource() {
+            this.source.show = false;
+            this.source.content = '';
         },
         
         // 判断是否应该显示滚动提示
@@ -285,6 +478,16 @@ const app = Vue.createApp({
         }
     },
     mounted() {
+        // 访问邮箱的请求带上该邮箱的访问令牌
+        axios.interceptors.request.use(config => {
+            const match = /^\/api\/email\/([^/?]+)(?:[/?]|$)/.exec(config.url || '');
+            const token = match && this.emailTokens[decodeURIComponent(match[1])];
+            if (token) {
+                config.headers['X-Mailbox-Token'] = token;
+            }
+            return config;
+        });
+        
         // 检查是否有存储在localStorage中的邮箱
         const savedEmail = localStorage.getItem('tempEmail');
         if (savedEmail) {
@@ -305,6 +508,9 @@ const app = Vue.createApp({
             if (e.key === 'Escape' && this.showEmailList) {
                 this.closeEmailList();
             }
+            if (e.key === 'Escape' && this.source.show) {
+                this.closeSource();
+            }
         });
     },
     beforeUnmount() {
@@ -312,6 +518,7 @@ const app = Vue.createApp({
         if (this.refreshInterval) {
             clearInterval(this.refreshInterval);
         }
+        this.closeEvents();
     }
 });
 